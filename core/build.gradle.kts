@@ -15,6 +15,13 @@ val kotlinVersion: String by project
 group = biotopiumSubmoduleGroupId
 version = biotopiumVersion
 
+// test data shared with the block validation of gop2p
+val goP2pTestDataProperty = "biotopium.gop2p.testdata"
+val goP2pTestData = rootProject.file("network/gop2p/src/jvmMain/go/gop2p/blockchain/testdata")
+
+// tests initializing the blocklord source with the blocklord of the shared block vectors
+val blockVectorTests = "ch.riesenacht.biotopium.core.blockchain.BlockValidatorVectorTest"
+
 repositories {
     mavenCentral()
 }
@@ -35,6 +42,8 @@ kotlin {
         withJava()
         testRuns["test"].executionTask.configure {
             useJUnitPlatform()
+            systemProperty(goP2pTestDataProperty, goP2pTestData.absolutePath)
+            filter.excludeTestsMatching(blockVectorTests)
         }
     }
     sourceSets {
@@ -73,3 +82,20 @@ kotlin {
         val jsTest by getting
     }
 }
+
+// the blocklord source can only be initialized once per JVM,
+// hence the block vector tests run in their own JVM
+val jvmBlockVectorTest by tasks.registering(Test::class) {
+    description = "Runs the block vector tests shared with gop2p on the JVM."
+    group = "verification"
+    val jvmTest = tasks.named<Test>("jvmTest").get()
+    testClassesDirs = jvmTest.testClassesDirs
+    classpath = jvmTest.classpath
+    useJUnitPlatform()
+    systemProperty(goP2pTestDataProperty, goP2pTestData.absolutePath)
+    filter.includeTestsMatching(blockVectorTests)
+}
+
+tasks.named("check") {
+    dependsOn(jvmBlockVectorTest)
+}
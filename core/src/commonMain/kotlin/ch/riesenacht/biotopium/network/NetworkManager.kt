@@ -19,11 +19,14 @@
 package ch.riesenacht.biotopium.network
 
 import ch.riesenacht.biotopium.core.blockchain.model.Address
+import ch.riesenacht.biotopium.core.crypto.model.PrivateKey
 import ch.riesenacht.biotopium.logging.Logging
 import ch.riesenacht.biotopium.network.model.PeerId
 import ch.riesenacht.biotopium.network.model.config.P2pConfiguration
 import ch.riesenacht.biotopium.network.model.message.Message
 import ch.riesenacht.biotopium.network.model.message.PeerAddressInfoMessage
+import kotlinx.serialization.InternalSerializationApi
+import kotlinx.serialization.serializer
 import kotlin.reflect.KClass
 
 /**
@@ -39,24 +42,17 @@ class NetworkManager(p2pConfig: P2pConfiguration) {
 
     private val logger = Logging.logger { }
 
-    init {
-       registerMessageHandler(PeerAddressInfoMessage::class) { wrapper, _ ->
-            val message = wrapper.message
-            peerAddressBook.add(message.peerId, message.address)
-            logger.debug { "added peer address book entry: ${message.peerId} <=> ${message.address}" }
-        }
-    }
-
     /**
      * Sends a [message] to the host of a [address].
+     * The address is resolved by a verified peer record, the resolved peer ID is recorded in the [peerAddressBook].
+     * Unauthenticated [PeerAddressInfoMessage]s are not trusted.
      * @throws AddressUnreachableException the address cannot be mapped to a peer ID
      */
     @Throws(AddressUnreachableException::class)
     fun send(address: Address, message: Message) {
-        if(!peerAddressBook.peerId.containsKey(address)) {
-            throw AddressUnreachableException(address)
-        }
-        val peerId = peerAddressBook.peerId[address]!!
+        val peerId = p2pNode.resolveAddress(address.publicKey.base64) ?: throw AddressUnreachableException(address)
+        peerAddressBook.add(peerId, address)
+        logger.debug { "resolved peer address book entry: $peerId <=> $address" }
         p2pNode.send(peerId, message)
     }
 
@@ -75,10 +71,11 @@ class NetworkManager(p2pConfig: P2pConfiguration) {
     }
 
     /**
-     * Sends the peer [address] info message to all reachable peers.
+     * Publishes a signed peer record binding the own peer ID to the address of the player's [private key][privateKey].
+     * Other peers verify the record before they resolve the address to the own peer ID.
      */
-    fun sendPeerAddressInfoMessage(address: Address) {
-        p2pNode.sendBroadcast(PeerAddressInfoMessage(p2pNode.peerId, address))
+    fun publishPeerRecord(privateKey: PrivateKey) {
+        p2pNode.publishPeerRecord(privateKey.base64)
     }
 
     /**
@@ -97,9 +94,14 @@ class NetworkManager(p2pConfig: P2pConfiguration) {
 
     /**
      * Registers a new message [handler] for a [type] of [Message] on the [p2pNode].
+     * The [p2pNode] is subscribed to the type, messages of types without handler are no longer delivered.
      * Delegates to the [p2pNode].
      */
-    fun <T : Message> registerMessageHandler(type: KClass<T>, handler: MessageHandler<T>) = p2pNode.registerMessageHandler(type, handler)
+    @OptIn(InternalSerializationApi::class)
+    fun <T : Message> registerMessageHandler(type: KClass<T>, handler: MessageHandler<T>) {
+        p2pNode.registerMessageHandler(type, handler)
+        p2pNode.subscribeMessageType(type.serializer().descriptor.serialName)
+    }
 
 
     /**
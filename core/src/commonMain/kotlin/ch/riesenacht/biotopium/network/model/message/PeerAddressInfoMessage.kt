@@ -26,6 +26,7 @@ import kotlinx.serialization.Serializable
 /**
  * Represents the peer address info message.
  * This message is used to publish the relationship between a [peer ID][peerId] and an [address].
+ * The message is not authenticated, hence addresses are resolved by verified peer records instead.
  *
  * @author Manuel Riesen
  */
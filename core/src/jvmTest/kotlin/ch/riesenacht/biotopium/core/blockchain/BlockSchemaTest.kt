@@ -0,0 +1,115 @@
+/*
+ * Copyright (c) 2021 The biotopium Authors.
+ * This file is part of biotopium.
+ *
+ * biotopium is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * biotopium is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with biotopium.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+
+package ch.riesenacht.biotopium.core.blockchain
+
+import ch.riesenacht.biotopium.core.action.model.*
+import ch.riesenacht.biotopium.core.action.model.record.ActionRecord
+import ch.riesenacht.biotopium.core.blockchain.model.block.RawBlock
+import ch.riesenacht.biotopium.core.blockchain.model.record.BlockRecordContent
+import ch.riesenacht.biotopium.core.blockchain.model.record.RawBlockRecord
+import ch.riesenacht.biotopium.core.world.model.item.*
+import ch.riesenacht.biotopium.core.world.model.map.DefaultTile
+import ch.riesenacht.biotopium.core.world.model.map.Plot
+import ch.riesenacht.biotopium.core.world.model.map.Realm
+import ch.riesenacht.biotopium.core.world.model.map.TileType
+import ch.riesenacht.biotopium.core.world.model.plant.GrowingPlant
+import ch.riesenacht.biotopium.core.world.model.plant.PlantGrowth
+import ch.riesenacht.biotopium.core.world.model.plant.PlantType
+import kotlinx.serialization.ExperimentalSerializationApi
+import kotlinx.serialization.PolymorphicSerializer
+import kotlinx.serialization.descriptors.SerialDescriptor
+import kotlinx.serialization.descriptors.elementNames
+import kotlinx.serialization.json.Json
+import kotlinx.serialization.json.JsonObject
+import kotlinx.serialization.json.jsonArray
+import kotlinx.serialization.json.jsonObject
+import kotlinx.serialization.json.jsonPrimitive
+import kotlin.test.Test
+import kotlin.test.assertEquals
+
+/**
+ * Test class for the block schema of gop2p.
+ * The hashable encoding of gop2p depends on the properties of the serializable classes
+ * and the constants of the enums in declaration order, which have to match the core model.
+ *
+ * @author Manuel Riesen
+ */
+@OptIn(ExperimentalSerializationApi::class)
+class BlockSchemaTest {
+
+    /**
+     * The serializable classes of the block schema.
+     */
+    private val classes: List<SerialDescriptor> = listOf(
+        RawBlock.serializer().descriptor,
+        RawBlockRecord.serializer(PolymorphicSerializer(BlockRecordContent::class)).descriptor,
+        ActionRecord.serializer(PolymorphicSerializer(Action::class)).descriptor,
+        ChunkGenesisAction.serializer().descriptor,
+        IntroductionAction.serializer().descriptor,
+        ClaimRealmAction.serializer().descriptor,
+        CreatePlotAction.serializer().descriptor,
+        SeedAction.serializer().descriptor,
+        GrowAction.serializer().descriptor,
+        HarvestAction.serializer().descriptor,
+        Hoe.serializer().descriptor,
+        Seed.serializer().descriptor,
+        RealmClaimPaper.serializer().descriptor,
+        HarvestedPlant.serializer().descriptor,
+        Harvest.serializer().descriptor,
+        IntroductionGift.serializer().descriptor,
+        DefaultTile.serializer().descriptor,
+        Plot.serializer().descriptor,
+        Realm.serializer().descriptor,
+        GrowingPlant.serializer().descriptor
+    )
+
+    /**
+     * The enums of the block schema by their names.
+     */
+    private val enums: Map<String, List<String>> = mapOf(
+        "ActionType" to ActionType.values().map { it.name },
+        "ItemType" to ItemType.values().map { it.name },
+        "TileType" to TileType.values().map { it.name },
+        "PlantType" to PlantType.values().map { it.name },
+        "PlantGrowth" to PlantGrowth.values().map { it.name }
+    )
+
+    private val schema: JsonObject by lazy {
+        Json.parseToJsonElement(GoP2pTestData.read("block_schema.json")).jsonObject
+    }
+
+    /**
+     * Reads a section of the schema, mapping names to lists of strings.
+     */
+    private fun section(name: String): Map<String, List<String>> = schema.getValue(name).jsonObject
+        .mapValues { entry -> entry.value.jsonArray.map { it.jsonPrimitive.content } }
+
+    @Test
+    fun testClasses() {
+        val expected = section("classes")
+        val actual = classes.associate { it.serialName to it.elementNames.toList() }
+        assertEquals(expected, actual)
+    }
+
+    @Test
+    fun testEnums() {
+        assertEquals(section("enums"), enums)
+    }
+}
@@ -0,0 +1,112 @@
+/*
+ * Copyright (c) 2021 The biotopium Authors.
+ * This file is part of biotopium.
+ *
+ * biotopium is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * biotopium is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with biotopium.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+
+package ch.riesenacht.biotopium.core.blockchain
+
+import ch.riesenacht.biotopium.core.blockchain.model.Address
+import ch.riesenacht.biotopium.core.blockchain.model.Hashable
+import ch.riesenacht.biotopium.core.blockchain.model.block.Block
+import ch.riesenacht.biotopium.core.effect.EffectProfile
+import ch.riesenacht.biotopium.core.effect.applyEffect
+import ch.riesenacht.biotopium.serialization.HashableStringEncoder
+import ch.riesenacht.biotopium.serialization.JsonEncoder
+import kotlinx.serialization.SerializationException
+import kotlinx.serialization.json.Json
+import kotlinx.serialization.json.JsonObject
+import kotlinx.serialization.json.jsonArray
+import kotlinx.serialization.json.jsonObject
+import kotlinx.serialization.json.jsonPrimitive
+import kotlin.test.BeforeTest
+import kotlin.test.Test
+import kotlin.test.assertEquals
+import kotlin.test.assertFailsWith
+import kotlin.test.assertTrue
+
+/**
+ * Test class for [BlockValidator], using the block vectors of the gop2p block validation.
+ * A block of a vector is valid if the vector has no error.
+ * The blocklord source is initialized with the blocklord of the vectors, hence the test runs in its own JVM.
+ *
+ * @author Manuel Riesen
+ */
+class BlockValidatorVectorTest {
+
+    /**
+     * The name of the error of blocks containing classes unknown to the core module.
+     */
+    private val unknownClassError = "unknown class"
+
+    private val vectors: JsonObject by lazy {
+        Json.parseToJsonElement(GoP2pTestData.read("block_vectors.json")).jsonObject
+    }
+
+    private val blockVectors: List<JsonObject>
+    get() = vectors.getValue("vectors").jsonArray.map { it.jsonObject }
+
+    private val JsonObject.name: String
+    get() = getValue("name").jsonPrimitive.content
+
+    private val JsonObject.error: String?
+    get() = get("error")?.jsonPrimitive?.content
+
+    /**
+     * Decodes the block of a [vector].
+     */
+    private fun decodeBlock(vector: JsonObject): Block = JsonEncoder.decode(vector.getValue("block").toString())
+
+    @BeforeTest
+    fun init() {
+        applyEffect(VectorTestCoreModuleEffect, EffectProfile.TEST)
+    }
+
+    @Test
+    fun testTrustedAuthors() {
+        vectors.getValue("trustedAuthors").jsonArray.forEach { author ->
+            assertTrue(BlocklordSource.isTrusted(Address.fromBase64(author.jsonPrimitive.content)))
+        }
+    }
+
+    @Test
+    fun testValidateVectors() {
+        blockVectors.filter { it.error != unknownClassError }.forEach { vector ->
+            val block = decodeBlock(vector)
+            val valid = generalBlockRules.all { it(block, block) }
+            assertEquals(vector.error == null, valid, vector.name)
+        }
+    }
+
+    @Test
+    fun testDecodeVectors_negative_unknownClass() {
+        blockVectors.filter { it.error == unknownClassError }.forEach { vector ->
+            assertFailsWith<SerializationException>(vector.name) { decodeBlock(vector) }
+        }
+    }
+
+    /**
+     * The block is encoded as [Hashable], like by [BlockUtils.hash], hence the serial name is included.
+     */
+    @Test
+    fun testEncodeHashableVectors() {
+        blockVectors.filter { it.containsKey("hashable") }.forEach { vector ->
+            val block = decodeBlock(vector)
+            val expected = vector.getValue("hashable").jsonPrimitive.content
+            assertEquals(expected, HashableStringEncoder.encode<Hashable>(block.toHashable()), vector.name)
+        }
+    }
+}
@@ -0,0 +1,50 @@
+/*
+ * Copyright (c) 2021 The biotopium Authors.
+ * This file is part of biotopium.
+ *
+ * biotopium is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * biotopium is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with biotopium.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+
+package ch.riesenacht.biotopium.core.blockchain
+
+import java.io.File
+
+/**
+ * Test data shared with the block validation of gop2p.
+ * The same files are used by the gop2p tests, which proves both implementations agree.
+ *
+ * @author Manuel Riesen
+ */
+object GoP2pTestData {
+
+    /**
+     * The name of the system property holding the test data directory of the gop2p blockchain package.
+     * The property is set by the build of the core module.
+     */
+    private const val directoryProperty = "biotopium.gop2p.testdata"
+
+    /**
+     * The test data directory of the gop2p blockchain package.
+     */
+    private val directory: String by lazy {
+        checkNotNull(System.getProperty(directoryProperty)) { "system property $directoryProperty is not set" }
+    }
+
+    /**
+     * Reads the test data file with the given [name].
+     * @return file content
+     */
+    fun read(name: String): String = File(directory, name).readText()
+}
@@ -25,8 +25,20 @@ package ch.riesenacht.biotopium.logging
  */
 expect object LoggingConfig {
 
+    /**
+     * The current logging level.
+     */
+    val loggingLevel: LoggingLevel
+
     /**
      * Sets the logging [level].
+     * The level listeners are notified.
      */
     fun setLoggingLevel(level: LoggingLevel)
+
+    /**
+     * Adds a level [listener], e.g. of a native library logging on its own.
+     * The listener is notified of the current level immediately and of every level set afterwards.
+     */
+    fun addLevelListener(listener: (LoggingLevel) -> Unit)
 }
\ No newline at end of file
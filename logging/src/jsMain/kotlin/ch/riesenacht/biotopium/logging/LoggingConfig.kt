@@ -29,10 +29,29 @@ import mu.KotlinLoggingLevel
  */
 actual object LoggingConfig {
 
+    /**
+     * The current logging level.
+     */
+    actual val loggingLevel: LoggingLevel
+        get() = LoggingLevel.valueOf(KotlinLoggingConfiguration.LOG_LEVEL.name)
+
+    private val levelListeners: MutableList<(LoggingLevel) -> Unit> = mutableListOf()
+
     /**
      * Sets the logging [level].
+     * The level listeners are notified.
      */
     actual fun setLoggingLevel(level: LoggingLevel) {
         KotlinLoggingConfiguration.LOG_LEVEL = KotlinLoggingLevel.valueOf(level.name)
+        levelListeners.forEach { it(level) }
+    }
+
+    /**
+     * Adds a level [listener], e.g. of a native library logging on its own.
+     * The listener is notified of the current level immediately and of every level set afterwards.
+     */
+    actual fun addLevelListener(listener: (LoggingLevel) -> Unit) {
+        levelListeners.add(listener)
+        listener(loggingLevel)
     }
 }
\ No newline at end of file
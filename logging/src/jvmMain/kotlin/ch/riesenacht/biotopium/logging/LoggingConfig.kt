@@ -28,10 +28,32 @@ import org.slf4j.impl.SimpleLogger
  */
 actual object LoggingConfig {
 
+    /**
+     * The current logging level, the default level of the simple logger unless set.
+     */
+    actual var loggingLevel: LoggingLevel = LoggingLevel.INFO
+        private set
+
+    private val levelListeners: MutableList<(LoggingLevel) -> Unit> = mutableListOf()
+
     /**
      * Sets the logging [level].
+     * The level listeners are notified.
      */
+    @Synchronized
     actual fun setLoggingLevel(level: LoggingLevel) {
         System.setProperty(SimpleLogger.DEFAULT_LOG_LEVEL_KEY, level.name)
+        loggingLevel = level
+        levelListeners.forEach { it(level) }
+    }
+
+    /**
+     * Adds a level [listener], e.g. of a native library logging on its own.
+     * The listener is notified of the current level immediately and of every level set afterwards.
+     */
+    @Synchronized
+    actual fun addLevelListener(listener: (LoggingLevel) -> Unit) {
+        levelListeners.add(listener)
+        listener(loggingLevel)
     }
 }
\ No newline at end of file
@@ -0,0 +1,94 @@
+/*
+ * Copyright (c) 2021 The biotopium Authors.
+ * This file is part of biotopium.
+ *
+ * biotopium is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * biotopium is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with biotopium.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package blockchain
+
+import (
+	"encoding/json"
+)
+
+// Block represents a serialized block of the biotopium blockchain.
+// Only the fields required for validation are decoded,
+// the raw JSON is kept since the hash covers all fields.
+type Block struct {
+	Height    uint64    `json:"height"`    // position on the blockchain
+	Timestamp int64     `json:"timestamp"` // creation time in milliseconds since 1970-01-01
+	PrevHash  string    `json:"prevHash"`  // hash of the previous block
+	Author    string    `json:"author"`    // address of the blocklord
+	Data      []*Record `json:"data"`      // record book of the block
+	Hash      string    `json:"hash"`      // hex encoded SHA3-256 hash of the block
+	Sign      string    `json:"sign"`      // base64 encoded Ed25519 signature of the hash
+
+	raw json.RawMessage // serialized block
+}
+
+// Record represents a serialized block record, e.g. an action record.
+type Record struct {
+	Timestamp int64  `json:"timestamp"` // creation time in milliseconds since 1970-01-01
+	Author    string `json:"author"`    // address of the record author
+	Hash      string `json:"hash"`      // hex encoded SHA3-256 hash of the record
+	Sign      string `json:"sign"`      // base64 encoded Ed25519 signature of the hash
+
+	raw json.RawMessage // serialized record
+}
+
+// UnmarshalJSON decodes a block and keeps its raw JSON.
+func (b *Block) UnmarshalJSON(data []byte) error {
+	type plainBlock Block
+	if err := json.Unmarshal(data, (*plainBlock)(b)); err != nil {
+		return err
+	}
+	b.raw = append(json.RawMessage(nil), data...)
+	return nil
+}
+
+// Raw returns the serialized block.
+func (b *Block) Raw() json.RawMessage {
+	return b.raw
+}
+
+// UnmarshalJSON decodes a record and keeps its raw JSON.
+func (r *Record) UnmarshalJSON(data []byte) error {
+	type plainRecord Record
+	if err := json.Unmarshal(data, (*plainRecord)(r)); err != nil {
+		return err
+	}
+	r.raw = append(json.RawMessage(nil), data...)
+	return nil
+}
+
+// Raw returns the serialized record.
+func (r *Record) Raw() json.RawMessage {
+	return r.raw
+}
+
+// BlockAddMessage represents the message announcing a new block.
+type BlockAddMessage struct {
+	Block *Block `json:"block"` // announced block
+}
+
+// DecodeBlock decodes a serialized block.
+// The serialized block has to be given.
+// The block is returned.
+func DecodeBlock(serialized []byte) (*Block, error) {
+	block := &Block{}
+	if err := json.Unmarshal(serialized, block); err != nil {
+		return nil, err
+	}
+	return block, nil
+}
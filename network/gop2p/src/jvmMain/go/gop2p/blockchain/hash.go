@@ -0,0 +1,187 @@
+/*
+ * Copyright (c) 2021 The biotopium Authors.
+ * This file is part of biotopium.
+ *
+ * biotopium is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * biotopium is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with biotopium.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package blockchain
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/sha3"
+	"strings"
+)
+
+// hashableSeparator separates the values of a hashable string.
+const hashableSeparator = ";"
+
+// ErrUnknownClass is returned if a serialized value has a class unknown to the hashable encoding.
+var ErrUnknownClass = errors.New("unknown class")
+
+// ErrMissingClass is returned if a serialized polymorphic value has no class discriminator.
+// In contrast to an unknown class, a missing class discriminator is never valid.
+var ErrMissingClass = errors.New("missing class discriminator")
+
+// EncodeHashableBlock encodes a serialized block into its hashable string representation,
+// corresponding to the HashableStringEncoder of the core module applied to the raw block.
+// The serialized block has to be given.
+// The hashable string is returned.
+func EncodeHashableBlock(serialized []byte) (string, error) {
+	return encodeHashable(rawBlockClass, serialized)
+}
+
+// EncodeHashableRecord encodes a serialized block record into its hashable string representation,
+// corresponding to the HashableStringEncoder of the core module applied to the raw block record.
+// The serialized record has to be given.
+// The hashable string is returned.
+func EncodeHashableRecord(serialized []byte) (string, error) {
+	return encodeHashable(rawBlockRecordClass, serialized)
+}
+
+// encodeHashable encodes a serialized hashable value.
+// Hashable values are encoded polymorphically, hence the serial name of the class comes first.
+// All non-null values are flattened out into a list separated by semicolons,
+// enums are encoded by their ordinal.
+// The serial name of the hashable class and the serialized value have to be given.
+func encodeHashable(class string, serialized []byte) (string, error) {
+	values := []string{class}
+	values, err := encodeObject(values, class, serialized)
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(values, hashableSeparator), nil
+}
+
+// encodeValue appends the encoded values of a serialized value.
+// The encoded values, the type and the serialized value have to be given.
+// The extended encoded values are returned.
+func encodeValue(values []string, typ *valueType, serialized json.RawMessage) ([]string, error) {
+	if isNull(serialized) {
+		return values, nil
+	}
+	switch typ.kind {
+	case primitiveKind:
+		return encodePrimitive(values, serialized)
+	case enumKind:
+		var constant string
+		if err := json.Unmarshal(serialized, &constant); err != nil {
+			return nil, err
+		}
+		return encodeEnum(values, typ, constant)
+	case objectKind:
+		return encodeObject(values, typ.class, serialized)
+	case polymorphicKind:
+		var discriminator struct {
+			Class string `json:"class"`
+		}
+		if err := json.Unmarshal(serialized, &discriminator); err != nil {
+			return nil, err
+		}
+		if len(discriminator.Class) == 0 {
+			return nil, ErrMissingClass
+		}
+		return encodeObject(append(values, discriminator.Class), discriminator.Class, serialized)
+	case listKind:
+		var elements []json.RawMessage
+		if err := json.Unmarshal(serialized, &elements); err != nil {
+			return nil, err
+		}
+		var err error
+		for _, element := range elements {
+			if values, err = encodeValue(values, typ.elem, element); err != nil {
+				return nil, err
+			}
+		}
+		return values, nil
+	}
+	return nil, fmt.Errorf("unsupported kind %d", typ.kind)
+}
+
+// encodePrimitive appends a serialized string, number or boolean.
+// The encoded values and the serialized primitive have to be given.
+func encodePrimitive(values []string, serialized json.RawMessage) ([]string, error) {
+	decoder := json.NewDecoder(bytes.NewReader(serialized))
+	decoder.UseNumber()
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch value := token.(type) {
+	case string:
+		return append(values, value), nil
+	case json.Number:
+		return append(values, value.String()), nil
+	case bool:
+		return append(values, fmt.Sprintf("%t", value)), nil
+	}
+	return nil, fmt.Errorf("expected primitive, got %s", serialized)
+}
+
+// encodeEnum appends the ordinal of an enum constant.
+// The encoded values, the enum type and the name of the constant have to be given.
+func encodeEnum(values []string, typ *valueType, constant string) ([]string, error) {
+	for ordinal, name := range typ.enum {
+		if name == constant {
+			return append(values, fmt.Sprintf("%d", ordinal)), nil
+		}
+	}
+	return nil, fmt.Errorf("unknown enum constant %s", constant)
+}
+
+// encodeObject appends the properties of a serialized object in declaration order.
+// Omitted properties with a default value are encoded using the default value.
+// The encoded values, the serial name of the class and the serialized object have to be given.
+func encodeObject(values []string, class string, serialized json.RawMessage) ([]string, error) {
+	fields, ok := classes[class]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownClass, class)
+	}
+	var properties map[string]json.RawMessage
+	if err := json.Unmarshal(serialized, &properties); err != nil {
+		return nil, err
+	}
+	var err error
+	for _, f := range fields {
+		property, present := properties[f.name]
+		if !present && len(f.fallback) > 0 {
+			values, err = encodeEnum(values, f.typ, f.fallback)
+		} else {
+			values, err = encodeValue(values, f.typ, property)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s.%s: %w", class, f.name, err)
+		}
+	}
+	return values, nil
+}
+
+// isNull checks whether a serialized value is absent or null.
+// The serialized value has to be given.
+func isNull(serialized json.RawMessage) bool {
+	trimmed := bytes.TrimSpace(serialized)
+	return len(trimmed) == 0 || bytes.Equal(trimmed, []byte("null"))
+}
+
+// Hash computes the SHA3-256 hash of a hashable string.
+// The hashable string has to be given.
+// The hex encoded hash is returned.
+func Hash(hashable string) string {
+	sum := sha3.Sum256([]byte(hashable))
+	return hex.EncodeToString(sum[:])
+}
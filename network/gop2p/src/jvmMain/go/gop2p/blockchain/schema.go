@@ -0,0 +1,184 @@
+/*
+ * Copyright (c) 2021 The biotopium Authors.
+ * This file is part of biotopium.
+ *
+ * biotopium is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * biotopium is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with biotopium.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package blockchain
+
+// kind represents how a value is encoded into the hashable string.
+type kind int
+
+const (
+	primitiveKind   kind = iota // string, number or boolean, encoded as its string representation
+	enumKind                    // enum, encoded by its ordinal
+	objectKind                  // object of a known class
+	polymorphicKind             // object of a class given by its class discriminator, prefixed by the serial name
+	listKind                    // list of values
+)
+
+// valueType describes the type of a serialized value.
+type valueType struct {
+	kind  kind       // kind of the value
+	enum  []string   // constants of an enum in declaration order
+	class string     // serial name of the class of an object
+	elem  *valueType // type of the elements of a list
+}
+
+// field describes a property of a serializable class.
+type field struct {
+	name     string     // name of the property
+	typ      *valueType // type of the property
+	fallback string     // enum constant of properties with a default value, which are omitted in JSON
+}
+
+// Types of values used by multiple classes.
+var (
+	primitive = &valueType{kind: primitiveKind}
+	content   = &valueType{kind: polymorphicKind}
+	records   = &valueType{kind: listKind, elem: &valueType{kind: polymorphicKind}}
+	tiles     = &valueType{kind: listKind, elem: &valueType{kind: polymorphicKind}}
+	plot      = &valueType{kind: objectKind, class: "Plot"}
+	hoe       = &valueType{kind: objectKind, class: "Hoe"}
+	seed      = &valueType{kind: objectKind, class: "Seed"}
+	seeds     = &valueType{kind: listKind, elem: seed}
+)
+
+// Enums of the core module, the constants are listed in declaration order.
+var (
+	actionType  = &valueType{kind: enumKind, enum: []string{"CHUNK_GENESIS", "INTRODUCTION", "CLAIM_REALM", "CREATE_PLOT", "SEED", "GROW", "HARVEST"}}
+	itemType    = &valueType{kind: enumKind, enum: []string{"HOE", "SEED", "REALM_CLAIM_PAPER", "PLANT"}}
+	tileType    = &valueType{kind: enumKind, enum: []string{"DEFAULT", "PLOT"}}
+	plantType   = &valueType{kind: enumKind, enum: []string{"WHEAT", "CORN"}}
+	plantGrowth = &valueType{kind: enumKind, enum: []string{"SEED", "HALF_GROWN", "GROWN"}}
+)
+
+// Serial names of the hashable classes.
+const (
+	rawBlockClass       = "RawBlock"
+	rawBlockRecordClass = "RawBlockRecord"
+)
+
+// classes maps the serial names of the serializable classes of the core module
+// to their properties in declaration order.
+// The schema has to be kept in sync with the core module, since the hashable encoding depends on it.
+// Both the schema and the core module are tested against testdata/block_schema.json.
+var classes = map[string][]field{
+	rawBlockClass: {
+		{name: "height", typ: primitive},
+		{name: "timestamp", typ: primitive},
+		{name: "prevHash", typ: primitive},
+		{name: "author", typ: primitive},
+		{name: "data", typ: records},
+	},
+	rawBlockRecordClass: {
+		{name: "timestamp", typ: primitive},
+		{name: "author", typ: primitive},
+		{name: "content", typ: content},
+	},
+	"ActionRecord": {
+		{name: "timestamp", typ: primitive},
+		{name: "author", typ: primitive},
+		{name: "content", typ: content},
+		{name: "hash", typ: primitive},
+		{name: "sign", typ: primitive},
+	},
+
+	// actions
+	"ChunkGenesisAction": {
+		{name: "produce", typ: tiles},
+		{name: "type", typ: actionType, fallback: "CHUNK_GENESIS"},
+	},
+	"IntroductionAction": {
+		{name: "produce", typ: &valueType{kind: objectKind, class: "IntroductionGift"}},
+		{name: "type", typ: actionType, fallback: "INTRODUCTION"},
+	},
+	"ClaimRealmAction": {
+		{name: "produce", typ: &valueType{kind: objectKind, class: "Realm"}},
+		{name: "consume", typ: &valueType{kind: objectKind, class: "RealmClaimPaper"}},
+		{name: "type", typ: actionType, fallback: "CLAIM_REALM"},
+	},
+	"CreatePlotAction": {
+		{name: "produce", typ: plot},
+		{name: "consume", typ: hoe},
+		{name: "type", typ: actionType, fallback: "CREATE_PLOT"},
+	},
+	"SeedAction": {
+		{name: "produce", typ: plot},
+		{name: "consume", typ: seed},
+		{name: "type", typ: actionType, fallback: "SEED"},
+	},
+	"GrowAction": {
+		{name: "produce", typ: plot},
+		{name: "type", typ: actionType, fallback: "GROW"},
+	},
+	"HarvestAction": {
+		{name: "produce", typ: &valueType{kind: objectKind, class: "Harvest"}},
+		{name: "consume", typ: plot},
+		{name: "type", typ: actionType, fallback: "HARVEST"},
+	},
+
+	// items
+	"Hoe": {
+		{name: "owner", typ: primitive},
+		{name: "type", typ: itemType, fallback: "HOE"},
+	},
+	"Seed": {
+		{name: "owner", typ: primitive},
+		{name: "plantType", typ: plantType},
+		{name: "type", typ: itemType, fallback: "SEED"},
+	},
+	"RealmClaimPaper": {
+		{name: "owner", typ: primitive},
+		{name: "type", typ: itemType, fallback: "REALM_CLAIM_PAPER"},
+	},
+	"HarvestedPlant": {
+		{name: "owner", typ: primitive},
+		{name: "plantType", typ: plantType},
+		{name: "type", typ: itemType, fallback: "PLANT"},
+	},
+	"Harvest": {
+		{name: "plant", typ: &valueType{kind: objectKind, class: "HarvestedPlant"}},
+		{name: "seeds", typ: seeds},
+	},
+	"IntroductionGift": {
+		{name: "realmClaimPaper", typ: &valueType{kind: objectKind, class: "RealmClaimPaper"}},
+		{name: "hoes", typ: &valueType{kind: listKind, elem: hoe}},
+		{name: "seeds", typ: seeds},
+	},
+
+	// map
+	"DefaultTile": {
+		{name: "x", typ: primitive},
+		{name: "y", typ: primitive},
+		{name: "type", typ: tileType, fallback: "DEFAULT"},
+	},
+	"Plot": {
+		{name: "x", typ: primitive},
+		{name: "y", typ: primitive},
+		{name: "plant", typ: &valueType{kind: objectKind, class: "GrowingPlant"}},
+		{name: "type", typ: tileType, fallback: "PLOT"},
+	},
+	"Realm": {
+		{name: "owner", typ: primitive},
+		{name: "ix", typ: primitive},
+		{name: "iy", typ: primitive},
+	},
+	"GrowingPlant": {
+		{name: "owner", typ: primitive},
+		{name: "type", typ: plantType},
+		{name: "growth", typ: plantGrowth},
+	},
+}
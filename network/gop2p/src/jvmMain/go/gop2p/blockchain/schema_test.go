@@ -0,0 +1,85 @@
+/*
+ * Copyright (c) 2021 The biotopium Authors.
+ * This file is part of biotopium.
+ *
+ * biotopium is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * biotopium is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with biotopium.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package blockchain
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+// blockSchema represents the serializable classes and enums of the core module.
+// The core module tests its model against the same file, which keeps both encodings in sync.
+type blockSchema struct {
+	Classes map[string][]string `json:"classes"`
+	Enums   map[string][]string `json:"enums"`
+}
+
+// schemaEnums maps the enum names of the core module to the enums of the schema.
+var schemaEnums = map[string]*valueType{
+	"ActionType":  actionType,
+	"ItemType":    itemType,
+	"TileType":    tileType,
+	"PlantType":   plantType,
+	"PlantGrowth": plantGrowth,
+}
+
+func TestSchemaMatchesCoreModel(t *testing.T) {
+	content, err := ioutil.ReadFile("testdata/block_schema.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema := &blockSchema{}
+	if err := json.Unmarshal(content, schema); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(classes) != len(schema.Classes) {
+		t.Errorf("expected %d classes, got %d", len(schema.Classes), len(classes))
+	}
+	for name, expected := range schema.Classes {
+		fields, ok := classes[name]
+		if !ok {
+			t.Errorf("missing class %s", name)
+			continue
+		}
+		var names []string
+		for _, f := range fields {
+			names = append(names, f.name)
+		}
+		if !reflect.DeepEqual(names, expected) {
+			t.Errorf("%s: expected properties %v, got %v", name, expected, names)
+		}
+	}
+
+	if len(schemaEnums) != len(schema.Enums) {
+		t.Errorf("expected %d enums, got %d", len(schema.Enums), len(schemaEnums))
+	}
+	for name, expected := range schema.Enums {
+		enum, ok := schemaEnums[name]
+		if !ok {
+			t.Errorf("missing enum %s", name)
+			continue
+		}
+		if !reflect.DeepEqual(enum.enum, expected) {
+			t.Errorf("%s: expected constants %v, got %v", name, expected, enum.enum)
+		}
+	}
+}
@@ -0,0 +1,243 @@
+/*
+ * Copyright (c) 2021 The biotopium Authors.
+ * This file is part of biotopium.
+ *
+ * biotopium is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * biotopium is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with biotopium.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package blockchain
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"sync"
+)
+
+// entryHeaderSize is the size of the header of a store entry: payload length and CRC32 checksum.
+const entryHeaderSize = 8
+
+// maxEntrySize is the maximum size of a serialized block in the store.
+const maxEntrySize = 64 << 20
+
+// Errors of the block store.
+var (
+	ErrHeightGap     = errors.New("block height does not follow the stored chain")
+	ErrPrevHash      = errors.New("previous hash does not match the stored chain")
+	ErrConflict      = errors.New("different block already stored at this height")
+	ErrBlockNotFound = errors.New("block not found")
+)
+
+// Store is an append-only, crash-safe block store backed by a single file.
+// Each entry consists of the payload length, the CRC32 checksum of the payload and the serialized block.
+// Incomplete or corrupted entries at the end of the file, e.g. after a crash, are truncated on opening.
+type Store struct {
+	mutex   sync.RWMutex
+	file    *os.File       // store file
+	offsets []int64        // entry offsets indexed by height
+	hashes  []string       // block hashes indexed by height
+	heights map[string]int // heights indexed by block hash
+	size    int64          // size of the valid part of the file
+}
+
+// OpenStore opens a block store, the file is created if it does not exist.
+// The file path has to be given.
+// A pointer to the opened store is returned.
+func OpenStore(path string) (*Store, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	store := &Store{
+		file:    file,
+		heights: make(map[string]int),
+	}
+	if err := store.recover(); err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	return store, nil
+}
+
+// recover rebuilds the index by scanning the store file.
+// The file is truncated after the last valid entry.
+func (s *Store) recover() error {
+	reader := bufio.NewReader(s.file)
+	var offset int64
+	for {
+		payload, err := readEntry(reader)
+		if err != nil {
+			break
+		}
+		block, err := DecodeBlock(payload)
+		if err != nil || block.Height != uint64(len(s.offsets)) {
+			break
+		}
+		s.index(block, offset)
+		offset += int64(entryHeaderSize + len(payload))
+	}
+	s.size = offset
+	if err := s.file.Truncate(offset); err != nil {
+		return err
+	}
+	_, err := s.file.Seek(offset, io.SeekStart)
+	return err
+}
+
+// readEntry reads and verifies the next entry.
+// A reader has to be given.
+// The payload of the entry is returned.
+func readEntry(reader io.Reader) ([]byte, error) {
+	header := make([]byte, entryHeaderSize)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return nil, err
+	}
+	length := binary.BigEndian.Uint32(header[:4])
+	checksum := binary.BigEndian.Uint32(header[4:])
+	if length > maxEntrySize {
+		return nil, fmt.Errorf("entry too large: %d", length)
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(reader, payload); err != nil {
+		return nil, err
+	}
+	if crc32.ChecksumIEEE(payload) != checksum {
+		return nil, errors.New("entry checksum mismatch")
+	}
+	return payload, nil
+}
+
+// index adds a block to the index.
+// The block and the offset of its entry have to be given.
+func (s *Store) index(block *Block, offset int64) {
+	s.offsets = append(s.offsets, offset)
+	s.hashes = append(s.hashes, block.Hash)
+	s.heights[block.Hash] = int(block.Height)
+}
+
+// Append appends a block to the store.
+// Blocks already stored are ignored.
+// The block has to follow the stored chain and must be validated beforehand.
+func (s *Store) Append(block *Block) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	next := uint64(len(s.offsets))
+	if block.Height < next {
+		if s.hashes[block.Height] == block.Hash {
+			return nil
+		}
+		return ErrConflict
+	}
+	if block.Height > next {
+		return ErrHeightGap
+	}
+	if next > 0 && block.PrevHash != s.hashes[next-1] {
+		return ErrPrevHash
+	}
+
+	payload := block.Raw()
+	entry := make([]byte, entryHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(entry[:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(entry[4:8], crc32.ChecksumIEEE(payload))
+	copy(entry[entryHeaderSize:], payload)
+	if _, err := s.file.WriteAt(entry, s.size); err != nil {
+		return err
+	}
+	if err := s.file.Sync(); err != nil {
+		return err
+	}
+	s.index(block, s.size)
+	s.size += int64(len(entry))
+	return nil
+}
+
+// Height returns the number of stored blocks, which is the height of the next block.
+func (s *Store) Height() uint64 {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return uint64(len(s.offsets))
+}
+
+// Get reads the serialized block at a height.
+// The height has to be given.
+// The serialized block is returned.
+func (s *Store) Get(height uint64) ([]byte, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.get(height)
+}
+
+// get reads the serialized block at a height, the lock has to be held.
+// The height has to be given.
+func (s *Store) get(height uint64) ([]byte, error) {
+	if height >= uint64(len(s.offsets)) {
+		return nil, ErrBlockNotFound
+	}
+	reader := io.NewSectionReader(s.file, s.offsets[height], s.size-s.offsets[height])
+	return readEntry(reader)
+}
+
+// GetByHash reads the serialized block with a hash.
+// The hash has to be given.
+// The serialized block is returned.
+func (s *Store) GetByHash(hash string) ([]byte, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	height, ok := s.heights[hash]
+	if !ok {
+		return nil, ErrBlockNotFound
+	}
+	return s.get(uint64(height))
+}
+
+// HeightOf returns the height of the block with a hash.
+// The hash has to be given.
+// The height and whether the block is stored are returned.
+func (s *Store) HeightOf(hash string) (uint64, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	height, ok := s.heights[hash]
+	return uint64(height), ok
+}
+
+// Range reads the serialized blocks within a height range.
+// The range is cut off at the end of the stored chain.
+// The last height must be lower than the maximum uint64 value.
+// The first and the last height (inclusive) have to be given.
+// The serialized blocks are returned.
+func (s *Store) Range(from uint64, to uint64) ([][]byte, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	var blocks [][]byte
+	for height := from; height <= to && height < uint64(len(s.offsets)); height++ {
+		block, err := s.get(height)
+		if err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, block)
+	}
+	return blocks, nil
+}
+
+// Close closes the store.
+func (s *Store) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.file.Close()
+}
@@ -0,0 +1,133 @@
+/*
+ * Copyright (c) 2021 The biotopium Authors.
+ * This file is part of biotopium.
+ *
+ * biotopium is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * biotopium is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with biotopium.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package blockchain
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testBlock creates a block with a given height, hash and previous hash.
+func testBlock(t *testing.T, height uint64, hash string, prevHash string) *Block {
+	serialized := fmt.Sprintf(`{"height":%d,"timestamp":%d,"prevHash":"%s","author":"a","data":[],"hash":"%s","sign":"s"}`, height, height, prevHash, hash)
+	block, err := DecodeBlock([]byte(serialized))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return block
+}
+
+// openTestStore opens a store containing a chain of the given length.
+func openTestStore(t *testing.T, path string, length int) *Store {
+	store, err := OpenStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for height := 0; height < length; height++ {
+		block := testBlock(t, uint64(height), fmt.Sprintf("h%d", height), fmt.Sprintf("h%d", height-1))
+		if height == 0 {
+			block = testBlock(t, 0, "h0", "")
+		}
+		if err := store.Append(block); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return store
+}
+
+func TestStoreAppendAndRead(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocks")
+	store := openTestStore(t, path, 3)
+	defer store.Close()
+
+	if height := store.Height(); height != 3 {
+		t.Errorf("expected height 3, got %d", height)
+	}
+	block, err := store.GetByHash("h1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded, _ := DecodeBlock(block); decoded.Height != 1 {
+		t.Errorf("expected block 1, got %d", decoded.Height)
+	}
+	blocks, err := store.Range(1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 2 {
+		t.Errorf("expected 2 blocks, got %d", len(blocks))
+	}
+	if _, err := store.Get(3); !errors.Is(err, ErrBlockNotFound) {
+		t.Errorf("expected %v, got %v", ErrBlockNotFound, err)
+	}
+}
+
+func TestStoreAppendRules(t *testing.T) {
+	store := openTestStore(t, filepath.Join(t.TempDir(), "blocks"), 2)
+	defer store.Close()
+
+	if err := store.Append(testBlock(t, 1, "h1", "h0")); err != nil {
+		t.Errorf("expected stored block to be ignored, got %v", err)
+	}
+	if err := store.Append(testBlock(t, 1, "other", "h0")); !errors.Is(err, ErrConflict) {
+		t.Errorf("expected %v, got %v", ErrConflict, err)
+	}
+	if err := store.Append(testBlock(t, 3, "h3", "h2")); !errors.Is(err, ErrHeightGap) {
+		t.Errorf("expected %v, got %v", ErrHeightGap, err)
+	}
+	if err := store.Append(testBlock(t, 2, "h2", "other")); !errors.Is(err, ErrPrevHash) {
+		t.Errorf("expected %v, got %v", ErrPrevHash, err)
+	}
+}
+
+func TestStoreRecovery(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocks")
+	store := openTestStore(t, path, 3)
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// simulate a crash while writing an entry
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := file.Write([]byte{0, 0, 1, 0, 1, 2}); err != nil {
+		t.Fatal(err)
+	}
+	_ = file.Close()
+
+	store, err = OpenStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if height := store.Height(); height != 3 {
+		t.Errorf("expected height 3 after recovery, got %d", height)
+	}
+	if err := store.Append(testBlock(t, 3, "h3", "h2")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Get(3); err != nil {
+		t.Errorf("expected block appended after recovery, got %v", err)
+	}
+}
@@ -0,0 +1,109 @@
+/*
+ * Copyright (c) 2021 The biotopium Authors.
+ * This file is part of biotopium.
+ *
+ * biotopium is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * biotopium is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with biotopium.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package blockchain
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+)
+
+// Errors of violated block rules.
+var (
+	ErrInvalidHash      = errors.New("invalid hash")
+	ErrInvalidSignature = errors.New("invalid signature")
+	ErrUntrustedAuthor  = errors.New("untrusted author")
+)
+
+// TrustPolicy decides whether the author of a block is a trusted blocklord.
+// The address of the author is given.
+type TrustPolicy func(author string) bool
+
+// Validator validates blocks according to the general block rules of the BlockValidator.
+type Validator struct {
+	isTrusted TrustPolicy // trust policy for block authors
+}
+
+// NewValidator is the factory function of the Validator struct.
+// A trust policy can be given, if it is nil, all authors are trusted.
+// A pointer to a new validator is returned.
+func NewValidator(isTrusted TrustPolicy) *Validator {
+	return &Validator{
+		isTrusted: isTrusted,
+	}
+}
+
+// ValidateBlock checks the general block rules:
+// the hash of the block and of each record has to match its content,
+// the block and each record have to be signed by their authors
+// and the author of the block has to be a trusted blocklord.
+// The block has to be given.
+// An error wrapping the violated rule is returned.
+func (v *Validator) ValidateBlock(block *Block) error {
+	hashable, err := EncodeHashableBlock(block.Raw())
+	if err != nil {
+		return fmt.Errorf("block %d: %w", block.Height, err)
+	}
+	if err := verifyHashed(hashable, block.Hash, block.Author, block.Sign); err != nil {
+		return fmt.Errorf("block %d: %w", block.Height, err)
+	}
+	for i, record := range block.Data {
+		if err := ValidateRecord(record); err != nil {
+			return fmt.Errorf("block %d, record %d: %w", block.Height, i, err)
+		}
+	}
+	if v.isTrusted != nil && !v.isTrusted(block.Author) {
+		return fmt.Errorf("block %d: %w: %s", block.Height, ErrUntrustedAuthor, block.Author)
+	}
+	return nil
+}
+
+// ValidateRecord checks the hash and the signature of a record, e.g. of a requested action.
+// The hash of the record has to match its content and the record has to be signed by its author.
+// The record has to be given.
+// An error wrapping the violated rule is returned.
+func ValidateRecord(record *Record) error {
+	hashable, err := EncodeHashableRecord(record.Raw())
+	if err != nil {
+		return err
+	}
+	return verifyHashed(hashable, record.Hash, record.Author, record.Sign)
+}
+
+// verifyHashed verifies the hash and the signature of a hashed value.
+// As in the core module, the signature covers the hex encoded hash.
+// The hashable string of the value, its hash, the address of its author and its signature have to be given.
+func verifyHashed(hashable string, hash string, author string, sign string) error {
+	if Hash(hashable) != hash {
+		return ErrInvalidHash
+	}
+	publicKey, err := base64.StdEncoding.DecodeString(author)
+	if err != nil || len(publicKey) != ed25519.PublicKeySize {
+		return fmt.Errorf("%w: malformed author address", ErrInvalidSignature)
+	}
+	signature, err := base64.StdEncoding.DecodeString(sign)
+	if err != nil {
+		return fmt.Errorf("%w: malformed signature", ErrInvalidSignature)
+	}
+	if !ed25519.Verify(publicKey, []byte(hash), signature) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+/*
+ * Copyright (c) 2021 The biotopium Authors.
+ * This file is part of biotopium.
+ *
+ * biotopium is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * biotopium is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with biotopium.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package blockchain
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"testing"
+)
+
+// blockVectors represents the block validation test vectors.
+// The records and hashable strings are taken from the HashableStringEncoderTest of the core module,
+// which validates the same vectors in its BlockValidatorVectorTest.
+type blockVectors struct {
+	TrustedAuthors []string `json:"trustedAuthors"`
+	Vectors        []struct {
+		Name     string          `json:"name"`
+		Block    json.RawMessage `json:"block"`
+		Hashable string          `json:"hashable"`
+		Error    string          `json:"error"`
+	} `json:"vectors"`
+}
+
+// vectorErrors maps the error names of the test vectors to the block rule errors.
+var vectorErrors = map[string]error{
+	"invalid hash":      ErrInvalidHash,
+	"invalid signature": ErrInvalidSignature,
+	"untrusted author":  ErrUntrustedAuthor,
+	"unknown class":     ErrUnknownClass,
+}
+
+func loadBlockVectors(t *testing.T) *blockVectors {
+	content, err := ioutil.ReadFile("testdata/block_vectors.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	vectors := &blockVectors{}
+	if err := json.Unmarshal(content, vectors); err != nil {
+		t.Fatal(err)
+	}
+	return vectors
+}
+
+func TestValidateBlockVectors(t *testing.T) {
+	vectors := loadBlockVectors(t)
+	trusted := make(map[string]bool)
+	for _, author := range vectors.TrustedAuthors {
+		trusted[author] = true
+	}
+	validator := NewValidator(func(author string) bool {
+		return trusted[author]
+	})
+
+	for _, vector := range vectors.Vectors {
+		t.Run(vector.Name, func(t *testing.T) {
+			block, err := DecodeBlock(vector.Block)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = validator.ValidateBlock(block)
+			if len(vector.Error) == 0 {
+				if err != nil {
+					t.Errorf("expected valid block, got %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, vectorErrors[vector.Error]) {
+				t.Errorf("expected %s, got %v", vector.Error, err)
+			}
+		})
+	}
+}
+
+func TestEncodeHashableVectors(t *testing.T) {
+	vectors := loadBlockVectors(t)
+	for _, vector := range vectors.Vectors {
+		if len(vector.Hashable) == 0 {
+			continue
+		}
+		hashable, err := EncodeHashableBlock(vector.Block)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hashable != vector.Hashable {
+			t.Errorf("%s: expected hashable %q, got %q", vector.Name, vector.Hashable, hashable)
+		}
+	}
+}
+
+func TestEncodeHashableRecord(t *testing.T) {
+	serialized := []byte(`{"class":"ActionRecord","timestamp":5,"author":"me","content":{"class":"SeedAction","produce":{"x":1,"y":0,"plant":{"owner":"me","type":"CORN","growth":"GROWN"}},"consume":{"owner":"me","plantType":"CORN","type":"SEED"}},"hash":"ab","sign":"cd"}`)
+	hashable, err := EncodeHashableRecord(serialized)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "RawBlockRecord;5;me;SeedAction;1;0;me;1;2;1;me;1;1;4"
+	if hashable != expected {
+		t.Errorf("expected %q, got %q", expected, hashable)
+	}
+}
+
+func TestEncodeHashableUnknownClass(t *testing.T) {
+	serialized := []byte(`{"timestamp":5,"author":"me","content":{"class":"UnknownAction"}}`)
+	if _, err := EncodeHashableRecord(serialized); !errors.Is(err, ErrUnknownClass) {
+		t.Errorf("expected %v, got %v", ErrUnknownClass, err)
+	}
+}
+
+func TestEncodeHashableMissingClass(t *testing.T) {
+	serialized := []byte(`{"timestamp":5,"author":"me","content":{"produce":{"x":1,"y":0}}}`)
+	if _, err := EncodeHashableRecord(serialized); !errors.Is(err, ErrMissingClass) || errors.Is(err, ErrUnknownClass) {
+		t.Errorf("expected %v, got %v", ErrMissingClass, err)
+	}
+}
+
+func TestValidateBlockWithoutTrustPolicy(t *testing.T) {
+	vectors := loadBlockVectors(t)
+	validator := NewValidator(nil)
+	for _, vector := range vectors.Vectors {
+		if vector.Error != "untrusted author" {
+			continue
+		}
+		block, err := DecodeBlock(vector.Block)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := validator.ValidateBlock(block); err != nil {
+			t.Errorf("expected all authors to be trusted, got %v", err)
+		}
+	}
+}
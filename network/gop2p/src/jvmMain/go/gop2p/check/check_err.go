@@ -18,13 +18,17 @@
 
 package check
 
-import "log"
+import logging "github.com/ipfs/go-log/v2"
+
+// logger logs within the logging subsystem of the p2p package,
+// hence fatal errors are formatted, leveled and forwarded like all other log records.
+var logger = logging.Logger("gop2p")
 
 // Err checks if an error occurred.
 // An error has to be given.
 // This functions logs fatally if the error is not nil.
 func Err(err error) {
 	if err != nil {
-		log.Fatal(err)
+		logger.Fatalw("Unrecoverable error", "error", err)
 	}
 }
\ No newline at end of file
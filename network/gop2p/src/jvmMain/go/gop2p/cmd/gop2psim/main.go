@@ -0,0 +1,89 @@
+/*
+ * Copyright (c) 2021 The biotopium Authors.
+ * This file is part of biotopium.
+ *
+ * biotopium is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * biotopium is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with biotopium.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+// Command gop2psim simulates a network of one blocklord and many clients on in-memory links.
+// It runs a scripted scenario with latency, message loss, partitions and restarts
+// and reports the delivery latency and loss per message type.
+//
+// Without a scenario file, the default scenario is run. A scenario file looks like:
+//
+//	{
+//	  "clients": 20, "durationMillis": 60000, "drainMillis": 5000,
+//	  "blockIntervalMillis": 2000, "actionIntervalMillis": 1000,
+//	  "latencyMillis": 50, "loss": 0.02, "seed": 1,
+//	  "events": [
+//	    {"atMillis": 10000, "type": "partition", "clients": [0, 1, 2, 3]},
+//	    {"atMillis": 20000, "type": "heal"},
+//	    {"atMillis": 30000, "type": "restart", "clients": [5], "downtimeMillis": 5000},
+//	    {"atMillis": 40000, "type": "conditions", "latencyMillis": 250, "loss": 0.1}
+//	  ]
+//	}
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"riesenacht.ch/biotopium/network/gop2p/internal/simulation"
+	"riesenacht.ch/biotopium/network/gop2p/p2p"
+	"text/tabwriter"
+)
+
+func main() {
+	scenarioPath := flag.String("scenario", "", "path of the scenario file, the default scenario is run if empty")
+	asJSON := flag.Bool("json", false, "print the report as JSON")
+	logLevel := flag.String("log-level", "error", "log level of the simulated nodes")
+	flag.Parse()
+
+	if err := p2p.SetLogLevel(*logLevel); err != nil {
+		log.Fatalln(err)
+	}
+	scenario := simulation.DefaultScenario()
+	if len(*scenarioPath) > 0 {
+		var err error
+		scenario, err = simulation.LoadScenario(*scenarioPath)
+		if err != nil {
+			log.Fatalln(err)
+		}
+	}
+
+	report, err := simulation.Simulate(scenario)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			log.Fatalln(err)
+		}
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "type\tsent\tfailed\texpected\tdelivered\tlost\tloss\tmin ms\tavg ms\tp50 ms\tp95 ms\tmax ms\t")
+	for _, s := range report {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%d\t%.1f%%\t%.1f\t%.1f\t%.1f\t%.1f\t%.1f\t\n",
+			s.MessageType, s.Sent, s.Failed, s.Expected, s.Delivered, s.Lost, 100*s.LossRate, s.Min, s.Avg, s.P50, s.P95, s.Max)
+	}
+	if err := w.Flush(); err != nil {
+		log.Fatalln(err)
+	}
+}
@@ -0,0 +1,66 @@
+/*
+ * Copyright (c) 2021 The biotopium Authors.
+ * This file is part of biotopium.
+ *
+ * biotopium is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * biotopium is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with biotopium.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+//#include <stdlib.h>
+//#include "error.h"
+import "C"
+import (
+	"errors"
+	"riesenacht.ch/biotopium/network/gop2p/p2p"
+	"unsafe"
+)
+
+// Error codes identifying the kind of an error.
+const (
+	errorCodeGeneric            = 1 // error without specific kind
+	errorCodeAddressUnreachable = 2 // address could not be resolved or reached
+)
+
+// setError stores the message and the code of an error in the error of a call.
+// The message has to be released by the caller using FreeError.
+// The error of the call allocated by the caller (nil if not of interest) and an error have to be given.
+func setError(errPtr *C.gop2p_error, err error) {
+	if errPtr == nil {
+		return
+	}
+	errPtr.message = C.CString(err.Error())
+	errPtr.code = C.int(errorCode(err))
+}
+
+// errorCode determines the code of an error.
+// An error has to be given.
+func errorCode(err error) int {
+	var unreachable *p2p.AddressUnreachableError
+	if errors.As(err, &unreachable) {
+		return errorCodeAddressUnreachable
+	}
+	return errorCodeGeneric
+}
+
+// FreeError releases the message of the error of a call.
+// The error of the call has to be given.
+//export FreeError
+func FreeError(errPtr *C.gop2p_error) {
+	if errPtr == nil || errPtr.message == nil {
+		return
+	}
+	C.free(unsafe.Pointer(errPtr.message))
+	errPtr.message = nil
+}
@@ -0,0 +1,29 @@
+/*
+ * Copyright (c) 2021 The biotopium Authors.
+ * This file is part of biotopium.
+ *
+ * biotopium is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * biotopium is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with biotopium.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+#ifndef GOP2P_ERROR_H
+#define GOP2P_ERROR_H
+
+// gop2p_error receives the error of a call of an exported function.
+// It is allocated and zeroed by the caller, the message stays NULL if no error occurred.
+typedef struct {
+    char *message; // message of the error, released using FreeError
+    int code;      // code identifying the kind of the error
+} gop2p_error;
+
+#endif
@@ -3,10 +3,15 @@ module riesenacht.ch/biotopium/network/gop2p
 go 1.16
 
 require (
+	github.com/ipfs/go-log/v2 v2.1.3
 	github.com/libp2p/go-libp2p v0.14.4
+	github.com/libp2p/go-libp2p-circuit v0.4.0
 	github.com/libp2p/go-libp2p-core v0.8.6
 	github.com/libp2p/go-libp2p-kad-dht v0.13.0
 	github.com/libp2p/go-libp2p-noise v0.2.0
 	github.com/libp2p/go-libp2p-pubsub v0.5.3
+	github.com/libp2p/go-libp2p-record v0.1.3
 	github.com/multiformats/go-multiaddr v0.3.3
+	github.com/prometheus/client_golang v1.10.0
+	golang.org/x/crypto v0.0.0-20210506145944-38f3c27a63bf
 )
@@ -0,0 +1,263 @@
+/*
+ * Copyright (c) 2021 The biotopium Authors.
+ * This file is part of biotopium.
+ *
+ * biotopium is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * biotopium is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with biotopium.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+// Package simnet provides an in-memory network of libp2p hosts with simulated link conditions.
+// It is used by the tests and the network simulation, hence it is not part of the shared library.
+package simnet
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/protocol"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	pb "github.com/libp2p/go-libp2p-pubsub/pb"
+	mock "github.com/libp2p/go-libp2p/p2p/net/mock"
+	maddr "github.com/multiformats/go-multiaddr"
+	"io"
+	"math/rand"
+	"sync"
+)
+
+// basePort is the port of the first host of a network, following hosts get increasing ports.
+const basePort = 4000
+
+// Network represents an in-memory network of hosts connected by mocknet links.
+// The links apply latency and bandwidth limits, received messages are lost with a given probability.
+type Network struct {
+	mn mock.Mocknet
+
+	mutex sync.Mutex
+	loss  float64    // probability of losing a received message
+	rng   *rand.Rand // source of the message losses
+	port  int        // port of the next host
+}
+
+// New is the factory function of the Network struct.
+// The link options, the probability of losing a received message and the seed of the losses have to be given.
+// A pointer to a new empty network is returned.
+func New(link mock.LinkOptions, loss float64, seed int64) *Network {
+	mn := mock.New(context.Background())
+	mn.SetLinkDefaults(link)
+	return &Network{
+		mn:   mn,
+		loss: loss,
+		rng:  rand.New(rand.NewSource(seed)),
+		port: basePort,
+	}
+}
+
+// NewHost creates a mocknet host linked to all hosts of the network.
+// The identity key and the routing of the libp2p options are applied, transport options are ignored.
+// A host with the same identity key as a stopped host replaces it.
+// The context and the libp2p options have to be given.
+// The host losing received messages is returned.
+func (n *Network) NewHost(_ context.Context, options ...libp2p.Option) (host.Host, error) {
+	cfg := &libp2p.Config{}
+	if err := cfg.Apply(options...); err != nil {
+		return nil, err
+	}
+	n.mutex.Lock()
+	addr, err := maddr.NewMultiaddr(fmt.Sprintf("/ip4/127.0.0.1/tcp/%d", n.port))
+	n.port++
+	n.mutex.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	h, err := n.mn.AddPeer(cfg.PeerKey, addr)
+	if err != nil {
+		return nil, err
+	}
+	for _, other := range n.mn.Peers() {
+		if other == h.ID() {
+			continue
+		}
+		if _, err := n.mn.LinkPeers(h.ID(), other); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.Routing != nil {
+		if _, err := cfg.Routing(h); err != nil {
+			return nil, err
+		}
+	}
+	return &lossyHost{Host: h, lose: n.lose}, nil
+}
+
+// SetConditions changes the link options and the probability of losing a received message.
+// Existing links are changed as well.
+// The link options and the probability of losing a received message have to be given.
+func (n *Network) SetConditions(link mock.LinkOptions, loss float64) {
+	n.mn.SetLinkDefaults(link)
+	for _, byPeer := range n.mn.Links() {
+		for _, links := range byPeer {
+			for l := range links {
+				l.SetOptions(link)
+			}
+		}
+	}
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.loss = loss
+}
+
+// lose decides whether a received message is lost.
+func (n *Network) lose() bool {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	return n.loss > 0 && n.rng.Float64() < n.loss
+}
+
+// Isolate removes the links of a peer to all other peers.
+// The peer ID has to be given.
+func (n *Network) Isolate(peerID peer.ID) {
+	for _, other := range n.mn.Peers() {
+		if other != peerID {
+			_ = n.mn.UnlinkPeers(peerID, other)
+		}
+	}
+}
+
+// Partition separates two groups of peers by removing the links between them and closing their connections.
+// The peer IDs of both groups have to be given.
+func (n *Network) Partition(group []peer.ID, others []peer.ID) {
+	for _, a := range group {
+		for _, b := range others {
+			_ = n.mn.UnlinkPeers(a, b)
+			_ = n.mn.DisconnectPeers(a, b)
+		}
+	}
+}
+
+// ConnectAll links and connects all given peers to each other.
+// The peer IDs have to be given.
+// The first error encountered is returned.
+func (n *Network) ConnectAll(peerIDs []peer.ID) error {
+	for i, a := range peerIDs {
+		for _, b := range peerIDs[i+1:] {
+			if len(n.mn.LinksBetweenPeers(a, b)) == 0 {
+				if _, err := n.mn.LinkPeers(a, b); err != nil {
+					return err
+				}
+			}
+			if n.mn.Net(a).Connectedness(b) == network.Connected {
+				continue
+			}
+			if _, err := n.mn.ConnectPeers(a, b); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// lossyHost wraps a host, losing received pubsub messages and direct streams.
+type lossyHost struct {
+	host.Host
+	lose func() bool // decides whether a received message is lost
+}
+
+// SetStreamHandler sets the protocol handler on the host's mux, wrapped to lose received messages.
+func (h *lossyHost) SetStreamHandler(pid protocol.ID, handler network.StreamHandler) {
+	h.Host.SetStreamHandler(pid, h.wrap(pid, handler))
+}
+
+// SetStreamHandlerMatch sets the protocol handler on the host's mux using a matching function,
+// wrapped to lose received messages.
+func (h *lossyHost) SetStreamHandlerMatch(pid protocol.ID, match func(string) bool, handler network.StreamHandler) {
+	h.Host.SetStreamHandlerMatch(pid, match, h.wrap(pid, handler))
+}
+
+// wrap wraps a stream handler to lose received messages.
+// The RPCs of pubsub streams lose single messages, control messages and subscriptions are kept.
+// Streams of other protocols carry a single message, they are lost entirely by resetting them.
+// The protocol ID and the handler have to be given.
+func (h *lossyHost) wrap(pid protocol.ID, handler network.StreamHandler) network.StreamHandler {
+	switch pid {
+	case pubsub.GossipSubID_v11, pubsub.GossipSubID_v10, pubsub.FloodSubID:
+		return func(s network.Stream) {
+			handler(&lossyStream{Stream: s, reader: bufio.NewReader(s), lose: h.lose})
+		}
+	}
+	return func(s network.Stream) {
+		if h.lose() {
+			_ = s.Reset()
+			return
+		}
+		handler(s)
+	}
+}
+
+// lossyStream wraps a pubsub stream, losing the messages of received RPCs.
+type lossyStream struct {
+	network.Stream
+	reader  *bufio.Reader // reader of the length-delimited RPCs
+	pending []byte        // remainder of the current RPC
+	lose    func() bool   // decides whether a received message is lost
+}
+
+// Read reads the length-delimited RPCs of the stream, without the lost messages.
+// RPCs exceeding the maximum pubsub message size are rejected before they are buffered, as pubsub does.
+func (s *lossyStream) Read(p []byte) (int, error) {
+	for len(s.pending) == 0 {
+		size, err := binary.ReadUvarint(s.reader)
+		if err != nil {
+			return 0, err
+		}
+		if size > pubsub.DefaultMaxMessageSize {
+			return 0, fmt.Errorf("RPC of %d bytes exceeds the maximum message size", size)
+		}
+		frame := make([]byte, size)
+		if _, err := io.ReadFull(s.reader, frame); err != nil {
+			return 0, err
+		}
+		s.pending = s.filter(frame)
+	}
+	n := copy(p, s.pending)
+	s.pending = s.pending[n:]
+	return n, nil
+}
+
+// filter removes the lost messages of an RPC.
+// The encoded RPC has to be given.
+// The length-delimited RPC is returned.
+func (s *lossyStream) filter(frame []byte) []byte {
+	rpc := &pb.RPC{}
+	if err := rpc.Unmarshal(frame); err == nil {
+		kept := rpc.Publish[:0]
+		for _, msg := range rpc.Publish {
+			if !s.lose() {
+				kept = append(kept, msg)
+			}
+		}
+		if len(kept) < len(rpc.Publish) {
+			rpc.Publish = kept
+			if encoded, err := rpc.Marshal(); err == nil {
+				frame = encoded
+			}
+		}
+	}
+	delimited := make([]byte, binary.MaxVarintLen64, binary.MaxVarintLen64+len(frame))
+	n := binary.PutUvarint(delimited, uint64(len(frame)))
+	return append(delimited[:n], frame...)
+}
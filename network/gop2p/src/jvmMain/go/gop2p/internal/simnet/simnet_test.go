@@ -0,0 +1,61 @@
+/*
+ * Copyright (c) 2021 The biotopium Authors.
+ * This file is part of biotopium.
+ *
+ * biotopium is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * biotopium is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with biotopium.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package simnet
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	pb "github.com/libp2p/go-libp2p-pubsub/pb"
+	"io/ioutil"
+	"testing"
+)
+
+// newLossyStream creates a lossy stream reading from a buffer and losing no messages.
+// The received bytes have to be given.
+func newLossyStream(received []byte) *lossyStream {
+	return &lossyStream{reader: bufio.NewReader(bytes.NewReader(received)), lose: func() bool { return false }}
+}
+
+func TestLossyStreamRead(t *testing.T) {
+	topic := "topic"
+	rpc := &pb.RPC{Publish: []*pb.Message{{Data: []byte("data"), Topic: &topic}}}
+	frame, err := rpc.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	delimited := make([]byte, binary.MaxVarintLen64)
+	delimited = append(delimited[:binary.PutUvarint(delimited, uint64(len(frame)))], frame...)
+	read, err := ioutil.ReadAll(newLossyStream(delimited))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(read, delimited) {
+		t.Errorf("expected %x, got %x", delimited, read)
+	}
+}
+
+func TestLossyStreamMaxMessageSize(t *testing.T) {
+	oversized := make([]byte, binary.MaxVarintLen64)
+	oversized = oversized[:binary.PutUvarint(oversized, pubsub.DefaultMaxMessageSize+1)]
+	if _, err := newLossyStream(oversized).Read(make([]byte, 16)); err == nil {
+		t.Error("expected an RPC exceeding the maximum message size to be rejected")
+	}
+}
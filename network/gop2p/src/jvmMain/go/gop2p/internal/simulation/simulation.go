@@ -0,0 +1,720 @@
+/*
+ * Copyright (c) 2021 The biotopium Authors.
+ * This file is part of biotopium.
+ *
+ * biotopium is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * biotopium is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with biotopium.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+// Package simulation runs scripted scenarios of one blocklord and many clients on an in-memory network.
+// It reports the delivery latency and loss per message type and is not part of the shared library.
+package simulation
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	logging "github.com/ipfs/go-log/v2"
+	"github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/peer"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+	"io/ioutil"
+	"math"
+	"riesenacht.ch/biotopium/network/gop2p/blockchain"
+	"riesenacht.ch/biotopium/network/gop2p/internal/simnet"
+	"riesenacht.ch/biotopium/network/gop2p/p2p"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Types of the scenario events.
+const (
+	EventPartition  = "partition"  // separates the given clients from the rest of the network
+	EventHeal       = "heal"       // reconnects all running peers
+	EventStop       = "stop"       // stops the given clients
+	EventStart      = "start"      // starts the given stopped clients
+	EventRestart    = "restart"    // stops the given clients and starts them again after the downtime
+	EventConditions = "conditions" // changes the latency, the bandwidth and the loss of all links
+)
+
+// Names of the topic and the protocol of the simulated network.
+const (
+	simulationTopic    = "/biotopium/0.1.0/simulation"
+	simulationProtocol = "/biotopium/0.1.0/simulation-direct"
+)
+
+// simulationWarmup is the duration gossipsub is given to set up the connections before the scenario starts.
+const simulationWarmup = 2 * time.Second
+
+// classDiscriminator is the name of the JSON field containing the serial name of a message type, as in envelopes.
+const classDiscriminator = "class"
+
+// logger is the structured, leveled logger of the simulation.
+var logger = logging.Logger(p2p.LogSubsystem)
+
+// Scenario represents a scripted simulation of one blocklord and many clients.
+// The blocklord announces blocks via pubsub, the clients send action requests directly to the blocklord.
+type Scenario struct {
+	Clients        int             `json:"clients"`              // number of clients
+	Duration       int             `json:"durationMillis"`       // duration of sending messages in milliseconds
+	Drain          int             `json:"drainMillis"`          // duration waiting for outstanding deliveries in milliseconds
+	BlockInterval  int             `json:"blockIntervalMillis"`  // interval of announcing blocks in milliseconds
+	ActionInterval int             `json:"actionIntervalMillis"` // interval of each client sending an action request in milliseconds, 0 for none
+	Latency        int             `json:"latencyMillis"`        // latency of the links in milliseconds
+	Bandwidth      float64         `json:"bandwidth"`            // bandwidth of the links in bytes per second, 0 for unlimited
+	Loss           float64         `json:"loss"`                 // probability of losing a received message
+	Seed           int64           `json:"seed"`                 // seed of the message losses
+	Events         []ScenarioEvent `json:"events"`               // scheduled events
+}
+
+// ScenarioEvent represents an event scheduled in a scenario.
+// Clients are referred to by their index, starting at 0.
+type ScenarioEvent struct {
+	At        int     `json:"atMillis"`       // time of the event in milliseconds since the start of the scenario
+	Type      string  `json:"type"`           // type of the event
+	Clients   []int   `json:"clients"`        // clients of partition, stop, start and restart events
+	Downtime  int     `json:"downtimeMillis"` // downtime of restart events in milliseconds
+	Latency   int     `json:"latencyMillis"`  // latency of conditions events in milliseconds
+	Bandwidth float64 `json:"bandwidth"`      // bandwidth of conditions events in bytes per second, 0 for unlimited
+	Loss      float64 `json:"loss"`           // probability of losing a received message of conditions events
+}
+
+// DeliveryStats represents the delivery of a message type in a simulation.
+// Each message is expected to be delivered to all receivers running when it was sent.
+type DeliveryStats struct {
+	MessageType string  `json:"messageType"` // serial name of the message type
+	Sent        int     `json:"sent"`        // number of sent messages
+	Failed      int     `json:"failed"`      // number of messages failing to be sent
+	Expected    int     `json:"expected"`    // number of expected deliveries
+	Delivered   int     `json:"delivered"`   // number of expected deliveries which took place
+	Lost        int     `json:"lost"`        // number of expected deliveries which did not take place
+	LossRate    float64 `json:"lossRate"`    // ratio of lost deliveries
+	Min         float64 `json:"minMillis"`   // minimum delivery latency in milliseconds
+	Avg         float64 `json:"avgMillis"`   // average delivery latency in milliseconds
+	P50         float64 `json:"p50Millis"`   // median delivery latency in milliseconds
+	P95         float64 `json:"p95Millis"`   // 95th percentile of the delivery latency in milliseconds
+	Max         float64 `json:"maxMillis"`   // maximum delivery latency in milliseconds
+}
+
+// DefaultScenario returns a scenario of ten clients over thirty seconds,
+// with a partition, a restart of two clients and degrading link conditions.
+func DefaultScenario() *Scenario {
+	return &Scenario{
+		Clients:        10,
+		Duration:       30000,
+		Drain:          5000,
+		BlockInterval:  2000,
+		ActionInterval: 1000,
+		Latency:        50,
+		Loss:           0.02,
+		Seed:           1,
+		Events: []ScenarioEvent{
+			{At: 8000, Type: EventPartition, Clients: []int{0, 1, 2}},
+			{At: 14000, Type: EventHeal},
+			{At: 18000, Type: EventRestart, Clients: []int{3, 4}, Downtime: 3000},
+			{At: 24000, Type: EventConditions, Latency: 200, Loss: 0.1},
+		},
+	}
+}
+
+// LoadScenario loads a scenario from a JSON file.
+// The path of the file has to be given.
+// A pointer to the validated scenario is returned.
+func LoadScenario(path string) (*Scenario, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	scenario := &Scenario{}
+	if err := json.Unmarshal(content, scenario); err != nil {
+		return nil, err
+	}
+	return scenario, scenario.validate()
+}
+
+// validate checks whether the scenario can be simulated.
+func (sc *Scenario) validate() error {
+	if sc.Clients <= 0 || sc.Duration <= 0 || sc.BlockInterval <= 0 {
+		return fmt.Errorf("clients, duration and block interval of a scenario have to be positive")
+	}
+	if sc.Drain < 0 || sc.ActionInterval < 0 || sc.Latency < 0 || sc.Bandwidth < 0 {
+		return fmt.Errorf("drain, action interval, latency and bandwidth of a scenario must not be negative")
+	}
+	if sc.Loss < 0 || sc.Loss >= 1 {
+		return fmt.Errorf("loss of a scenario has to be in [0, 1)")
+	}
+	for _, event := range sc.Events {
+		if event.At < 0 || event.At+event.Downtime > sc.Duration {
+			return fmt.Errorf("%s event at %d ms is outside of the scenario", event.Type, event.At)
+		}
+		switch event.Type {
+		case EventHeal:
+		case EventConditions:
+			if event.Loss < 0 || event.Loss >= 1 || event.Latency < 0 || event.Bandwidth < 0 {
+				return fmt.Errorf("invalid conditions event at %d ms", event.At)
+			}
+		case EventPartition, EventStop, EventStart, EventRestart:
+			for _, client := range event.Clients {
+				if client < 0 || client >= sc.Clients {
+					return fmt.Errorf("%s event at %d ms refers to unknown client %d", event.Type, event.At, client)
+				}
+			}
+		default:
+			return fmt.Errorf("unknown event type %s", event.Type)
+		}
+	}
+	return nil
+}
+
+// schedule returns the events ordered by time, restart events are split into a stop and a start event.
+func (sc *Scenario) schedule() []ScenarioEvent {
+	var events []ScenarioEvent
+	for _, event := range sc.Events {
+		if event.Type != EventRestart {
+			events = append(events, event)
+			continue
+		}
+		events = append(events,
+			ScenarioEvent{At: event.At, Type: EventStop, Clients: event.Clients},
+			ScenarioEvent{At: event.At + event.Downtime, Type: EventStart, Clients: event.Clients},
+		)
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].At < events[j].At
+	})
+	return events
+}
+
+// messageKey identifies a message sent in a simulation.
+type messageKey struct {
+	messageType string // serial name of the message type
+	id          string // block height or action hash
+}
+
+// simulatedMessage represents a message sent in a simulation.
+type simulatedMessage struct {
+	sentAt    time.Time             // time of sending
+	failed    bool                  // whether sending failed
+	expected  map[int]bool          // nodes expected to receive the message
+	latencies map[int]time.Duration // delivery latencies indexed by node
+}
+
+// simulation represents a running scenario.
+// The blocklord is node 0, client i is node i+1.
+type simulation struct {
+	scenario *Scenario
+	net      *simnet.Network
+	keys     []crypto.PrivKey // identity keys of the nodes
+	peerIDs  []peer.ID        // peer IDs of the nodes
+
+	mutex       sync.Mutex
+	nodes       []*p2p.Server                    // running servers, nil if stopped
+	partitioned []int                            // nodes separated from the rest of the network
+	messages    map[messageKey]*simulatedMessage // sent messages
+	height      uint64                           // height of the last announced block
+	prevHash    string                           // hash of the last announced block
+	actions     int                              // number of sent action requests
+}
+
+// Simulate runs a scenario on an in-memory network.
+// All nodes are started and connected to each other, before blocks and action requests are sent as scheduled.
+// The scenario has to be given.
+// The delivery statistics per message type are returned.
+func Simulate(scenario *Scenario) ([]*DeliveryStats, error) {
+	if err := scenario.validate(); err != nil {
+		return nil, err
+	}
+	sim := &simulation{
+		scenario: scenario,
+		net: simnet.New(mocknet.LinkOptions{
+			Latency:   time.Duration(scenario.Latency) * time.Millisecond,
+			Bandwidth: scenario.Bandwidth,
+		}, scenario.Loss, scenario.Seed),
+		nodes:    make([]*p2p.Server, scenario.Clients+1),
+		messages: make(map[messageKey]*simulatedMessage),
+	}
+	defer sim.stopAll()
+	for i := 0; i <= scenario.Clients; i++ {
+		privateKey, _, err := crypto.GenerateKeyPair(crypto.Ed25519, -1)
+		if err != nil {
+			return nil, err
+		}
+		peerID, err := peer.IDFromPrivateKey(privateKey)
+		if err != nil {
+			return nil, err
+		}
+		sim.keys = append(sim.keys, privateKey)
+		sim.peerIDs = append(sim.peerIDs, peerID)
+	}
+	for i := range sim.nodes {
+		if err := sim.startNode(i); err != nil {
+			return nil, err
+		}
+	}
+	if err := sim.reconnect(); err != nil {
+		return nil, err
+	}
+	time.Sleep(simulationWarmup)
+
+	if err := sim.run(); err != nil {
+		return nil, err
+	}
+	return sim.report(), nil
+}
+
+// run sends blocks and action requests and applies the events until the end of the scenario.
+// Afterwards it waits for outstanding deliveries.
+func (sim *simulation) run() error {
+	blocks := time.NewTicker(time.Duration(sim.scenario.BlockInterval) * time.Millisecond)
+	defer blocks.Stop()
+	var actions <-chan time.Time
+	if sim.scenario.ActionInterval > 0 {
+		ticker := time.NewTicker(time.Duration(sim.scenario.ActionInterval) * time.Millisecond)
+		defer ticker.Stop()
+		actions = ticker.C
+	}
+	var wg sync.WaitGroup
+	start := time.Now()
+	end := time.After(time.Duration(sim.scenario.Duration) * time.Millisecond)
+	events := sim.scenario.schedule()
+	for running := true; running; {
+		var next <-chan time.Time
+		if len(events) > 0 {
+			next = time.After(time.Until(start.Add(time.Duration(events[0].At) * time.Millisecond)))
+		}
+		select {
+		case <-end:
+			running = false
+		case <-blocks.C:
+			if err := sim.announceBlock(); err != nil {
+				return err
+			}
+		case <-actions:
+			sim.sendActions(&wg)
+		case <-next:
+			logger.Infow("Applying simulation event", "type", events[0].Type, "at", events[0].At, "clients", events[0].Clients)
+			if err := sim.apply(events[0]); err != nil {
+				return err
+			}
+			events = events[1:]
+		}
+	}
+	wg.Wait()
+	time.Sleep(time.Duration(sim.scenario.Drain) * time.Millisecond)
+	return nil
+}
+
+// apply applies a scenario event.
+// The event has to be given.
+func (sim *simulation) apply(event ScenarioEvent) error {
+	switch event.Type {
+	case EventPartition:
+		sim.mutex.Lock()
+		sim.partitioned = nil
+		for _, client := range event.Clients {
+			sim.partitioned = append(sim.partitioned, client+1)
+		}
+		sim.mutex.Unlock()
+		sim.partition()
+	case EventHeal:
+		sim.mutex.Lock()
+		sim.partitioned = nil
+		sim.mutex.Unlock()
+		return sim.reconnect()
+	case EventStop:
+		for _, client := range event.Clients {
+			if err := sim.stopNode(client + 1); err != nil {
+				return err
+			}
+		}
+	case EventStart:
+		for _, client := range event.Clients {
+			if err := sim.startNode(client + 1); err != nil {
+				return err
+			}
+		}
+		sim.partition()
+		return sim.reconnect()
+	case EventConditions:
+		sim.net.SetConditions(mocknet.LinkOptions{
+			Latency:   time.Duration(event.Latency) * time.Millisecond,
+			Bandwidth: event.Bandwidth,
+		}, event.Loss)
+	}
+	return nil
+}
+
+// startNode starts a node unless it is running.
+// Clients trust the blocklord and bootstrap from it.
+// The index of the node has to be given.
+func (sim *simulation) startNode(i int) error {
+	sim.mutex.Lock()
+	running, blocklord := sim.nodes[i], sim.nodes[0]
+	sim.mutex.Unlock()
+	if running != nil {
+		return nil
+	}
+	keyBytes, err := crypto.MarshalPrivateKey(sim.keys[i])
+	if err != nil {
+		return err
+	}
+	options := []p2p.Option{p2p.WithPingInterval(0)}
+	var bootstrapPeers []string
+	if i > 0 {
+		options = append(options, p2p.WithTrustedBlocklords([]string{sim.peerIDs[0].Pretty()}, nil))
+		if blocklord != nil {
+			bootstrapPeers = append(bootstrapPeers, fmt.Sprintf("%s/p2p/%s", blocklord.Host.Addrs()[0], blocklord.Host.ID()))
+		}
+	}
+	config := p2p.NewConfig(simulationTopic, simulationProtocol, 0, bootstrapPeers, keyBytes, options...)
+	s, err := p2p.NewServer(config, sim.net.NewHost)
+	if err != nil {
+		return err
+	}
+	if i == 0 {
+		s.MessageTypes.Handle(p2p.MessageTypeActionReq, func(envelope *p2p.Envelope, _ peer.ID) bool {
+			request := &actionRequest{}
+			if err := json.Unmarshal(envelope.Message, request); err == nil && len(request.Action.Hash) > 0 {
+				sim.received(messageKey{p2p.MessageTypeActionReq, request.Action.Hash}, i)
+			}
+			return true
+		})
+	} else {
+		s.MessageTypes.Handle(p2p.MessageTypeBlockAdd, func(envelope *p2p.Envelope, _ peer.ID) bool {
+			message := &blockchain.BlockAddMessage{}
+			if err := json.Unmarshal(envelope.Message, message); err == nil && message.Block != nil {
+				sim.received(messageKey{p2p.MessageTypeBlockAdd, fmt.Sprint(message.Block.Height)}, i)
+			}
+			return true
+		})
+	}
+	sim.mutex.Lock()
+	sim.nodes[i] = s
+	sim.mutex.Unlock()
+	return nil
+}
+
+// stopNode stops a node if it is running and removes its links.
+// The index of the node has to be given.
+func (sim *simulation) stopNode(i int) error {
+	sim.mutex.Lock()
+	s := sim.nodes[i]
+	sim.nodes[i] = nil
+	sim.mutex.Unlock()
+	if s == nil {
+		return nil
+	}
+	defer sim.net.Isolate(sim.peerIDs[i])
+	return s.Stop()
+}
+
+// stopAll stops all running nodes.
+func (sim *simulation) stopAll() {
+	for i := range sim.nodes {
+		_ = sim.stopNode(i)
+	}
+}
+
+// running returns the indexes of the running nodes, either within or outside of the partition.
+// Whether the nodes within the partition are requested has to be given.
+func (sim *simulation) running(partitioned bool) []int {
+	sim.mutex.Lock()
+	defer sim.mutex.Unlock()
+	within := make(map[int]bool)
+	for _, i := range sim.partitioned {
+		within[i] = true
+	}
+	var indexes []int
+	for i, s := range sim.nodes {
+		if s != nil && within[i] == partitioned {
+			indexes = append(indexes, i)
+		}
+	}
+	return indexes
+}
+
+// partition separates the partitioned nodes from the rest of the network.
+func (sim *simulation) partition() {
+	sim.mutex.Lock()
+	within := make(map[int]bool)
+	for _, i := range sim.partitioned {
+		within[i] = true
+	}
+	sim.mutex.Unlock()
+	var group, others []peer.ID
+	for i, peerID := range sim.peerIDs {
+		if within[i] {
+			group = append(group, peerID)
+		} else {
+			others = append(others, peerID)
+		}
+	}
+	sim.net.Partition(group, others)
+}
+
+// reconnect connects all running nodes to each other, as long as they are on the same side of the partition.
+func (sim *simulation) reconnect() error {
+	for _, partitioned := range []bool{false, true} {
+		var peerIDs []peer.ID
+		for _, i := range sim.running(partitioned) {
+			peerIDs = append(peerIDs, sim.peerIDs[i])
+		}
+		if err := sim.net.ConnectAll(peerIDs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sent records a message expected to be delivered to the given nodes.
+// The key of the message and the indexes of the receivers have to be given.
+func (sim *simulation) sent(key messageKey, receivers []int) *simulatedMessage {
+	message := &simulatedMessage{
+		sentAt:    time.Now(),
+		expected:  make(map[int]bool),
+		latencies: make(map[int]time.Duration),
+	}
+	for _, i := range receivers {
+		message.expected[i] = true
+	}
+	sim.mutex.Lock()
+	defer sim.mutex.Unlock()
+	sim.messages[key] = message
+	return message
+}
+
+// actionRequest represents an ActionReqMessage, only the hash of the action record is decoded.
+type actionRequest struct {
+	Action struct {
+		Hash string `json:"hash"` // hash of the action record
+	} `json:"action"`
+}
+
+// received records the first delivery of a message to a node it was expected by.
+// The key of the message and the index of the receiving node have to be given.
+func (sim *simulation) received(key messageKey, i int) {
+	sim.mutex.Lock()
+	defer sim.mutex.Unlock()
+	message, ok := sim.messages[key]
+	if !ok || !message.expected[i] {
+		return
+	}
+	if _, ok := message.latencies[i]; !ok {
+		message.latencies[i] = time.Since(message.sentAt)
+	}
+}
+
+// fail records a message failing to be sent.
+// The sent message has to be given.
+func (sim *simulation) fail(message *simulatedMessage) {
+	sim.mutex.Lock()
+	defer sim.mutex.Unlock()
+	message.failed = true
+}
+
+// simulatedBlock represents a block without records, announced in a simulation.
+type simulatedBlock struct {
+	Height    uint64            `json:"height"`
+	Timestamp int64             `json:"timestamp"`
+	PrevHash  string            `json:"prevHash"`
+	Author    string            `json:"author"`
+	Data      []json.RawMessage `json:"data"`
+	Hash      string            `json:"hash,omitempty"`
+	Sign      string            `json:"sign,omitempty"`
+}
+
+// announceBlock announces the next block signed by the blocklord via pubsub.
+// The block is expected to be delivered to all running clients.
+func (sim *simulation) announceBlock() error {
+	sim.mutex.Lock()
+	blocklord := sim.nodes[0]
+	sim.height++
+	block := &simulatedBlock{
+		Height:    sim.height,
+		Timestamp: time.Now().UnixNano() / int64(time.Millisecond),
+		PrevHash:  sim.prevHash,
+		Data:      []json.RawMessage{},
+	}
+	sim.mutex.Unlock()
+	author, err := p2p.AddressFromPublicKey(sim.keys[0].GetPublic())
+	if err != nil {
+		return err
+	}
+	block.Author = string(author)
+	serialized, err := json.Marshal(block)
+	if err != nil {
+		return err
+	}
+	hashable, err := blockchain.EncodeHashableBlock(serialized)
+	if err != nil {
+		return err
+	}
+	block.Hash = blockchain.Hash(hashable)
+	sign, err := sim.keys[0].Sign([]byte(block.Hash))
+	if err != nil {
+		return err
+	}
+	block.Sign = base64.StdEncoding.EncodeToString(sign)
+	sim.mutex.Lock()
+	sim.prevHash = block.Hash
+	sim.mutex.Unlock()
+
+	envelope, err := json.Marshal(map[string]interface{}{
+		"peerId": sim.peerIDs[0].Pretty(),
+		"message": map[string]interface{}{
+			classDiscriminator: p2p.MessageTypeBlockAdd,
+			"block":            block,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	clients := append(sim.running(false), sim.running(true)...)
+	message := sim.sent(messageKey{p2p.MessageTypeBlockAdd, fmt.Sprint(block.Height)}, without(clients, 0))
+	if err := blocklord.PubSub.Publish(envelope); err != nil {
+		logger.Warnw("Failed to announce simulated block", "height", block.Height, "error", err)
+		sim.fail(message)
+	}
+	return nil
+}
+
+// sendActions sends an action request from each running client directly to the blocklord.
+// The action requests are expected to be delivered to the blocklord if it is running.
+// A wait group tracking the pending requests has to be given.
+func (sim *simulation) sendActions(wg *sync.WaitGroup) {
+	sim.mutex.Lock()
+	nodes := append([]*p2p.Server(nil), sim.nodes...)
+	sim.mutex.Unlock()
+	var receivers []int
+	if nodes[0] != nil {
+		receivers = append(receivers, 0)
+	}
+	for i, s := range nodes[1:] {
+		if s == nil {
+			continue
+		}
+		sim.mutex.Lock()
+		sim.actions++
+		seq := sim.actions
+		sim.mutex.Unlock()
+		author, err := p2p.PeerIDToAddress(sim.peerIDs[i+1])
+		if err != nil {
+			logger.Warnw("Failed to derive the address of a simulated client", "peer", sim.peerIDs[i+1].Pretty(), "error", err)
+			continue
+		}
+		hash := blockchain.Hash(fmt.Sprintf("%s;%d", author, seq))
+		envelope, err := json.Marshal(map[string]interface{}{
+			"peerId": sim.peerIDs[i+1].Pretty(),
+			"message": map[string]interface{}{
+				classDiscriminator: p2p.MessageTypeActionReq,
+				"action": map[string]interface{}{
+					classDiscriminator: "ActionRecord",
+					"timestamp":        time.Now().UnixNano() / int64(time.Millisecond),
+					"author":           author,
+					"hash":             hash,
+				},
+			},
+		})
+		if err != nil {
+			logger.Warnw("Failed to encode a simulated action request", "error", err)
+			continue
+		}
+		message := sim.sent(messageKey{p2p.MessageTypeActionReq, hash}, receivers)
+		wg.Add(1)
+		go func(s *p2p.Server) {
+			defer wg.Done()
+			if err := s.Stream.Send(sim.peerIDs[0], envelope); err != nil {
+				sim.fail(message)
+			}
+		}(s)
+	}
+}
+
+// report computes the delivery statistics per message type, ordered by the serial name of the message type.
+func (sim *simulation) report() []*DeliveryStats {
+	sim.mutex.Lock()
+	defer sim.mutex.Unlock()
+	stats := make(map[string]*DeliveryStats)
+	latencies := make(map[string][]time.Duration)
+	for key, message := range sim.messages {
+		s, ok := stats[key.messageType]
+		if !ok {
+			s = &DeliveryStats{MessageType: key.messageType}
+			stats[key.messageType] = s
+		}
+		s.Sent++
+		if message.failed {
+			s.Failed++
+		}
+		s.Expected += len(message.expected)
+		s.Delivered += len(message.latencies)
+		for _, latency := range message.latencies {
+			latencies[key.messageType] = append(latencies[key.messageType], latency)
+		}
+	}
+	var report []*DeliveryStats
+	for messageType, s := range stats {
+		s.Lost = s.Expected - s.Delivered
+		if s.Expected > 0 {
+			s.LossRate = float64(s.Lost) / float64(s.Expected)
+		}
+		sorted := latencies[messageType]
+		sort.Slice(sorted, func(i, j int) bool {
+			return sorted[i] < sorted[j]
+		})
+		if len(sorted) > 0 {
+			var sum time.Duration
+			for _, latency := range sorted {
+				sum += latency
+			}
+			s.Min = millis(sorted[0])
+			s.Avg = millis(sum / time.Duration(len(sorted)))
+			s.P50 = millis(percentile(sorted, 0.5))
+			s.P95 = millis(percentile(sorted, 0.95))
+			s.Max = millis(sorted[len(sorted)-1])
+		}
+		report = append(report, s)
+	}
+	sort.Slice(report, func(i, j int) bool {
+		return report[i].MessageType < report[j].MessageType
+	})
+	return report
+}
+
+// percentile returns the nearest-rank percentile of sorted durations.
+// The sorted durations and the percentile in (0, 1] have to be given.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return sorted[rank]
+}
+
+// without returns the indexes except the given one.
+// The indexes and the excluded index have to be given.
+func without(indexes []int, excluded int) []int {
+	var remaining []int
+	for _, i := range indexes {
+		if i != excluded {
+			remaining = append(remaining, i)
+		}
+	}
+	return remaining
+}
+
+// millis converts a duration to milliseconds.
+func millis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
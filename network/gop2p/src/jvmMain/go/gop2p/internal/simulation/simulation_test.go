@@ -0,0 +1,112 @@
+/*
+ * Copyright (c) 2021 The biotopium Authors.
+ * This file is part of biotopium.
+ *
+ * biotopium is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * biotopium is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with biotopium.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package simulation
+
+import (
+	"riesenacht.ch/biotopium/network/gop2p/p2p"
+	"testing"
+)
+
+// simulate runs a scenario and returns the delivery statistics indexed by message type.
+func simulate(t *testing.T, scenario *Scenario) map[string]*DeliveryStats {
+	report, err := Simulate(scenario)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats := make(map[string]*DeliveryStats)
+	for _, s := range report {
+		stats[s.MessageType] = s
+	}
+	for _, messageType := range []string{p2p.MessageTypeBlockAdd, p2p.MessageTypeActionReq} {
+		if stats[messageType] == nil || stats[messageType].Sent == 0 {
+			t.Fatalf("no %s sent", messageType)
+		}
+	}
+	return stats
+}
+
+func TestSimulation(t *testing.T) {
+	stats := simulate(t, &Scenario{
+		Clients:        3,
+		Duration:       3000,
+		Drain:          1000,
+		BlockInterval:  500,
+		ActionInterval: 500,
+		Latency:        20,
+	})
+	for messageType, s := range stats {
+		if s.Lost > 0 || s.Failed > 0 {
+			t.Errorf("%s: expected no losses, got %d lost and %d failed", messageType, s.Lost, s.Failed)
+		}
+		if s.Min < 20 {
+			t.Errorf("%s: expected the link latency to apply, got a minimum latency of %f ms", messageType, s.Min)
+		}
+	}
+	if blocks := stats[p2p.MessageTypeBlockAdd]; blocks.Expected != 3*blocks.Sent {
+		t.Errorf("expected each block to be expected by all clients, got %d of %d", blocks.Expected, blocks.Sent)
+	}
+}
+
+func TestSimulationPartition(t *testing.T) {
+	stats := simulate(t, &Scenario{
+		Clients:        3,
+		Duration:       3000,
+		Drain:          1000,
+		BlockInterval:  500,
+		ActionInterval: 500,
+		Events: []ScenarioEvent{
+			{At: 0, Type: EventPartition, Clients: []int{0}},
+		},
+	})
+	// the partitioned client neither receives blocks nor reaches the blocklord
+	blocks := stats[p2p.MessageTypeBlockAdd]
+	if blocks.Lost != blocks.Sent || blocks.Delivered != 2*blocks.Sent {
+		t.Errorf("expected the partitioned client to lose all %d blocks, got %d lost and %d delivered", blocks.Sent, blocks.Lost, blocks.Delivered)
+	}
+	if actions := stats[p2p.MessageTypeActionReq]; actions.Failed == 0 || actions.Lost != actions.Failed {
+		t.Errorf("expected the action requests of the partitioned client to fail, got %d failed and %d lost", actions.Failed, actions.Lost)
+	}
+}
+
+func TestScenarioValidation(t *testing.T) {
+	valid := func() *Scenario {
+		return &Scenario{Clients: 2, Duration: 1000, BlockInterval: 100}
+	}
+	if err := valid().validate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := DefaultScenario().validate(); err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]func(*Scenario){
+		"no clients":        func(sc *Scenario) { sc.Clients = 0 },
+		"certain loss":      func(sc *Scenario) { sc.Loss = 1 },
+		"unknown event":     func(sc *Scenario) { sc.Events = []ScenarioEvent{{Type: "flood"}} },
+		"unknown client":    func(sc *Scenario) { sc.Events = []ScenarioEvent{{Type: EventStop, Clients: []int{2}}} },
+		"late restart":      func(sc *Scenario) { sc.Events = []ScenarioEvent{{At: 900, Type: EventRestart, Downtime: 200}} },
+		"negative interval": func(sc *Scenario) { sc.ActionInterval = -1 },
+	}
+	for name, modify := range tests {
+		sc := valid()
+		modify(sc)
+		if err := sc.validate(); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
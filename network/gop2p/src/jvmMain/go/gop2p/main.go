@@ -19,26 +19,318 @@
 package main
 
 //#include <stdlib.h>
+//#include "error.h"
 import "C"
 import (
 	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/routing"
 	"riesenacht.ch/biotopium/network/gop2p/check"
 	"riesenacht.ch/biotopium/network/gop2p/p2p"
 	"strings"
+	"time"
 )
 
 // The delimiter for string bundles.
 const stringBundleDelimiter = ";"
 
+// serverOptions holds the options configured before the server is started.
+var serverOptions []p2p.Option
+
+// ConfigurePeerLookupTimeout sets the timeout for looking up and dialing peers.
+// Has to be called before StartServer.
+// The positive timeout in milliseconds has to be given.
+// False is returned if the timeout is invalid, the error is stored in the error of the call.
+//export ConfigurePeerLookupTimeout
+func ConfigurePeerLookupTimeout(timeoutMillis int, errPtr *C.gop2p_error) bool {
+	if timeoutMillis <= 0 {
+		setError(errPtr, fmt.Errorf("invalid peer lookup timeout %d ms", timeoutMillis))
+		return false
+	}
+	serverOptions = append(serverOptions, p2p.WithPeerLookupTimeout(time.Duration(timeoutMillis)*time.Millisecond))
+	return true
+}
+
+// ConfigureSeenCache sets the duration a received action request is remembered.
+// Duplicates received within the duration are dropped.
+// Has to be called before StartServer.
+// The duration in milliseconds has to be given.
+//export ConfigureSeenCache
+func ConfigureSeenCache(ttlMillis int) {
+	serverOptions = append(serverOptions, p2p.WithSeenCacheTTL(time.Duration(ttlMillis)*time.Millisecond))
+}
+
+// ConfigureCompression enables compression of sent messages.
+// Direct messages are only compressed if the receiver supports compression.
+// Pubsub compression should only be enabled once all peers support compression.
+// Has to be called before StartServer.
+// Whether to compress direct and pubsub messages has to be given.
+//export ConfigureCompression
+func ConfigureCompression(direct bool, pubSub bool) {
+	serverOptions = append(serverOptions, p2p.WithCompression(direct, pubSub))
+}
+
+// ConfigureBinaryEncoding enables the binary encoding of sent messages.
+// Direct messages are only binary encoded if the receiver supports the binary encoding.
+// The binary pubsub encoding should only be enabled once all peers support the binary encoding.
+// Has to be called before StartServer.
+// Whether to binary encode direct and pubsub messages has to be given.
+//export ConfigureBinaryEncoding
+func ConfigureBinaryEncoding(direct bool, pubSub bool) {
+	serverOptions = append(serverOptions, p2p.WithBinaryEncoding(direct, pubSub))
+}
+
+// ConfigureRelay configures relaying and NAT traversal.
+// Has to be called before StartServer.
+// Whether to act as relay hop, whether to offer the AutoNAT service and
+// the static relay multiaddresses as string bundle have to be given.
+//export ConfigureRelay
+func ConfigureRelay(hop bool, natService bool, staticRelayBundlePtr *C.char) {
+	if hop {
+		serverOptions = append(serverOptions, p2p.WithRelayHop())
+	}
+	if natService {
+		serverOptions = append(serverOptions, p2p.WithNATService())
+	}
+	staticRelayBundle := C.GoString(staticRelayBundlePtr)
+	if len(staticRelayBundle) != 0 {
+		serverOptions = append(serverOptions, p2p.WithStaticRelays(strings.Split(staticRelayBundle, stringBundleDelimiter)))
+	}
+}
+
+// ConfigureIdentityKeyFile sets the passphrase-encrypted key file holding the identity key.
+// The key file is used if no private key is passed to StartServer,
+// it is created containing a new key if it does not exist yet.
+// Has to be called before StartServer.
+// The file path and the passphrase as pointers to C characters (arrays) have to be given.
+//export ConfigureIdentityKeyFile
+func ConfigureIdentityKeyFile(pathPtr, passphrasePtr *C.char) {
+	serverOptions = append(serverOptions, p2p.WithIdentityKeyFile(C.GoString(pathPtr), C.GoString(passphrasePtr)))
+}
+
+// ConfigurePlayerKey sets the private key of the player's key pair as identity key.
+// The player key is used if no private key is passed to StartServer.
+// Has to be called before StartServer.
+// The base64 encoded raw Ed25519 private key as pointer to a C character (array) has to be given.
+//export ConfigurePlayerKey
+func ConfigurePlayerKey(privateKeyBase64Ptr *C.char) {
+	serverOptions = append(serverOptions, p2p.WithPlayerKey(C.GoString(privateKeyBase64Ptr)))
+}
+
+// ConfigureTrustedBlocklords sets the trusted blocklords.
+// Block announcements not originating from them are rejected.
+// Has to be called before StartServer.
+// The peer IDs and the addresses of the trusted blocklords as string bundles have to be given.
+//export ConfigureTrustedBlocklords
+func ConfigureTrustedBlocklords(peerIdBundlePtr, addressBundlePtr *C.char) {
+	var peerIDs, addresses []string
+	if peerIdBundle := C.GoString(peerIdBundlePtr); len(peerIdBundle) != 0 {
+		peerIDs = strings.Split(peerIdBundle, stringBundleDelimiter)
+	}
+	if addressBundle := C.GoString(addressBundlePtr); len(addressBundle) != 0 {
+		addresses = strings.Split(addressBundle, stringBundleDelimiter)
+	}
+	serverOptions = append(serverOptions, p2p.WithTrustedBlocklords(peerIDs, addresses))
+}
+
+// ConfigureBlockStore enables the persistent block store.
+// Accepted block announcements are stored and chain requests are answered without the host.
+// Has to be called before StartServer.
+// The file path of the block store as pointer to a C character (array) has to be given.
+//export ConfigureBlockStore
+func ConfigureBlockStore(pathPtr *C.char) {
+	serverOptions = append(serverOptions, p2p.WithBlockStore(C.GoString(pathPtr)))
+}
+
+// ConfigureAreaSize sets the number of realms per side of an area sharing an area-of-interest topic.
+// Has to be called before StartServer.
+// The positive size has to be given.
+// False is returned if the size is invalid, the error is stored in the error of the call.
+//export ConfigureAreaSize
+func ConfigureAreaSize(size int, errPtr *C.gop2p_error) bool {
+	if size <= 0 {
+		setError(errPtr, fmt.Errorf("invalid area size %d", size))
+		return false
+	}
+	serverOptions = append(serverOptions, p2p.WithAreaSize(uint32(size)))
+	return true
+}
+
+// ConfigureCompatibleVersions sets the protocol versions supported besides the version of the protocol and topic names.
+// The supported versions are advertised, used as fallback when sending and their topics are listened and published to.
+// Has to be called before StartServer.
+// The versions of the form major.minor.patch as string bundle have to be given.
+//export ConfigureCompatibleVersions
+func ConfigureCompatibleVersions(versionBundlePtr *C.char) {
+	var versions []string
+	if versionBundle := C.GoString(versionBundlePtr); len(versionBundle) != 0 {
+		versions = strings.Split(versionBundle, stringBundleDelimiter)
+	}
+	serverOptions = append(serverOptions, p2p.WithCompatibleVersions(versions))
+}
+
+// ConfigureRateLimit limits the streams or pubsub messages per peer of a protocol using a token bucket.
+// Excess streams are reset, excess pubsub messages are ignored.
+// Has to be called before StartServer.
+// The protocol ("direct", "sync" or "pubsub") as pointer to a C character (array),
+// the tokens added per second and the maximum number of tokens have to be given.
+// False is returned if the protocol is unknown or the limit is negative, the error is stored in the error of the call.
+//export ConfigureRateLimit
+func ConfigureRateLimit(protocolPtr *C.char, rate float64, burst int, errPtr *C.gop2p_error) bool {
+	protocol := C.GoString(protocolPtr)
+	if err := p2p.ValidateRateLimit(protocol, p2p.RateLimit{Rate: rate, Burst: burst}); err != nil {
+		setError(errPtr, err)
+		return false
+	}
+	serverOptions = append(serverOptions, p2p.WithRateLimit(protocol, rate, burst))
+	return true
+}
+
+// ConfigureAutoBan enables banning peers exceeding rate limits.
+// Has to be called before StartServer.
+// The non-negative number of violations resulting in a ban (0 disables banning)
+// and the non-negative duration of a ban in milliseconds have to be given.
+// False is returned if the threshold or the duration is negative, the error is stored in the error of the call.
+//export ConfigureAutoBan
+func ConfigureAutoBan(threshold int, durationMillis int, errPtr *C.gop2p_error) bool {
+	if threshold < 0 || durationMillis < 0 {
+		setError(errPtr, fmt.Errorf("invalid auto ban threshold %d or duration %d ms", threshold, durationMillis))
+		return false
+	}
+	serverOptions = append(serverOptions, p2p.WithAutoBan(uint64(threshold), time.Duration(durationMillis)*time.Millisecond))
+	return true
+}
+
+// ConfigureMetricsListener enables the HTTP listener exporting the metrics on /metrics in the Prometheus format.
+// Has to be called before StartServer.
+// The listen address, e.g. 127.0.0.1:9464, as pointer to a C character (array) has to be given.
+//export ConfigureMetricsListener
+func ConfigureMetricsListener(addressPtr *C.char) {
+	serverOptions = append(serverOptions, p2p.WithMetricsListener(C.GoString(addressPtr)))
+}
+
+// ConfigurePingInterval sets the interval of measuring the latency to connected peers.
+// Has to be called before StartServer.
+// The interval in milliseconds has to be given, 0 disables the periodic measurement.
+//export ConfigurePingInterval
+func ConfigurePingInterval(intervalMillis int) {
+	serverOptions = append(serverOptions, p2p.WithPingInterval(time.Duration(intervalMillis)*time.Millisecond))
+}
+
+// ConfigureAgentVersion sets the agent version announced to other peers through identify.
+// Has to be called before StartServer.
+// The agent version, e.g. biotopium-jvm/0.1.0, as pointer to a C character (array) has to be given.
+//export ConfigureAgentVersion
+func ConfigureAgentVersion(agentVersionPtr *C.char) {
+	serverOptions = append(serverOptions, p2p.WithAgentVersion(C.GoString(agentVersionPtr)))
+}
+
+// ConfigureTraceFile writes the gossipsub trace events to a file.
+// Has to be called before StartServer.
+// The path of the trace file and its format ("json" for JSON lines or "pb" for delimited protobufs)
+// as pointers to C characters (arrays) have to be given.
+//export ConfigureTraceFile
+func ConfigureTraceFile(pathPtr, formatPtr *C.char) {
+	serverOptions = append(serverOptions, p2p.WithTraceFile(C.GoString(pathPtr), C.GoString(formatPtr)))
+}
+
+// ConfigureTraceBuffer keeps the most recent gossipsub trace events in memory.
+// Has to be called before StartServer.
+// The non-negative number of kept events has to be given.
+// False is returned if the number is invalid, the error is stored in the error of the call.
+//export ConfigureTraceBuffer
+func ConfigureTraceBuffer(size int, errPtr *C.gop2p_error) bool {
+	if size < 0 {
+		setError(errPtr, fmt.Errorf("invalid trace buffer size %d", size))
+		return false
+	}
+	serverOptions = append(serverOptions, p2p.WithTraceBuffer(size))
+	return true
+}
+
+// SetLogLevel sets the level of all logging subsystems, including the subsystems of libp2p.
+// Can be called before StartServer.
+// The level (debug, info, warn, error, dpanic, panic or fatal) as pointer to a C character (array) has to be given.
+// False is returned if the level is invalid, the error is stored in the error of the call.
+//export SetLogLevel
+func SetLogLevel(levelPtr *C.char, errPtr *C.gop2p_error) bool {
+	err := p2p.SetLogLevel(C.GoString(levelPtr))
+	if err != nil {
+		setError(errPtr, err)
+		return false
+	}
+	return true
+}
+
+// SetSubsystemLogLevel sets the level of a single logging subsystem, e.g. gop2p, pubsub or dht.
+// Can be called before StartServer.
+// The name of the subsystem and the level as pointers to C characters (arrays) have to be given.
+// False is returned if the subsystem or the level is invalid, the error is stored in the error of the call.
+//export SetSubsystemLogLevel
+func SetSubsystemLogLevel(subsystemPtr, levelPtr *C.char, errPtr *C.gop2p_error) bool {
+	err := p2p.SetSubsystemLogLevel(C.GoString(subsystemPtr), C.GoString(levelPtr))
+	if err != nil {
+		setError(errPtr, err)
+		return false
+	}
+	return true
+}
+
+// LogSubsystems returns the names of all logging subsystems as string bundle.
+//export LogSubsystems
+func LogSubsystems() CString {
+	return NewCStringOnce(strings.Join(p2p.LogSubsystems(), stringBundleDelimiter))
+}
+
+// ForwardLogs forwards the log records of all subsystems to the host instead of writing them to stderr.
+// The records are received using ListenLogBlocking, records are dropped if too many are pending.
+// Should be called before StartServer.
+// The maximum number of pending records has to be given.
+// False is returned if the records are already forwarded, the error is stored in the error of the call.
+//export ForwardLogs
+func ForwardLogs(capacity int, errPtr *C.gop2p_error) bool {
+	_, err := p2p.ForwardLogs(capacity)
+	if err != nil {
+		setError(errPtr, err)
+		return false
+	}
+	return true
+}
+
+// ListenLogBlocking listens for new log records, containing the level, the time, the subsystem,
+// the message and the structured fields as JSON object.
+// This is a blocking function, waiting on a channel.
+// An empty string is returned if the records are not forwarded, the error is stored in the error of the call.
+//export ListenLogBlocking
+func ListenLogBlocking(errPtr *C.gop2p_error) CString {
+	records := p2p.LogRecords()
+	if records == nil {
+		setError(errPtr, errors.New("log records are not forwarded"))
+		return NewCStringOnce("")
+	}
+	return NewCStringOnce(<-records)
+}
+
 // StartServer starts the peer-to-peer server.
+// The topic, the protocol name, the bundle of bootstrap peers
+// and the base64 encoded private key (empty if not given) as pointers to C characters (arrays) and the port have to be given.
+// False is returned if the configuration is invalid or the server could not be started,
+// the error is stored in the error of the call.
 //export StartServer
-func StartServer(topicPtr CString, protocolNamePtr CString, port int, bootstrapPeerBundlePtr CString, pkBase64Ptr CString) {
+func StartServer(topicPtr CString, protocolNamePtr CString, port int, bootstrapPeerBundlePtr CString, pkBase64Ptr CString, errPtr *C.gop2p_error) bool {
+	options := serverOptions
+	serverOptions = nil
 	pkBase64 := C.GoString(pkBase64Ptr)
 	var pkBytes []byte
 	if len(pkBase64) > 0 {
 		pkStr, err := base64.StdEncoding.DecodeString(string(pkBase64))
-		check.Err(err)
+		if err != nil {
+			setError(errPtr, err)
+			return false
+		}
 		pkBytes = pkStr
 	}
 	topic := C.GoString(topicPtr)
@@ -51,10 +343,13 @@ func StartServer(topicPtr CString, protocolNamePtr CString, port int, bootstrapP
 		bootstrapPeers = make([]string, 0, 0)
 	}
 
-	config := p2p.NewConfig(topic, protocolName, port, bootstrapPeers, pkBytes)
-	p2p.StartP2PServer(config)
+	config := p2p.NewConfig(topic, protocolName, port, bootstrapPeers, pkBytes, options...)
+	if err := p2p.StartP2PServer(config); err != nil {
+		setError(errPtr, err)
+		return false
+	}
+	return true
 }
-
 // StopServer stops the peer-to-peer server.
 //export StopServer
 func StopServer() {
@@ -70,6 +365,292 @@ func PeerID() CString {
 	return NewCStringOnce(string(idBytes))
 }
 
+// Reachability returns the reachability of the local peer.
+// Either "public", "private" or "unknown" is returned.
+//export Reachability
+func Reachability() CString {
+	return NewCStringOnce(p2p.Instance().Reachability())
+}
+
+// CompressionStats returns the compression statistics as JSON object,
+// containing the raw and compressed bytes of sent and received compressed messages and the compression ratios.
+//export CompressionStats
+func CompressionStats() CString {
+	serialized, err := json.Marshal(p2p.Instance().Compression.Report())
+	check.Err(err)
+	return NewCStringOnce(string(serialized))
+}
+
+// PeerProtocols returns the protocol versions of the connected peers as JSON array,
+// containing the protocol ID negotiated on the last direct stream, the latest direct protocol version
+// advertised through identify and the versions of the subscribed topics of each peer.
+//export PeerProtocols
+func PeerProtocols() CString {
+	serialized, err := json.Marshal(p2p.Instance().PeerProtocols())
+	check.Err(err)
+	return NewCStringOnce(string(serialized))
+}
+
+// PeerIdentities returns the identify information of the connected peers as JSON array,
+// containing the agent version, the protocol version, the supported protocols,
+// the remote address of the connection and the known listen addresses of each peer.
+//export PeerIdentities
+func PeerIdentities() CString {
+	serialized, err := json.Marshal(p2p.Instance().PeerIdentities())
+	check.Err(err)
+	return NewCStringOnce(string(serialized))
+}
+
+// TraceEvents returns the gossipsub trace events kept in memory as JSON array in chronological order.
+// The array is empty if the trace buffer is disabled.
+//export TraceEvents
+func TraceEvents() CString {
+	serialized, err := json.Marshal(p2p.Instance().Trace.Events())
+	check.Err(err)
+	return NewCStringOnce(string(serialized))
+}
+
+// Metrics returns a snapshot of the metrics as JSON object,
+// containing the bandwidth in total and per protocol, the message counts per protocol and topic,
+// the validation rejects per reason, the queue depths and the connection counts.
+//export Metrics
+func Metrics() CString {
+	serialized, err := json.Marshal(p2p.Instance().Metrics())
+	check.Err(err)
+	return NewCStringOnce(string(serialized))
+}
+
+// Ping sends pings to a peer and returns the round-trip times as JSON object,
+// containing the round-trip time of each answered ping, the number of lost pings and the minimum,
+// average and maximum round-trip time in milliseconds.
+// The peer is dialed if necessary.
+// The peer ID as pointer to a C character (array) and the number of pings have to be given.
+// An empty string is returned if no ping could be sent, the error is stored in the error of the call.
+//export Ping
+func Ping(peerIdPtr *C.char, count int, errPtr *C.gop2p_error) CString {
+	peerID, err := peer.Decode(C.GoString(peerIdPtr))
+	if err != nil {
+		setError(errPtr, err)
+		return NewCStringOnce("")
+	}
+	result, err := p2p.Instance().Ping(peerID, count)
+	if err != nil {
+		setError(errPtr, err)
+		return NewCStringOnce("")
+	}
+	serialized, err := json.Marshal(result)
+	check.Err(err)
+	return NewCStringOnce(string(serialized))
+}
+
+// Latencies returns the latencies to the connected peers as JSON array,
+// containing the moving average of the round-trip times in milliseconds of each peer with a measured latency.
+//export Latencies
+func Latencies() CString {
+	serialized, err := json.Marshal(p2p.Instance().Latencies())
+	check.Err(err)
+	return NewCStringOnce(string(serialized))
+}
+
+// RateLimitOffenders returns the peers which exceeded a rate limit as JSON array,
+// containing the number of violations, the time and protocol of the last violation and the end of a ban.
+//export RateLimitOffenders
+func RateLimitOffenders() CString {
+	serialized, err := json.Marshal(p2p.Instance().RateLimiter.Offenders())
+	check.Err(err)
+	return NewCStringOnce(string(serialized))
+}
+
+// UnbanPeer lifts the ban of a peer and forgets its rate limit violations.
+// The peer ID as pointer to a C character (array) has to be given.
+// False is returned if the peer ID is invalid, the error is stored in the error of the call.
+//export UnbanPeer
+func UnbanPeer(peerIdPtr *C.char, errPtr *C.gop2p_error) bool {
+	peerID, err := peer.Decode(C.GoString(peerIdPtr))
+	if err != nil {
+		setError(errPtr, err)
+		return false
+	}
+	p2p.Instance().RateLimiter.Unban(peerID)
+	return true
+}
+
+// GenerateIdentityKey generates a new Ed25519 identity key.
+// The private key is returned in the base64 encoded libp2p protobuf format.
+// An empty string is returned if the key could not be generated, the error is stored in the error of the call.
+//export GenerateIdentityKey
+func GenerateIdentityKey(errPtr *C.gop2p_error) CString {
+	keyBytes, err := p2p.GenerateIdentityKey()
+	if err != nil {
+		setError(errPtr, err)
+		return NewCStringOnce("")
+	}
+	return NewCStringOnce(base64.StdEncoding.EncodeToString(keyBytes))
+}
+
+// IdentityPeerID derives the peer ID of an identity key.
+// The base64 encoded private key as pointer to a C character (array) has to be given.
+// An empty string is returned if the key is invalid, the error is stored in the error of the call.
+//export IdentityPeerID
+func IdentityPeerID(keyBase64Ptr *C.char, errPtr *C.gop2p_error) CString {
+	keyBytes, err := base64.StdEncoding.DecodeString(C.GoString(keyBase64Ptr))
+	if err != nil {
+		setError(errPtr, err)
+		return NewCStringOnce("")
+	}
+	peerID, err := p2p.IdentityPeerID(keyBytes)
+	if err != nil {
+		setError(errPtr, err)
+		return NewCStringOnce("")
+	}
+	return NewCStringOnce(peerID.Pretty())
+}
+
+// SaveIdentityKey stores an identity key in a passphrase-encrypted key file.
+// The file path, the passphrase and the base64 encoded private key as pointers to C characters (arrays) have to be given.
+// False is returned if the key could not be stored, the error is stored in the error of the call.
+//export SaveIdentityKey
+func SaveIdentityKey(pathPtr, passphrasePtr, keyBase64Ptr *C.char, errPtr *C.gop2p_error) bool {
+	keyBytes, err := base64.StdEncoding.DecodeString(C.GoString(keyBase64Ptr))
+	if err != nil {
+		setError(errPtr, err)
+		return false
+	}
+	err = p2p.SaveIdentityKey(C.GoString(pathPtr), C.GoString(passphrasePtr), keyBytes)
+	if err != nil {
+		setError(errPtr, err)
+		return false
+	}
+	return true
+}
+
+// LoadIdentityKey loads an identity key from a passphrase-encrypted key file.
+// The file path and the passphrase as pointers to C characters (arrays) have to be given.
+// The private key is returned in the base64 encoded libp2p protobuf format.
+// An empty string is returned if the key could not be loaded, the error is stored in the error of the call.
+//export LoadIdentityKey
+func LoadIdentityKey(pathPtr, passphrasePtr *C.char, errPtr *C.gop2p_error) CString {
+	keyBytes, err := p2p.LoadIdentityKey(C.GoString(pathPtr), C.GoString(passphrasePtr))
+	if err != nil {
+		setError(errPtr, err)
+		return NewCStringOnce("")
+	}
+	return NewCStringOnce(base64.StdEncoding.EncodeToString(keyBytes))
+}
+
+// AddressToPeerID derives the peer ID of a node using the key pair of an address.
+// The address as pointer to a C character (array) has to be given.
+// An empty string is returned if the address is invalid, the error is stored in the error of the call.
+//export AddressToPeerID
+func AddressToPeerID(addressPtr *C.char, errPtr *C.gop2p_error) CString {
+	peerID, err := p2p.AddressToPeerID(p2p.Address(C.GoString(addressPtr)))
+	if err != nil {
+		setError(errPtr, err)
+		return NewCStringOnce("")
+	}
+	return NewCStringOnce(peerID.Pretty())
+}
+
+// PeerIDToAddress derives the address of a peer ID embedding an Ed25519 public key.
+// The peer ID as pointer to a C character (array) has to be given.
+// An empty string is returned if no address can be derived, the error is stored in the error of the call.
+//export PeerIDToAddress
+func PeerIDToAddress(peerIdPtr *C.char, errPtr *C.gop2p_error) CString {
+	peerID, err := peer.Decode(C.GoString(peerIdPtr))
+	if err != nil {
+		setError(errPtr, err)
+		return NewCStringOnce("")
+	}
+	address, err := p2p.PeerIDToAddress(peerID)
+	if err != nil {
+		setError(errPtr, err)
+		return NewCStringOnce("")
+	}
+	return NewCStringOnce(string(address))
+}
+
+// PublishPeerRecord publishes a peer record binding the local peer ID to the player's address.
+// The record is republished periodically and stored in the DHT.
+// The base64 encoded raw Ed25519 private key of the player as pointer to a C character (array) has to be given.
+// False is returned if the record could not be published, the error is stored in the error of the call.
+//export PublishPeerRecord
+func PublishPeerRecord(privateKeyBase64Ptr *C.char, errPtr *C.gop2p_error) bool {
+	addressKey, err := p2p.DecodePlayerKey(C.GoString(privateKeyBase64Ptr))
+	if err != nil {
+		setError(errPtr, err)
+		return false
+	}
+	err = p2p.Instance().PublishPeerRecord(addressKey)
+	if err != nil {
+		setError(errPtr, err)
+		return false
+	}
+	return true
+}
+
+// LookupPeerRecord looks up the peer ID bound to an address by a verified peer record.
+// The address as pointer to a C character (array) has to be given.
+// An empty string is returned if no record is known.
+//export LookupPeerRecord
+func LookupPeerRecord(addressPtr *C.char) CString {
+	peerID, ok := p2p.Instance().PeerRecords.Lookup(p2p.Address(C.GoString(addressPtr)))
+	if !ok {
+		return NewCStringOnce("")
+	}
+	return NewCStringOnce(peerID.Pretty())
+}
+
+// ResolveAddress resolves the peer ID of an address using peer records, the DHT and the address key.
+// The address as pointer to a C character (array) has to be given.
+// An empty string is returned if the address could not be resolved, the error is stored in the error of the call.
+//export ResolveAddress
+func ResolveAddress(addressPtr *C.char, errPtr *C.gop2p_error) CString {
+	peerID, err := p2p.Instance().ResolveAddress(p2p.Address(C.GoString(addressPtr)))
+	if err != nil {
+		setError(errPtr, err)
+		return NewCStringOnce("")
+	}
+	return NewCStringOnce(peerID.Pretty())
+}
+
+// SendToAddress sends a message to the peer of an address.
+// The address is resolved and the peer is dialed if necessary.
+// The address and the serialized message as pointers to C characters (arrays) have to be given.
+// False is returned if the message could not be sent, the error is stored in the error of the call.
+//export SendToAddress
+func SendToAddress(addressPtr, serializedPtr *C.char, errPtr *C.gop2p_error) bool {
+	address := p2p.Address(C.GoString(addressPtr))
+	str := C.GoString(serializedPtr)
+	err := p2p.Instance().SendToAddress(address, []byte(str))
+	if err != nil {
+		setError(errPtr, err)
+		return false
+	}
+	return true
+}
+
+// SubscribeMessageType subscribes to a message type.
+// Once a message type is subscribed, messages of unsubscribed types are no longer delivered.
+// The serial name of the message type as pointer to a C character (array) has to be given.
+//export SubscribeMessageType
+func SubscribeMessageType(messageTypePtr *C.char) {
+	p2p.Instance().MessageTypes.Subscribe(C.GoString(messageTypePtr))
+}
+
+// UnsubscribeMessageType unsubscribes from a message type.
+// Messages of unsubscribed types are still not delivered, even if no message type is subscribed anymore.
+// The serial name of the message type as pointer to a C character (array) has to be given.
+//export UnsubscribeMessageType
+func UnsubscribeMessageType(messageTypePtr *C.char) {
+	p2p.Instance().MessageTypes.Unsubscribe(C.GoString(messageTypePtr))
+}
+
+// DeliverAllMessageTypes removes all message type subscriptions, messages of all types are delivered again.
+//export DeliverAllMessageTypes
+func DeliverAllMessageTypes() {
+	p2p.Instance().MessageTypes.DeliverAll()
+}
+
 // ListenPubSubBlocking listens for new messages.
 // This is a blocking function, waiting on a channel.
 //export ListenPubSubBlocking
@@ -78,6 +659,14 @@ func ListenPubSubBlocking() CString {
 	return NewCStringOnce(string(message))
 }
 
+// ListenAreaPubSubBlocking listens for new messages on the subscribed area-of-interest topics.
+// This is a blocking function, waiting on a channel.
+//export ListenAreaPubSubBlocking
+func ListenAreaPubSubBlocking() CString {
+	message := <-p2p.Instance().Areas.Messages
+	return NewCStringOnce(string(message))
+}
+
 // ListenStreamBlocking listens for new messages on the stream.
 // This is a blocking function, waiting on a channel.
 //export ListenStreamBlocking
@@ -89,21 +678,315 @@ func ListenStreamBlocking() CString {
 
 // SendPubSub sends a message to all known peers.
 // The serialized message as pointer to a C character (array) has to be given.
+// False is returned if the message could not be published, e.g. if it is invalid.
+// The error is stored in the error of the call.
 //export SendPubSub
-func SendPubSub(serialized *C.char) {
+func SendPubSub(serialized *C.char, errPtr *C.gop2p_error) bool {
+	str := C.GoString(serialized)
+	err := p2p.Instance().PubSub.Publish([]byte(str))
+	if err != nil {
+		setError(errPtr, err)
+		return false
+	}
+	return true
+}
+
+// SendAreaPubSub sends a message to all peers interested in a realm.
+// The realm indices and the serialized message as pointer to a C character (array) have to be given.
+// False is returned if the message could not be published, the error is stored in the error of the call.
+//export SendAreaPubSub
+func SendAreaPubSub(ix int, iy int, serialized *C.char, errPtr *C.gop2p_error) bool {
+	if ix < 0 || iy < 0 {
+		setError(errPtr, fmt.Errorf("invalid realm index %d/%d", ix, iy))
+		return false
+	}
 	str := C.GoString(serialized)
-	p2p.Instance().PubSub.Publish([]byte(str))
+	err := p2p.Instance().Areas.Publish(p2p.RealmIndex{X: uint32(ix), Y: uint32(iy)}, []byte(str))
+	if err != nil {
+		setError(errPtr, err)
+		return false
+	}
+	return true
+}
+
+// SetAreaInterest sets the realms the host is interested in.
+// The topics of the areas containing the realms are subscribed, all other area topics are unsubscribed.
+// The realms as JSON array of objects containing the indices ix and iy have to be given.
+// False is returned if the interest set could not be applied, the error is stored in the error of the call.
+//export SetAreaInterest
+func SetAreaInterest(realmsPtr *C.char, errPtr *C.gop2p_error) bool {
+	var realms []p2p.RealmIndex
+	if err := json.Unmarshal([]byte(C.GoString(realmsPtr)), &realms); err != nil {
+		setError(errPtr, err)
+		return false
+	}
+	if err := p2p.Instance().Areas.SetInterest(realms); err != nil {
+		setError(errPtr, err)
+		return false
+	}
+	return true
+}
+
+// SetAreaInterestAround sets the realms within a square around a realm as interest set.
+// The realm indices of the center and the radius in realms, at most p2p.MaxInterestRadius, have to be given.
+// False is returned if the interest set could not be applied, the error is stored in the error of the call.
+//export SetAreaInterestAround
+func SetAreaInterestAround(ix int, iy int, radius int, errPtr *C.gop2p_error) bool {
+	if ix < 0 || iy < 0 || radius < 0 || radius > p2p.MaxInterestRadius {
+		setError(errPtr, fmt.Errorf("invalid realm index %d/%d or radius %d", ix, iy, radius))
+		return false
+	}
+	realms := p2p.RealmsAround(p2p.RealmIndex{X: uint32(ix), Y: uint32(iy)}, uint32(radius))
+	if err := p2p.Instance().Areas.SetInterest(realms); err != nil {
+		setError(errPtr, err)
+		return false
+	}
+	return true
+}
+
+// AreaInterest returns the names of the subscribed area-of-interest topics as string bundle.
+//export AreaInterest
+func AreaInterest() CString {
+	return NewCStringOnce(strings.Join(p2p.Instance().Areas.Interest(), stringBundleDelimiter))
 }
 
 // SendStream sends a message to a specific peer.
+// Unknown peers are looked up using the routing layer.
 // The peer ID and the serialized message as pointer to a C character (array) must be given.
+// False is returned if the message could not be sent, the error is stored in the error of the call.
 //export SendStream
-func SendStream(peerIdPtr, serializedPtr *C.char) {
+func SendStream(peerIdPtr, serializedPtr *C.char, errPtr *C.gop2p_error) bool {
 	encodedPeerID := C.GoString(peerIdPtr)
 	peerID, err := peer.Decode(encodedPeerID)
-	check.Err(err)
+	if err != nil {
+		setError(errPtr, err)
+		return false
+	}
 	str := C.GoString(serializedPtr)
-	p2p.Instance().Stream.Send(peerID, []byte(str))
+	err = p2p.Instance().Stream.Send(peerID, []byte(str))
+	if err != nil {
+		setError(errPtr, err)
+		return false
+	}
+	return true
+}
+
+// FindPeer looks up the addresses of a peer using the routing layer.
+// The peer ID as pointer to a C character (array) has to be given.
+// The addresses are returned as string bundle.
+// A null pointer is returned if the peer was not found.
+// An empty string is returned if the lookup failed, the error is stored in the error of the call.
+//export FindPeer
+func FindPeer(peerIdPtr *C.char, errPtr *C.gop2p_error) CString {
+	peerID, err := peer.Decode(C.GoString(peerIdPtr))
+	if err != nil {
+		setError(errPtr, err)
+		return NewCStringOnce("")
+	}
+	peerInfo, err := p2p.Instance().FindPeer(peerID)
+	if errors.Is(err, routing.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		setError(errPtr, err)
+		return NewCStringOnce("")
+	}
+	addrs := make([]string, 0, len(peerInfo.Addrs))
+	for _, addr := range peerInfo.Addrs {
+		addrs = append(addrs, addr.String())
+	}
+	return NewCStringOnce(strings.Join(addrs, stringBundleDelimiter))
+}
+
+// Connect connects to a peer.
+// Either a peer ID or a multiaddress containing a peer ID as pointer to a C character (array) has to be given.
+// False is returned if the connection failed, the error is stored in the error of the call.
+//export Connect
+func Connect(targetPtr *C.char, errPtr *C.gop2p_error) bool {
+	err := p2p.Instance().Connect(C.GoString(targetPtr))
+	if err != nil {
+		setError(errPtr, err)
+		return false
+	}
+	return true
+}
+
+// Disconnect closes all connections to a peer.
+// The peer ID as pointer to a C character (array) has to be given.
+// False is returned if the peer could not be disconnected, the error is stored in the error of the call.
+//export Disconnect
+func Disconnect(peerIdPtr *C.char, errPtr *C.gop2p_error) bool {
+	peerID, err := peer.Decode(C.GoString(peerIdPtr))
+	if err != nil {
+		setError(errPtr, err)
+		return false
+	}
+	err = p2p.Instance().Disconnect(peerID)
+	if err != nil {
+		setError(errPtr, err)
+		return false
+	}
+	return true
+}
+
+// PutValue stores a value owned by the local peer in the DHT under /biotopium/<name>/<peer ID>.
+// The record name and the value as pointers to C characters (arrays) have to be given.
+// False is returned if the value could not be stored, the error is stored in the error of the call.
+//export PutValue
+func PutValue(namePtr, valuePtr *C.char, errPtr *C.gop2p_error) bool {
+	name := C.GoString(namePtr)
+	value := C.GoString(valuePtr)
+	err := p2p.Instance().PutValue(name, []byte(value))
+	if err != nil {
+		setError(errPtr, err)
+		return false
+	}
+	return true
+}
+
+// GetValue retrieves a value from the DHT.
+// The record name and the peer ID of the owner as pointers to C characters (arrays) have to be given.
+// A null pointer is returned if no value was found.
+// An empty string is returned if the value could not be retrieved, the error is stored in the error of the call.
+//export GetValue
+func GetValue(namePtr, ownerPtr *C.char, errPtr *C.gop2p_error) CString {
+	name := C.GoString(namePtr)
+	owner, err := peer.Decode(C.GoString(ownerPtr))
+	if err != nil {
+		setError(errPtr, err)
+		return NewCStringOnce("")
+	}
+	value, err := p2p.Instance().GetValue(name, owner)
+	if errors.Is(err, routing.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		setError(errPtr, err)
+		return NewCStringOnce("")
+	}
+	return NewCStringOnce(string(value))
+}
+
+// SearchValue searches the DHT exhaustively for the freshest value.
+// The record name and the peer ID of the owner as pointers to C characters (arrays) have to be given.
+// A null pointer is returned if no value was found.
+// An empty string is returned if the value could not be retrieved, the error is stored in the error of the call.
+//export SearchValue
+func SearchValue(namePtr, ownerPtr *C.char, errPtr *C.gop2p_error) CString {
+	name := C.GoString(namePtr)
+	owner, err := peer.Decode(C.GoString(ownerPtr))
+	if err != nil {
+		setError(errPtr, err)
+		return NewCStringOnce("")
+	}
+	value, err := p2p.Instance().SearchValue(name, owner)
+	if errors.Is(err, routing.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		setError(errPtr, err)
+		return NewCStringOnce("")
+	}
+	return NewCStringOnce(string(value))
+}
+
+// BlockHeight returns the number of blocks in the block store.
+// -1 is returned if the block store is disabled, the error is stored in the error of the call.
+//export BlockHeight
+func BlockHeight(errPtr *C.gop2p_error) int64 {
+	height, err := p2p.Instance().BlockHeight()
+	if err != nil {
+		setError(errPtr, err)
+		return -1
+	}
+	return int64(height)
+}
+
+// GetBlockChunk reads the next chunk of blocks within a height range from the block store.
+// The chunk is bounded in size, the range is continued by reading from the next height of the chunk until it is done.
+// The first and the last height (inclusive) have to be given.
+// The chunk is returned as JSON object containing the serialized blocks, the next height and whether it is done.
+// An empty string is returned if the blocks could not be read, the error is stored in the error of the call.
+//export GetBlockChunk
+func GetBlockChunk(from int64, to int64, errPtr *C.gop2p_error) CString {
+	if from < 0 || to < from {
+		setError(errPtr, fmt.Errorf("invalid height range %d to %d", from, to))
+		return NewCStringOnce("")
+	}
+	chunk, err := p2p.Instance().GetBlocks(uint64(from), uint64(to))
+	if err != nil {
+		setError(errPtr, err)
+		return NewCStringOnce("")
+	}
+	return marshalChunk(chunk, errPtr)
+}
+
+// FetchBlockChunk fetches the next chunk of blocks within a height range from a peer using the sync protocol.
+// The chunk is bounded in size, the range is continued by fetching from the next height of the chunk until it is done.
+// An interrupted transfer is resumed.
+// The peer ID and the hash of a known block as pointers to C characters (arrays),
+// the first and the last height (inclusive) have to be given.
+// If the hash is not empty, the blocks following the known block are fetched instead of the first height.
+// If the last height is negative, the blocks up to the head of the remote chain are fetched.
+// The chunk is returned as JSON object containing the serialized blocks, the next height and whether it is done.
+// An empty string is returned if the blocks could not be fetched, the error is stored in the error of the call.
+//export FetchBlockChunk
+func FetchBlockChunk(peerIdPtr, fromHashPtr *C.char, from int64, to int64, errPtr *C.gop2p_error) CString {
+	peerID, err := peer.Decode(C.GoString(peerIdPtr))
+	if err != nil {
+		setError(errPtr, err)
+		return NewCStringOnce("")
+	}
+	if from < 0 {
+		setError(errPtr, fmt.Errorf("invalid height %d", from))
+		return NewCStringOnce("")
+	}
+	request := p2p.SyncRequest{
+		From:     uint64(from),
+		FromHash: C.GoString(fromHashPtr),
+	}
+	if to >= 0 {
+		last := uint64(to)
+		request.To = &last
+	}
+	chunk, err := p2p.Instance().FetchChunk(peerID, request)
+	if err != nil {
+		setError(errPtr, err)
+		return NewCStringOnce("")
+	}
+	return marshalChunk(chunk, errPtr)
+}
+
+// marshalChunk serializes a chunk of blocks.
+// The chunk and the error of the call have to be given.
+// The chunk is returned as JSON object, an empty string if it could not be serialized.
+func marshalChunk(chunk *p2p.SyncChunk, errPtr *C.gop2p_error) CString {
+	serialized, err := json.Marshal(chunk)
+	if err != nil {
+		setError(errPtr, err)
+		return NewCStringOnce("")
+	}
+	return NewCStringOnce(string(serialized))
+}
+
+// SyncChain fetches the blocks following the stored chain from a peer.
+// The blocks are validated and appended to the block store.
+// The peer ID as pointer to a C character (array) has to be given.
+// The number of stored blocks is returned,
+// -1 is returned if the chain could not be synchronized, the error is stored in the error of the call.
+//export SyncChain
+func SyncChain(peerIdPtr *C.char, errPtr *C.gop2p_error) int64 {
+	peerID, err := peer.Decode(C.GoString(peerIdPtr))
+	if err != nil {
+		setError(errPtr, err)
+		return -1
+	}
+	stored, err := p2p.Instance().SyncChain(peerID)
+	if err != nil {
+		setError(errPtr, err)
+		return -1
+	}
+	return int64(stored)
 }
 
 func main() {}
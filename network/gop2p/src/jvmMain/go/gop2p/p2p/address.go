@@ -0,0 +1,112 @@
+/*
+ * Copyright (c) 2021 The biotopium Authors.
+ * This file is part of biotopium.
+ *
+ * biotopium is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * biotopium is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with biotopium.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package p2p
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"fmt"
+	"github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+// Address represents a biotopium address.
+// An address is the base64 encoded raw Ed25519 public key of a player.
+type Address string
+
+// DecodeAddress decodes an address.
+// The address has to be given.
+// The Ed25519 public key of the address is returned.
+func DecodeAddress(address Address) (crypto.PubKey, error) {
+	raw, err := base64.StdEncoding.DecodeString(string(address))
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid address length: %d", len(raw))
+	}
+	return crypto.UnmarshalEd25519PublicKey(raw)
+}
+
+// AddressFromPublicKey encodes an Ed25519 public key as address.
+// The public key has to be given.
+// The address is returned.
+func AddressFromPublicKey(publicKey crypto.PubKey) (Address, error) {
+	if publicKey.Type() != crypto.Ed25519 {
+		return "", fmt.Errorf("addresses require an Ed25519 key")
+	}
+	raw, err := publicKey.Raw()
+	if err != nil {
+		return "", err
+	}
+	return Address(base64.StdEncoding.EncodeToString(raw)), nil
+}
+
+// AddressToPeerID derives the peer ID of a node using the key pair of an address.
+// The address has to be given.
+// The peer ID is returned.
+func AddressToPeerID(address Address) (peer.ID, error) {
+	publicKey, err := DecodeAddress(address)
+	if err != nil {
+		return "", err
+	}
+	return peer.IDFromPublicKey(publicKey)
+}
+
+// PeerIDToAddress derives the address of a peer ID.
+// This is only possible if the peer ID embeds an Ed25519 public key.
+// The peer ID has to be given.
+// The address is returned.
+func PeerIDToAddress(peerID peer.ID) (Address, error) {
+	publicKey, err := peerID.ExtractPublicKey()
+	if err != nil {
+		return "", err
+	}
+	return AddressFromPublicKey(publicKey)
+}
+
+// DecodePlayerKey decodes the private key of a player's key pair.
+// The base64 encoded raw Ed25519 private key, either the 32 byte seed or the
+// 64 byte seed and public key concatenation, has to be given.
+// The private key is returned.
+func DecodePlayerKey(privateKeyBase64 string) (crypto.PrivKey, error) {
+	raw, err := base64.StdEncoding.DecodeString(privateKeyBase64)
+	if err != nil {
+		return nil, err
+	}
+	switch len(raw) {
+	case ed25519.SeedSize:
+		raw = ed25519.NewKeyFromSeed(raw)
+	case ed25519.PrivateKeySize:
+	default:
+		return nil, fmt.Errorf("invalid private key length: %d", len(raw))
+	}
+	return crypto.UnmarshalEd25519PrivateKey(raw)
+}
+
+// PlayerIdentityKey converts the private key of a player's key pair into an identity key.
+// The base64 encoded raw Ed25519 private key has to be given.
+// The private key, marshalled in the libp2p protobuf format, is returned.
+func PlayerIdentityKey(privateKeyBase64 string) ([]byte, error) {
+	privateKey, err := DecodePlayerKey(privateKeyBase64)
+	if err != nil {
+		return nil, err
+	}
+	return crypto.MarshalPrivateKey(privateKey)
+}
@@ -0,0 +1,161 @@
+/*
+ * Copyright (c) 2021 The biotopium Authors.
+ * This file is part of biotopium.
+ *
+ * biotopium is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * biotopium is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with biotopium.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package p2p
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+// peerRecordName is the DHT record name under which peer records are stored.
+// The record is owned by the peer ID derived from the address key.
+const peerRecordName = "peer-record"
+
+// AddressUnreachableError is returned if no peer could be resolved or reached for an address.
+type AddressUnreachableError struct {
+	Address Address // unreachable address
+	Err     error   // cause
+}
+
+// Error returns the error message.
+func (e *AddressUnreachableError) Error() string {
+	return fmt.Sprintf("address %s unreachable: %v", e.Address, e.Err)
+}
+
+// Unwrap returns the cause of the error.
+func (e *AddressUnreachableError) Unwrap() error {
+	return e.Err
+}
+
+// PublishPeerRecord publishes the local peer record on pubsub and stores the same record in the DHT.
+// Storing the record in the DHT is best effort, a failure is logged as peers still learn the record on pubsub.
+// The address key of the local player has to be given.
+func (s *Server) PublishPeerRecord(addressKey crypto.PrivKey) error {
+	serialized, err := s.PeerRecords.Publish(addressKey)
+	if err != nil {
+		return err
+	}
+	if err := s.putSignedValue(peerRecordName, serialized, addressKey); err != nil {
+		logger.Warnw("Failed to store peer record in the DHT", "error", err)
+	}
+	return nil
+}
+
+// lookupPeerRecord looks up the peer record of an address in the DHT.
+// Found records are verified and added to the peer record book.
+// The address has to be given.
+// The verified peer record is returned.
+func (s *Server) lookupPeerRecord(address Address) (*PeerRecord, error) {
+	owner, err := AddressToPeerID(address)
+	if err != nil {
+		return nil, err
+	}
+	serialized, err := s.GetValue(peerRecordName, owner)
+	if err != nil {
+		return nil, err
+	}
+	rec := &PeerRecord{}
+	if err := json.Unmarshal(serialized, rec); err != nil {
+		return nil, err
+	}
+	if rec.Address != address {
+		return nil, fmt.Errorf("peer record of %s stored for %s", rec.Address, address)
+	}
+	identityKey, err := rec.PeerID.ExtractPublicKey()
+	if err != nil {
+		return nil, err
+	}
+	if err := rec.Verify(identityKey); err != nil {
+		return nil, err
+	}
+	s.PeerRecords.add(rec)
+	return rec, nil
+}
+
+// ResolveAddress resolves the peer ID of an address.
+// Known peer records are used first, then the DHT is searched for a peer record.
+// Finally, the peer ID derived from the address key is tried,
+// which is used by nodes running with the player's key as identity.
+// The address has to be given.
+// The peer ID is returned, the error is an AddressUnreachableError.
+func (s *Server) ResolveAddress(address Address) (peer.ID, error) {
+	if peerID, ok := s.PeerRecords.Lookup(address); ok {
+		return peerID, nil
+	}
+	rec, lookupErr := s.lookupPeerRecord(address)
+	if lookupErr == nil {
+		return rec.PeerID, nil
+	}
+	derived, err := AddressToPeerID(address)
+	if err != nil {
+		return "", &AddressUnreachableError{Address: address, Err: err}
+	}
+	if err := s.ensureConnected(derived); err != nil {
+		return "", &AddressUnreachableError{
+			Address: address,
+			Err:     fmt.Errorf("no peer record found (%v) and derived peer unreachable (%v)", lookupErr, err),
+		}
+	}
+	return derived, nil
+}
+
+// SendToAddress sends a message to the peer of an address.
+// If the known peer cannot be reached, the known record is kept
+// and the message is only sent again if a newer record is found in the DHT.
+// The address and the serialized message have to be given.
+// The error is an AddressUnreachableError if the address could not be resolved or reached.
+func (s *Server) SendToAddress(address Address, serialized []byte) error {
+	peerID, err := s.ResolveAddress(address)
+	if err != nil {
+		return err
+	}
+	err = s.Stream.Send(peerID, serialized)
+	if err == nil {
+		return nil
+	}
+
+	// the known record might be outdated, a failed send alone does not prove it though
+	retryPeerID, ok := s.refreshPeerRecord(address)
+	if !ok || retryPeerID == peerID {
+		return &AddressUnreachableError{Address: address, Err: err}
+	}
+	if err := s.Stream.Send(retryPeerID, serialized); err != nil {
+		return &AddressUnreachableError{Address: address, Err: err}
+	}
+	return nil
+}
+
+// refreshPeerRecord looks up the peer record of an address in the DHT again.
+// The known record is only replaced if the looked up record is newer.
+// The address has to be given.
+// The peer ID of the looked up record and whether it is newer than the known record are returned.
+func (s *Server) refreshPeerRecord(address Address) (peer.ID, bool) {
+	known, hasKnown := s.PeerRecords.record(address)
+	rec, err := s.lookupPeerRecord(address)
+	if err != nil {
+		logger.Debugw("Failed to refresh peer record", "address", address, "error", err)
+		return "", false
+	}
+	if hasKnown && rec.Seq <= known.Seq {
+		return "", false
+	}
+	return rec.PeerID, true
+}
@@ -0,0 +1,312 @@
+/*
+ * Copyright (c) 2021 The biotopium Authors.
+ * This file is part of biotopium.
+ *
+ * biotopium is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * biotopium is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with biotopium.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package p2p
+
+import (
+	"context"
+	"fmt"
+	"github.com/libp2p/go-libp2p-core/peer"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	"sort"
+	"sync"
+)
+
+// DefaultAreaSize is the default number of realms per side of an area.
+// By default, each realm has its own topic.
+const DefaultAreaSize = 1
+
+// MaxInterestAreas is the maximum number of areas in the interest set.
+const MaxInterestAreas = 81
+
+// MaxInterestRadius is the maximum radius in realms of a square of realms of interest.
+const MaxInterestRadius = 32
+
+// areaSegment separates the public topic and the area indices in the names of area topics.
+const areaSegment = "/area/"
+
+// maxIdleAreas is the maximum number of joined area topics outside of the interest set.
+// If exceeded, the least recently used topics are left.
+const maxIdleAreas = 16
+
+// ErrTooManyAreas is returned if the realms of interest span more than MaxInterestAreas areas.
+var ErrTooManyAreas = fmt.Errorf("interest set exceeds %d areas", MaxInterestAreas)
+
+// RealmIndex identifies a realm by its indices in 2-dimensional space, like the realms of the core module.
+type RealmIndex struct {
+	X uint32 `json:"ix"` // horizontal realm index
+	Y uint32 `json:"iy"` // vertical realm index
+}
+
+// RealmsAround returns the realms within a square around a realm.
+// Realms with negative indices do not exist, hence the square is cut off at the origin.
+// The realm in the center and the radius in realms have to be given.
+func RealmsAround(center RealmIndex, radius uint32) []RealmIndex {
+	var realms []RealmIndex
+	minX, minY := saturatingSub(center.X, radius), saturatingSub(center.Y, radius)
+	for x := minX; x <= center.X+radius && x >= minX; x++ {
+		for y := minY; y <= center.Y+radius && y >= minY; y++ {
+			realms = append(realms, RealmIndex{X: x, Y: y})
+		}
+	}
+	return realms
+}
+
+// saturatingSub subtracts two unsigned integers, the result is cut off at 0.
+// The minuend and the subtrahend have to be given.
+func saturatingSub(a uint32, b uint32) uint32 {
+	if b > a {
+		return 0
+	}
+	return a - b
+}
+
+// area represents a square of realms sharing a topic.
+type area struct {
+	x uint32 // horizontal area index
+	y uint32 // vertical area index
+}
+
+// AreaTopics manages the area-of-interest topics.
+// The world is divided into areas of realms, each area has its own topic derived from the public topic.
+// Only the topics of the areas in the interest set are subscribed,
+// messages received on them are delivered to a single channel.
+// Topics of areas left or only published to are unsubscribed but stay joined, hence they are rejoined cheaply.
+// At most maxIdleAreas of these idle topics stay joined, the least recently used ones are left.
+type AreaTopics struct {
+	Messages chan Message // Message input channel
+
+	mutex        sync.Mutex
+	ctx          context.Context          // Context
+	ps           *pubsub.PubSub           // PubSub instance
+	base         string                   // name of the public topic the area topics are derived from
+	size         uint32                   // number of realms per side of an area
+	peerID       peer.ID                  // Peer ID
+	filter       *MessageTypeFilter       // message type filter
+	compress     bool                     // whether to publish compressed messages
+	encodeBinary bool                     // whether to publish binary encoded messages
+	stats        *CompressionStats        // compression statistics
+	metrics      *Metrics                 // traffic metrics
+	register     func(topic string) error // registers the validator of a topic
+	topics       map[area]*PubSubTopic    // joined area topics
+	interest     map[area]bool            // subscribed areas
+	idle         []area                   // joined areas outside of the interest set, least recently used first
+}
+
+// newAreaTopics is the factory function of the AreaTopics struct.
+// The public topic, the area size and the encoding are taken from the configuration of the server,
+// messages are filtered by its message type filter, counted in its statistics and metrics and validated by its topic validator.
+// A context, a pubsub and the server have to be given.
+// A pointer to the new area topics is returned.
+func newAreaTopics(ctx context.Context, ps *pubsub.PubSub, s *Server) *AreaTopics {
+	size := s.Config.AreaSize
+	if size == 0 {
+		size = DefaultAreaSize
+	}
+	a := &AreaTopics{
+		Messages:     make(chan Message, PubSubBufSize),
+		ctx:          ctx,
+		ps:           ps,
+		base:         s.Config.Topic,
+		size:         size,
+		peerID:       s.Host.ID(),
+		filter:       s.MessageTypes,
+		compress:     s.Config.CompressPubSub,
+		encodeBinary: s.Config.BinaryPubSub,
+		stats:        s.Compression,
+		metrics:      s.Traffic,
+		topics:       make(map[area]*PubSubTopic),
+		interest:     make(map[area]bool),
+	}
+	a.register = func(topic string) error {
+		return ps.RegisterTopicValidator(topic, s.topicValidator())
+	}
+	return a
+}
+
+// areaOf determines the area containing a realm.
+// The realm has to be given.
+func (a *AreaTopics) areaOf(realm RealmIndex) area {
+	return area{x: realm.X / a.size, y: realm.Y / a.size}
+}
+
+// TopicName returns the name of the topic of the area containing a realm.
+// The realm has to be given.
+func (a *AreaTopics) TopicName(realm RealmIndex) string {
+	return a.topicName(a.areaOf(realm))
+}
+
+// topicName returns the name of the topic of an area.
+// The area has to be given.
+func (a *AreaTopics) topicName(ar area) string {
+	return fmt.Sprintf("%s%s%d/%d", a.base, areaSegment, ar.x, ar.y)
+}
+
+// join joins the topic of an area if not joined yet, the lock has to be held.
+// The validator and the score parameters are set on all variants of the topic.
+// If joining fails, the registered validators are unregistered again.
+// The area has to be given.
+// A pointer to the joined topic is returned.
+func (a *AreaTopics) join(ar area) (_ *PubSubTopic, err error) {
+	if t, ok := a.topics[ar]; ok {
+		return t, nil
+	}
+	name := a.topicName(ar)
+	var registered []string
+	defer func() {
+		if err != nil {
+			a.unregister(registered)
+		}
+	}()
+	for _, variant := range []string{name, compressedVariant(name), binaryVariant(name)} {
+		if err := a.register(variant); err != nil {
+			return nil, err
+		}
+		registered = append(registered, variant)
+	}
+	t, err := joinTopic(a.ctx, a.ps, name, a.peerID, a.filter, a.compress, a.encodeBinary, a.stats, a.metrics)
+	if err != nil {
+		return nil, err
+	}
+	for _, topic := range []*pubsub.Topic{t.topic, t.compressed, t.binary} {
+		if err := topic.SetScoreParams(topicScoreParams()); err != nil {
+			_ = t.close()
+			return nil, err
+		}
+	}
+	a.topics[ar] = t
+	return t, nil
+}
+
+// leave leaves the unsubscribed topic of an area and unregisters its validators, the lock has to be held.
+// The area has to be given.
+func (a *AreaTopics) leave(ar area) error {
+	t, ok := a.topics[ar]
+	if !ok {
+		return nil
+	}
+	if err := t.close(); err != nil {
+		return err
+	}
+	delete(a.topics, ar)
+	a.unregister([]string{t.name, compressedVariant(t.name), binaryVariant(t.name)})
+	return nil
+}
+
+// unregister unregisters the validators of topics.
+// The topic names have to be given.
+func (a *AreaTopics) unregister(topics []string) {
+	for _, topic := range topics {
+		if err := a.ps.UnregisterTopicValidator(topic); err != nil {
+			logger.Warnw("Could not unregister area topic validator", "topic", topic, "error", err)
+		}
+	}
+}
+
+// markIdle marks an area outside of the interest set as most recently used, the lock has to be held.
+// If too many idle topics are joined, the least recently used ones are left.
+// The area has to be given.
+func (a *AreaTopics) markIdle(ar area) {
+	a.removeIdle(ar)
+	a.idle = append(a.idle, ar)
+	for len(a.idle) > maxIdleAreas {
+		if err := a.leave(a.idle[0]); err != nil {
+			logger.Warnw("Could not leave area topic", "topic", a.topicName(a.idle[0]), "error", err)
+		}
+		a.idle = a.idle[1:]
+	}
+}
+
+// removeIdle removes an area from the idle areas, the lock has to be held.
+// The area has to be given.
+func (a *AreaTopics) removeIdle(ar area) {
+	for i, idle := range a.idle {
+		if idle == ar {
+			a.idle = append(a.idle[:i], a.idle[i+1:]...)
+			return
+		}
+	}
+}
+
+// SetInterest sets the realms the host is interested in.
+// The topics of the areas containing the realms are subscribed, the topics of all other areas are unsubscribed.
+// The realms of interest, spanning at most MaxInterestAreas areas, have to be given.
+func (a *AreaTopics) SetInterest(realms []RealmIndex) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	interest := make(map[area]bool)
+	for _, realm := range realms {
+		interest[a.areaOf(realm)] = true
+		if len(interest) > MaxInterestAreas {
+			return ErrTooManyAreas
+		}
+	}
+	for ar := range a.interest {
+		if !interest[ar] {
+			a.topics[ar].unsubscribe()
+			delete(a.interest, ar)
+			a.markIdle(ar)
+		}
+	}
+	for ar := range interest {
+		if a.interest[ar] {
+			continue
+		}
+		t, err := a.join(ar)
+		if err != nil {
+			return err
+		}
+		a.removeIdle(ar)
+		if _, err := t.subscribe(a.Messages); err != nil {
+			a.markIdle(ar)
+			return err
+		}
+		a.interest[ar] = true
+	}
+	return nil
+}
+
+// Interest returns the sorted names of the subscribed area topics.
+func (a *AreaTopics) Interest() []string {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	names := make([]string, 0, len(a.interest))
+	for ar := range a.interest {
+		names = append(names, a.topicName(ar))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Publish publishes a message to the topic of the area containing a realm.
+// The realm does not have to be in the interest set, its topic is then joined as idle topic.
+// The realm and the message have to be given.
+func (a *AreaTopics) Publish(realm RealmIndex, message []byte) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	ar := a.areaOf(realm)
+	t, err := a.join(ar)
+	if err != nil {
+		return err
+	}
+	if !a.interest[ar] {
+		defer a.markIdle(ar)
+	}
+	return t.Publish(message)
+}
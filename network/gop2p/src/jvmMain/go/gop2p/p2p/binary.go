@@ -0,0 +1,471 @@
+/*
+ * Copyright (c) 2021 The biotopium Authors.
+ * This file is part of biotopium.
+ *
+ * biotopium is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * biotopium is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with biotopium.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package p2p
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// binarySuffix is appended to protocol IDs and topic names of the variants using the binary encoding.
+// Peers not supporting the binary encoding neither negotiate the protocol nor join the topic.
+const binarySuffix = "/cbor"
+
+// CBOR major types.
+const (
+	cborUnsigned byte = 0 << 5
+	cborNegative byte = 1 << 5
+	cborBytes    byte = 2 << 5
+	cborText     byte = 3 << 5
+	cborArray    byte = 4 << 5
+	cborMap      byte = 5 << 5
+	cborTag      byte = 6 << 5
+	cborSimple   byte = 7 << 5
+)
+
+// CBOR simple values and special bytes.
+const (
+	cborFalse      byte = cborSimple | 20
+	cborTrue       byte = cborSimple | 21
+	cborNull       byte = cborSimple | 22
+	cborFloat64    byte = cborSimple | 27
+	cborIndefinite byte = 31
+	cborBreak      byte = 0xff
+)
+
+// CBOR tags of byte strings, see RFC 8949 section 3.4.5.2.
+const (
+	cborTagBase64 uint64 = 22 // expected conversion to base64
+	cborTagBase16 uint64 = 23 // expected conversion to base16
+)
+
+// Limits of the binary encoding.
+const (
+	minByteStringSize = 16 // minimum length of a string to be encoded as byte string
+	maxBinaryDepth    = 64 // maximum nesting depth of decoded values
+)
+
+// binaryKeys is the dictionary of property names encoded as integers.
+// The dictionary is part of the wire format, names may only be appended.
+var binaryKeys = []string{
+	"peerId", "message", "class", "height", "timestamp", "prevHash", "author", "data", "hash", "sign",
+	"content", "produce", "consume", "type", "x", "y", "owner", "plantType", "plant", "growth",
+	"seeds", "hoes", "realmClaimPaper", "ix", "iy", "block", "blocks", "action", "text", "address",
+}
+
+// binaryKeyIndex maps property names to their integer encoding.
+var binaryKeyIndex = func() map[string]uint64 {
+	index := make(map[string]uint64, len(binaryKeys))
+	for i, key := range binaryKeys {
+		index[key] = uint64(i)
+	}
+	return index
+}()
+
+// ErrMalformedBinary is returned if a binary encoded payload cannot be decoded.
+var ErrMalformedBinary = errors.New("malformed binary payload")
+
+// binaryVariant returns the binary encoded variant of a protocol ID or topic name.
+// The protocol ID or topic name has to be given.
+func binaryVariant(name string) string {
+	return name + binarySuffix
+}
+
+// isBinary checks whether a payload is binary encoded.
+// Binary encoded messages are CBOR maps, while JSON messages start with a curly bracket.
+// The payload has to be given.
+func isBinary(payload []byte) bool {
+	return len(payload) > 0 && payload[0]&0xe0 == cborMap
+}
+
+// EncodeBinary transcodes a JSON value into its compact binary encoding.
+// The binary encoding is CBOR, which preserves the order of object properties.
+// Known property names are encoded as integers, hex and base64 strings as tagged byte strings.
+// The JSON value has to be given.
+// The binary encoded value is returned.
+func EncodeBinary(serialized []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(serialized))
+	decoder.UseNumber()
+	var buf bytes.Buffer
+	if err := encodeBinaryValue(decoder, &buf); err != nil {
+		return nil, err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, errors.New("trailing data after JSON value")
+	}
+	return buf.Bytes(), nil
+}
+
+// encodeBinaryValue encodes the next JSON value of a decoder.
+// The decoder and the buffer to write to have to be given.
+func encodeBinaryValue(decoder *json.Decoder, buf *bytes.Buffer) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+	switch value := token.(type) {
+	case json.Delim:
+		switch value {
+		case '{':
+			buf.WriteByte(cborMap | cborIndefinite)
+			for decoder.More() {
+				keyToken, err := decoder.Token()
+				if err != nil {
+					return err
+				}
+				key := keyToken.(string)
+				if index, ok := binaryKeyIndex[key]; ok {
+					writeHead(buf, cborUnsigned, index)
+				} else {
+					writeText(buf, key)
+				}
+				if err := encodeBinaryValue(decoder, buf); err != nil {
+					return err
+				}
+			}
+		case '[':
+			buf.WriteByte(cborArray | cborIndefinite)
+			for decoder.More() {
+				if err := encodeBinaryValue(decoder, buf); err != nil {
+					return err
+				}
+			}
+		default:
+			return fmt.Errorf("unexpected delimiter %s", value)
+		}
+		// consume the closing delimiter
+		if _, err := decoder.Token(); err != nil {
+			return err
+		}
+		buf.WriteByte(cborBreak)
+	case string:
+		writeString(buf, value)
+	case json.Number:
+		writeNumber(buf, value)
+	case bool:
+		if value {
+			buf.WriteByte(cborTrue)
+		} else {
+			buf.WriteByte(cborFalse)
+		}
+	case nil:
+		buf.WriteByte(cborNull)
+	}
+	return nil
+}
+
+// writeHead writes the head of a CBOR data item.
+// The buffer, the major type and the argument have to be given.
+func writeHead(buf *bytes.Buffer, major byte, argument uint64) {
+	switch {
+	case argument < 24:
+		buf.WriteByte(major | byte(argument))
+	case argument <= math.MaxUint8:
+		buf.WriteByte(major | 24)
+		buf.WriteByte(byte(argument))
+	case argument <= math.MaxUint16:
+		buf.WriteByte(major | 25)
+		_ = binary.Write(buf, binary.BigEndian, uint16(argument))
+	case argument <= math.MaxUint32:
+		buf.WriteByte(major | 26)
+		_ = binary.Write(buf, binary.BigEndian, uint32(argument))
+	default:
+		buf.WriteByte(major | 27)
+		_ = binary.Write(buf, binary.BigEndian, argument)
+	}
+}
+
+// writeText writes a CBOR text string.
+// The buffer and the string have to be given.
+func writeText(buf *bytes.Buffer, value string) {
+	writeHead(buf, cborText, uint64(len(value)))
+	buf.WriteString(value)
+}
+
+// writeString writes a string, hex and base64 strings are written as tagged byte strings.
+// Only strings which are restored exactly are written as byte strings.
+// The buffer and the string have to be given.
+func writeString(buf *bytes.Buffer, value string) {
+	if len(value) >= minByteStringSize {
+		if decoded, err := hex.DecodeString(value); err == nil && hex.EncodeToString(decoded) == value {
+			writeHead(buf, cborTag, cborTagBase16)
+			writeHead(buf, cborBytes, uint64(len(decoded)))
+			buf.Write(decoded)
+			return
+		}
+		if decoded, err := base64.StdEncoding.DecodeString(value); err == nil && base64.StdEncoding.EncodeToString(decoded) == value {
+			writeHead(buf, cborTag, cborTagBase64)
+			writeHead(buf, cborBytes, uint64(len(decoded)))
+			buf.Write(decoded)
+			return
+		}
+	}
+	writeText(buf, value)
+}
+
+// writeNumber writes a JSON number as CBOR integer or, if it is not an integer, as float.
+// The buffer and the number have to be given.
+func writeNumber(buf *bytes.Buffer, value json.Number) {
+	if unsigned, err := strconv.ParseUint(value.String(), 10, 64); err == nil {
+		writeHead(buf, cborUnsigned, unsigned)
+		return
+	}
+	if signed, err := strconv.ParseInt(value.String(), 10, 64); err == nil {
+		writeHead(buf, cborNegative, uint64(-(signed + 1)))
+		return
+	}
+	float, _ := value.Float64()
+	buf.WriteByte(cborFloat64)
+	_ = binary.Write(buf, binary.BigEndian, math.Float64bits(float))
+}
+
+// DecodeBinary transcodes a binary encoded value into JSON.
+// The binary encoded value has to be given.
+// The JSON value is returned.
+func DecodeBinary(encoded []byte) ([]byte, error) {
+	reader := bufio.NewReader(bytes.NewReader(encoded))
+	var buf bytes.Buffer
+	if err := decodeBinaryValue(reader, &buf, 0); err != nil {
+		return nil, err
+	}
+	if _, err := reader.ReadByte(); err != io.EOF {
+		return nil, fmt.Errorf("%w: trailing data", ErrMalformedBinary)
+	}
+	return buf.Bytes(), nil
+}
+
+// readHead reads the head of a CBOR data item.
+// The reader has to be given.
+// The major type, the additional information and the argument are returned.
+func readHead(reader *bufio.Reader) (byte, byte, uint64, error) {
+	initial, err := reader.ReadByte()
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	major, info := initial&0xe0, initial&0x1f
+	var size int
+	switch {
+	case info < 24:
+		return major, info, uint64(info), nil
+	case info == 24:
+		size = 1
+	case info == 25:
+		size = 2
+	case info == 26:
+		size = 4
+	case info == 27:
+		size = 8
+	case info == cborIndefinite:
+		return major, info, 0, nil
+	default:
+		return 0, 0, 0, fmt.Errorf("%w: reserved additional information %d", ErrMalformedBinary, info)
+	}
+	argument := make([]byte, 8)
+	if _, err := io.ReadFull(reader, argument[8-size:]); err != nil {
+		return 0, 0, 0, err
+	}
+	return major, info, binary.BigEndian.Uint64(argument), nil
+}
+
+// readBytes reads the content of a byte or text string.
+// The reader and the length have to be given.
+func readBytes(reader *bufio.Reader, length uint64) ([]byte, error) {
+	if length > maxDecompressedSize {
+		return nil, fmt.Errorf("%w: string too long", ErrMalformedBinary)
+	}
+	content := make([]byte, length)
+	_, err := io.ReadFull(reader, content)
+	return content, err
+}
+
+// isBreak checks whether the next byte is the break of an indefinite-length item and consumes it.
+// The reader has to be given.
+func isBreak(reader *bufio.Reader) (bool, error) {
+	next, err := reader.Peek(1)
+	if err != nil {
+		return false, err
+	}
+	if next[0] != cborBreak {
+		return false, nil
+	}
+	_, err = reader.ReadByte()
+	return true, err
+}
+
+// decodeBinaryValue decodes the next CBOR data item into JSON.
+// The reader, the buffer to write to and the nesting depth have to be given.
+func decodeBinaryValue(reader *bufio.Reader, buf *bytes.Buffer, depth int) error {
+	if depth > maxBinaryDepth {
+		return fmt.Errorf("%w: nesting too deep", ErrMalformedBinary)
+	}
+	major, info, argument, err := readHead(reader)
+	if err != nil {
+		return err
+	}
+	switch major {
+	case cborUnsigned:
+		buf.WriteString(strconv.FormatUint(argument, 10))
+	case cborNegative:
+		if argument > math.MaxInt64 {
+			return fmt.Errorf("%w: integer out of range", ErrMalformedBinary)
+		}
+		buf.WriteString(strconv.FormatInt(-int64(argument)-1, 10))
+	case cborText:
+		content, err := readBytes(reader, argument)
+		if err != nil {
+			return err
+		}
+		writeJSONString(buf, string(content))
+	case cborTag:
+		tagMajor, _, length, err := readHead(reader)
+		if err != nil {
+			return err
+		}
+		if tagMajor != cborBytes {
+			return fmt.Errorf("%w: unsupported tagged item", ErrMalformedBinary)
+		}
+		content, err := readBytes(reader, length)
+		if err != nil {
+			return err
+		}
+		switch argument {
+		case cborTagBase16:
+			writeJSONString(buf, hex.EncodeToString(content))
+		case cborTagBase64:
+			writeJSONString(buf, base64.StdEncoding.EncodeToString(content))
+		default:
+			return fmt.Errorf("%w: unsupported tag %d", ErrMalformedBinary, argument)
+		}
+	case cborArray:
+		if info != cborIndefinite {
+			return fmt.Errorf("%w: definite-length array", ErrMalformedBinary)
+		}
+		buf.WriteByte('[')
+		for i := 0; ; i++ {
+			done, err := isBreak(reader)
+			if err != nil {
+				return err
+			}
+			if done {
+				break
+			}
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := decodeBinaryValue(reader, buf, depth+1); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	case cborMap:
+		if info != cborIndefinite {
+			return fmt.Errorf("%w: definite-length map", ErrMalformedBinary)
+		}
+		buf.WriteByte('{')
+		for i := 0; ; i++ {
+			done, err := isBreak(reader)
+			if err != nil {
+				return err
+			}
+			if done {
+				break
+			}
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := decodeBinaryKey(reader, buf); err != nil {
+				return err
+			}
+			buf.WriteByte(':')
+			if err := decodeBinaryValue(reader, buf, depth+1); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	case cborSimple:
+		switch info {
+		case 20:
+			buf.WriteString("false")
+		case 21:
+			buf.WriteString("true")
+		case 22:
+			buf.WriteString("null")
+		case 27:
+			float := math.Float64frombits(argument)
+			if math.IsNaN(float) || math.IsInf(float, 0) {
+				return fmt.Errorf("%w: non-finite number", ErrMalformedBinary)
+			}
+			formatted := strconv.FormatFloat(float, 'g', -1, 64)
+			if !strings.ContainsAny(formatted, ".e") {
+				formatted += ".0"
+			}
+			buf.WriteString(formatted)
+		default:
+			return fmt.Errorf("%w: unsupported simple value %d", ErrMalformedBinary, info)
+		}
+	default:
+		return fmt.Errorf("%w: unsupported major type %d", ErrMalformedBinary, major>>5)
+	}
+	return nil
+}
+
+// decodeBinaryKey decodes a property name, either from the dictionary or as text.
+// The reader and the buffer to write to have to be given.
+func decodeBinaryKey(reader *bufio.Reader, buf *bytes.Buffer) error {
+	major, _, argument, err := readHead(reader)
+	if err != nil {
+		return err
+	}
+	switch major {
+	case cborUnsigned:
+		if argument >= uint64(len(binaryKeys)) {
+			return fmt.Errorf("%w: unknown key %d", ErrMalformedBinary, argument)
+		}
+		writeJSONString(buf, binaryKeys[argument])
+	case cborText:
+		content, err := readBytes(reader, argument)
+		if err != nil {
+			return err
+		}
+		writeJSONString(buf, string(content))
+	default:
+		return fmt.Errorf("%w: unsupported key type", ErrMalformedBinary)
+	}
+	return nil
+}
+
+// writeJSONString writes a string as JSON string.
+// The buffer and the string have to be given.
+func writeJSONString(buf *bytes.Buffer, value string) {
+	encoder := json.NewEncoder(buf)
+	encoder.SetEscapeHTML(false)
+	_ = encoder.Encode(value)
+	// remove the newline appended by the encoder
+	buf.Truncate(buf.Len() - 1)
+}
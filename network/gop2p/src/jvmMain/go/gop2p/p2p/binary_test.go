@@ -0,0 +1,142 @@
+/*
+ * Copyright (c) 2021 The biotopium Authors.
+ * This file is part of biotopium.
+ *
+ * biotopium is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * biotopium is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with biotopium.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package p2p
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestBinaryRoundTrip(t *testing.T) {
+	tests := map[string]string{
+		"small integers":    `[0,23,24,255,256,65535,65536,4294967295,4294967296,18446744073709551615]`,
+		"negative integers": `[-1,-24,-25,-256,-257,-9223372036854775808]`,
+		"floats":            `[1.5,-0.25,2.0,1e+100]`,
+		"literals":          `[true,false,null]`,
+		"text":              `["","short","a\"b<>\\","ü","00112233"]`,
+		"hex":               `{"hash":"00112233445566778899aabbccddeeff"}`,
+		"uppercase hex":     `{"hash":"00112233445566778899AABBCCDDEEFF"}`,
+		"base64":            `{"sign":"AAECAwQFBgcICQoLDA0ODw=="}`,
+		"key order":         `{"unknown":1,"peerId":"p","a":{"y":2,"x":1},"class":"C"}`,
+		"nested":            `{"blocks":[{"data":[],"height":1},{}]}`,
+	}
+	for name, value := range tests {
+		encoded, err := EncodeBinary([]byte(value))
+		if err != nil {
+			t.Errorf("%s: %s", name, err)
+			continue
+		}
+		if strings.HasPrefix(value, "{") != isBinary(encoded) {
+			t.Errorf("%s: expected only maps to be detected as binary", name)
+		}
+		decoded, err := DecodeBinary(encoded)
+		if err != nil {
+			t.Errorf("%s: %s", name, err)
+			continue
+		}
+		if string(decoded) != value {
+			t.Errorf("%s: expected %s, got %s", name, value, decoded)
+		}
+	}
+}
+
+func TestBinaryByteStrings(t *testing.T) {
+	tests := map[string][]byte{
+		`"00112233445566778899aabbccddeeff"`: append([]byte{cborTag | byte(cborTagBase16), cborBytes | 16},
+			0x00, 0x11, 0x22, 0x33, 0x44, 0x55, 0x66, 0x77, 0x88, 0x99, 0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff),
+		`"AAECAwQFBgcICQoLDA0ODw=="`: append([]byte{cborTag | byte(cborTagBase64), cborBytes | 16},
+			0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15),
+		// too short to be encoded as byte string
+		`"001122334455"`: append([]byte{cborText | 12}, "001122334455"...),
+		// not restored exactly, the padding bits are set
+		`"AAECAwQFBgcICQoLDA0ODx=="`: append([]byte{cborText | 24, 24}, "AAECAwQFBgcICQoLDA0ODx=="...),
+	}
+	for value, expected := range tests {
+		encoded, err := EncodeBinary([]byte(value))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(encoded, expected) {
+			t.Errorf("%s: expected %x, got %x", value, expected, encoded)
+		}
+	}
+}
+
+func TestBinaryInvalidJSON(t *testing.T) {
+	for _, value := range []string{``, `{`, `{"a":}`, `{} {}`, `[1,]`} {
+		if _, err := EncodeBinary([]byte(value)); err == nil {
+			t.Errorf("%q: expected an error", value)
+		}
+	}
+}
+
+func TestBinaryTruncated(t *testing.T) {
+	encoded, err := EncodeBinary([]byte(`{"peerId":"p","message":{"class":"C","hash":"00112233445566778899aabbccddeeff","height":65536,"data":[1.5,"text",null]}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < len(encoded); i++ {
+		if decoded, err := DecodeBinary(encoded[:i]); err == nil {
+			t.Errorf("expected an error decoding %d of %d bytes, got %s", i, len(encoded), decoded)
+		}
+	}
+}
+
+func TestBinaryMalformed(t *testing.T) {
+	tests := map[string][]byte{
+		"trailing data":           {0x01, 0x01},
+		"reserved information":    {0x1c},
+		"definite-length map":     {cborMap},
+		"definite-length array":   {cborArray},
+		"untagged byte string":    {cborBytes},
+		"unknown key":             {cborMap | cborIndefinite, 0x18, 0xff, 0x01, cborBreak},
+		"unsupported key type":    {cborMap | cborIndefinite, cborBytes, 0x01, cborBreak},
+		"unsupported tag":         {cborTag | 1, cborBytes},
+		"tagged text":             {cborTag | byte(cborTagBase16), cborText},
+		"unsupported simple":      {cborSimple | 23},
+		"negative out of range":   {cborNegative | 27, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+		"non-finite float":        {cborFloat64, 0x7f, 0xf8, 0, 0, 0, 0, 0, 0},
+		"string too long":         {cborText | 27, 0x7f, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+		"tagged bytes too long":   {cborTag | byte(cborTagBase64), cborBytes | 27, 0x7f, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+		"break outside container": {cborBreak},
+	}
+	for name, encoded := range tests {
+		if _, err := DecodeBinary(encoded); !errors.Is(err, ErrMalformedBinary) {
+			t.Errorf("%s: expected ErrMalformedBinary, got %v", name, err)
+		}
+	}
+}
+
+func TestBinaryDepthLimit(t *testing.T) {
+	nested := func(depth int) []byte {
+		encoded, err := EncodeBinary([]byte(strings.Repeat("[", depth) + "0" + strings.Repeat("]", depth)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return encoded
+	}
+	if _, err := DecodeBinary(nested(maxBinaryDepth)); err != nil {
+		t.Errorf("expected values nested %d levels deep to be decoded, got %s", maxBinaryDepth, err)
+	}
+	if _, err := DecodeBinary(nested(maxBinaryDepth + 1)); !errors.Is(err, ErrMalformedBinary) {
+		t.Errorf("expected ErrMalformedBinary for values nested too deep, got %v", err)
+	}
+}
@@ -0,0 +1,88 @@
+/*
+ * Copyright (c) 2021 The biotopium Authors.
+ * This file is part of biotopium.
+ *
+ * biotopium is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * biotopium is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with biotopium.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package p2p
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/libp2p/go-libp2p-core/peer"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	"riesenacht.ch/biotopium/network/gop2p/blockchain"
+)
+
+// blockValidator creates a pubsub validator,
+// which rejects block announcements violating the general block rules
+// or not originating from a trusted blocklord.
+// Rejected messages are neither delivered nor forwarded, the forwarding peer is penalised.
+// Blocks containing classes unknown to the hashable encoding are ignored,
+// since they might have been created by a newer version of the core module.
+// Blocks missing a class discriminator are rejected, no version of the core module creates them.
+// Accepted blocks are passed to the given callback together with the blocklord they originate from.
+// A block validator, the trusted blocklords and the callback have to be given.
+func blockValidator(validator *blockchain.Validator, trust *BlocklordTrust, onAccepted func(block *blockchain.Block, origin peer.ID)) pubsub.ValidatorEx {
+	return func(_ context.Context, from peer.ID, msg *pubsub.Message) pubsub.ValidationResult {
+		payload, err := decodePayload(msg.Data)
+		if err != nil {
+			logger.Warnw("Rejected undecodable payload", "peer", from.Pretty(), "error", err)
+			return pubsub.ValidationReject
+		}
+		envelope, err := ParseEnvelope(payload)
+		if err != nil {
+			logger.Warnw("Rejected malformed envelope", "peer", from.Pretty(), "error", err)
+			return pubsub.ValidationReject
+		}
+		if envelope.Type != MessageTypeBlockAdd {
+			return pubsub.ValidationAccept
+		}
+		origin := msg.GetFrom()
+		if !trust.IsTrustedOrigin(origin) {
+			logger.Warnw("Rejected block announcement of untrusted peer", "origin", origin.Pretty(), "peer", from.Pretty())
+			return pubsub.ValidationReject
+		}
+		message := &blockchain.BlockAddMessage{}
+		if err := json.Unmarshal(envelope.Message, message); err != nil || message.Block == nil {
+			logger.Warnw("Rejected malformed block announcement", "peer", from.Pretty())
+			return pubsub.ValidationReject
+		}
+		if err := validator.ValidateBlock(message.Block); errors.Is(err, blockchain.ErrUnknownClass) {
+			logger.Infow("Ignored block announcement of unknown class", "peer", from.Pretty(), "error", err)
+			return pubsub.ValidationIgnore
+		} else if err != nil {
+			logger.Warnw("Rejected block announcement", "peer", from.Pretty(), "error", err)
+			return pubsub.ValidationReject
+		}
+		onAccepted(message.Block, origin)
+		return pubsub.ValidationAccept
+	}
+}
+
+// chainValidators chains pubsub validators, since pubsub accepts a single validator per topic.
+// The validators are run in the given order, the first result other than accepting the message is returned.
+// The validators have to be given.
+func chainValidators(validators ...pubsub.ValidatorEx) pubsub.ValidatorEx {
+	return func(ctx context.Context, from peer.ID, msg *pubsub.Message) pubsub.ValidationResult {
+		for _, validator := range validators {
+			if result := validator(ctx, from, msg); result != pubsub.ValidationAccept {
+				return result
+			}
+		}
+		return pubsub.ValidationAccept
+	}
+}
@@ -0,0 +1,70 @@
+/*
+ * Copyright (c) 2021 The biotopium Authors.
+ * This file is part of biotopium.
+ *
+ * biotopium is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * biotopium is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with biotopium.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package p2p
+
+import (
+	"context"
+	"github.com/libp2p/go-libp2p-core/peer"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	pb "github.com/libp2p/go-libp2p-pubsub/pb"
+	"riesenacht.ch/biotopium/network/gop2p/blockchain"
+	"strings"
+	"testing"
+)
+
+func TestBlockValidatorResults(t *testing.T) {
+	blocklordKey, _ := newTestKey(t)
+	blocklordID, err := peer.IDFromPrivateKey(blocklordKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, author := blockAddMessage(t, blocklordID, "valid block")
+	trust, err := newBlocklordTrust([]string{blocklordID.Pretty()}, []string{author})
+	if err != nil {
+		t.Fatal(err)
+	}
+	validate := blockValidator(blockchain.NewValidator(trust.IsTrustedAuthor), trust, func(*blockchain.Block, peer.ID) {})
+
+	unknown, _ := blockAddMessage(t, blocklordID, "unknown record class")
+	missing := []byte(strings.Replace(string(unknown), `"class": "FutureAction",`, "", 1))
+	if string(missing) == string(unknown) {
+		t.Fatal("expected the class discriminator to be removed")
+	}
+	tests := map[string]struct {
+		data     []byte
+		expected pubsub.ValidationResult
+	}{
+		"valid block":                 {nil, pubsub.ValidationAccept},
+		"unknown record class":        {unknown, pubsub.ValidationIgnore},
+		"missing class":               {missing, pubsub.ValidationReject},
+		"tampered block content":      {nil, pubsub.ValidationReject},
+		"untrusted block author":      {nil, pubsub.ValidationReject},
+		"valid block without records": {nil, pubsub.ValidationAccept},
+	}
+	for name, test := range tests {
+		data := test.data
+		if data == nil {
+			data, _ = blockAddMessage(t, blocklordID, name)
+		}
+		msg := &pubsub.Message{Message: &pb.Message{From: []byte(blocklordID), Data: data}}
+		if result := validate(context.Background(), blocklordID, msg); result != test.expected {
+			t.Errorf("%s: expected %v, got %v", name, test.expected, result)
+		}
+	}
+}
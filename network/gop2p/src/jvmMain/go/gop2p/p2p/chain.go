@@ -0,0 +1,151 @@
+/*
+ * Copyright (c) 2021 The biotopium Authors.
+ * This file is part of biotopium.
+ *
+ * biotopium is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * biotopium is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with biotopium.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package p2p
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"riesenacht.ch/biotopium/network/gop2p/blockchain"
+	"sync/atomic"
+)
+
+// ErrBlockStoreDisabled is returned if the block store is accessed without being configured.
+var ErrBlockStoreDisabled = errors.New("block store is disabled")
+
+// chainRequest represents a ChainReqMessage.
+type chainRequest struct {
+	Height uint64 `json:"height"` // initial height of the requested blocks
+}
+
+// storeBlock appends an accepted block to the block store, if enabled.
+// Blocks which do not follow the stored chain are not stored.
+// If blocks are missing before the block, they are synced from the blocklord announcing it.
+// The block and the blocklord it originates from have to be given.
+func (s *Server) storeBlock(block *blockchain.Block, origin peer.ID) {
+	if s.Blocks == nil {
+		return
+	}
+	err := s.Blocks.Append(block)
+	if errors.Is(err, blockchain.ErrHeightGap) {
+		logger.Debugw("Announced block does not follow the stored chain", "height", block.Height, "stored", s.Blocks.Height())
+		go s.syncGap(origin)
+	} else if err != nil {
+		logger.Errorw("Could not store block", "height", block.Height, "error", err)
+	}
+}
+
+// syncGap syncs the blocks missing in the block store from a blocklord.
+// Only one sync runs at a time, gaps detected meanwhile are closed by the running sync.
+// The peer ID of the blocklord has to be given.
+func (s *Server) syncGap(blocklord peer.ID) {
+	if !atomic.CompareAndSwapInt32(&s.gapSync, 0, 1) {
+		return
+	}
+	defer atomic.StoreInt32(&s.gapSync, 0)
+	stored, err := s.SyncChain(blocklord)
+	if errors.Is(err, ErrSyncRejected) {
+		logger.Debugw("Blocklord could not close height gap", "peer", blocklord.Pretty(), "error", err)
+	} else if err != nil {
+		logger.Warnw("Could not close height gap", "peer", blocklord.Pretty(), "stored", stored, "error", err)
+	} else {
+		logger.Infow("Closed height gap", "peer", blocklord.Pretty(), "stored", stored)
+	}
+}
+
+// BlockHeight returns the number of blocks in the block store.
+func (s *Server) BlockHeight() (uint64, error) {
+	if s.Blocks == nil {
+		return 0, ErrBlockStoreDisabled
+	}
+	return s.Blocks.Height(), nil
+}
+
+// GetBlocks reads the next chunk of blocks within a height range from the block store.
+// Like chunks of the sync protocol, the chunk is bounded in size.
+// The transfer of a height range is continued by requesting the next height of the chunk until the chunk is done.
+// The first and the last height (inclusive) have to be given.
+// The chunk is returned.
+func (s *Server) GetBlocks(from uint64, to uint64) (*SyncChunk, error) {
+	if s.Blocks == nil {
+		return nil, ErrBlockStoreDisabled
+	}
+	if to < from {
+		return nil, fmt.Errorf("invalid height range %d to %d", from, to)
+	}
+	return nextChunk(s.Blocks, from, &to)
+}
+
+// joinBlocks joins serialized blocks to a JSON array.
+// The serialized blocks have to be given.
+func joinBlocks(blocks [][]byte) []byte {
+	var buf bytes.Buffer
+	buf.WriteByte('[')
+	buf.Write(bytes.Join(blocks, []byte(",")))
+	buf.WriteByte(']')
+	return buf.Bytes()
+}
+
+// answerChainRequest answers a ChainReqMessage from the block store,
+// like the host does: all blocks starting at the requested height are forwarded.
+// Requests the store cannot answer are delivered to the host.
+// The blocks are sent to the authenticated peer the request originates from,
+// the unauthenticated peer ID of the envelope is ignored.
+// The envelope and the peer it originates from have to be given.
+func (s *Server) answerChainRequest(envelope *Envelope, from peer.ID) bool {
+	request := &chainRequest{}
+	if err := json.Unmarshal(envelope.Message, request); err != nil {
+		return false
+	}
+	stored := s.Blocks.Height()
+	if stored == 0 || request.Height >= stored-1 {
+		return false
+	}
+	blocks, err := s.Blocks.Range(request.Height, stored-1)
+	if err != nil {
+		logger.Errorw("Could not read blocks for chain request", "error", err)
+		return false
+	}
+	serialized, err := json.Marshal(&Envelope{
+		PeerID:  s.Host.ID().Pretty(),
+		Message: chainForwardMessage(blocks),
+	})
+	if err != nil {
+		logger.Errorw("Could not encode chain forward message", "error", err)
+		return false
+	}
+	go func() {
+		if err := s.Stream.Send(from, serialized); err != nil {
+			logger.Warnw("Could not answer chain request", "peer", from.Pretty(), "error", err)
+		}
+	}()
+	return true
+}
+
+// chainForwardMessage creates a serialized ChainFwdMessage.
+// The serialized blocks have to be given.
+func chainForwardMessage(blocks [][]byte) json.RawMessage {
+	var buf bytes.Buffer
+	buf.WriteString(`{"` + classDiscriminator + `":"` + MessageTypeChainFwd + `","blocks":`)
+	buf.Write(joinBlocks(blocks))
+	buf.WriteByte('}')
+	return buf.Bytes()
+}
@@ -0,0 +1,147 @@
+/*
+ * Copyright (c) 2021 The biotopium Authors.
+ * This file is part of biotopium.
+ *
+ * biotopium is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * biotopium is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with biotopium.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package p2p
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync/atomic"
+)
+
+// compressionSuffix is appended to protocol IDs and topic names of the gzip compressed variants.
+// Peers not supporting compression neither negotiate the protocol nor join the topic.
+const compressionSuffix = "/gzip"
+
+// maxDecompressedSize is the maximum size of a decompressed payload.
+const maxDecompressedSize = 16 << 20
+
+// gzipMagic are the first bytes of gzip compressed data.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// ErrPayloadTooLarge is returned if a decompressed payload exceeds the maximum size.
+var ErrPayloadTooLarge = errors.New("decompressed payload too large")
+
+// compressedVariant returns the compressed variant of a protocol ID or topic name.
+// The protocol ID or topic name has to be given.
+func compressedVariant(name string) string {
+	return name + compressionSuffix
+}
+
+// compress compresses a payload using gzip.
+// The payload has to be given.
+// The compressed payload is returned.
+func compress(payload []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	if _, err := writer.Write(payload); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decompress reads and decompresses a gzip compressed payload.
+// A reader has to be given.
+// The decompressed payload is returned.
+func decompress(reader io.Reader) ([]byte, error) {
+	gzipReader, err := gzip.NewReader(reader)
+	if err != nil {
+		return nil, err
+	}
+	defer gzipReader.Close()
+	payload, err := ioutil.ReadAll(io.LimitReader(gzipReader, maxDecompressedSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(payload) > maxDecompressedSize {
+		return nil, fmt.Errorf("%w: more than %d bytes", ErrPayloadTooLarge, maxDecompressedSize)
+	}
+	return payload, nil
+}
+
+// decodePayload decompresses a payload if it is gzip compressed and transcodes it to JSON if it is binary encoded.
+// Other payloads are returned unchanged, JSON never starts with the gzip magic bytes or a CBOR map.
+// The payload has to be given.
+func decodePayload(payload []byte) ([]byte, error) {
+	if bytes.HasPrefix(payload, gzipMagic) {
+		decompressed, err := decompress(bytes.NewReader(payload))
+		if err != nil {
+			return nil, err
+		}
+		payload = decompressed
+	}
+	if isBinary(payload) {
+		return DecodeBinary(payload)
+	}
+	return payload, nil
+}
+
+// CompressionStats counts the bytes of compressed payloads before and after compression.
+type CompressionStats struct {
+	SentRaw            uint64 `json:"sentRaw"`            // bytes of sent payloads before compression
+	SentCompressed     uint64 `json:"sentCompressed"`     // bytes of sent payloads after compression
+	ReceivedRaw        uint64 `json:"receivedRaw"`        // bytes of received payloads after decompression
+	ReceivedCompressed uint64 `json:"receivedCompressed"` // bytes of received compressed payloads
+}
+
+// addSent counts a sent compressed payload.
+// The sizes before and after compression have to be given.
+func (c *CompressionStats) addSent(raw int, compressed int) {
+	atomic.AddUint64(&c.SentRaw, uint64(raw))
+	atomic.AddUint64(&c.SentCompressed, uint64(compressed))
+}
+
+// addReceived counts a received compressed payload.
+// The sizes after and before decompression have to be given.
+func (c *CompressionStats) addReceived(raw int, compressed int) {
+	atomic.AddUint64(&c.ReceivedRaw, uint64(raw))
+	atomic.AddUint64(&c.ReceivedCompressed, uint64(compressed))
+}
+
+// CompressionReport represents a snapshot of the compression statistics.
+type CompressionReport struct {
+	CompressionStats
+	SentRatio     float64 `json:"sentRatio"`     // compressed size relative to the raw size of sent payloads
+	ReceivedRatio float64 `json:"receivedRatio"` // compressed size relative to the raw size of received payloads
+}
+
+// Report creates a snapshot of the compression statistics.
+func (c *CompressionStats) Report() *CompressionReport {
+	report := &CompressionReport{
+		CompressionStats: CompressionStats{
+			SentRaw:            atomic.LoadUint64(&c.SentRaw),
+			SentCompressed:     atomic.LoadUint64(&c.SentCompressed),
+			ReceivedRaw:        atomic.LoadUint64(&c.ReceivedRaw),
+			ReceivedCompressed: atomic.LoadUint64(&c.ReceivedCompressed),
+		},
+	}
+	if report.SentRaw > 0 {
+		report.SentRatio = float64(report.SentCompressed) / float64(report.SentRaw)
+	}
+	if report.ReceivedRaw > 0 {
+		report.ReceivedRatio = float64(report.ReceivedCompressed) / float64(report.ReceivedRaw)
+	}
+	return report
+}
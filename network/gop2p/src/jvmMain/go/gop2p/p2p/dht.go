@@ -0,0 +1,288 @@
+/*
+ * Copyright (c) 2021 The biotopium Authors.
+ * This file is part of biotopium.
+ *
+ * biotopium is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * biotopium is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with biotopium.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package p2p
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/routing"
+	record "github.com/libp2p/go-libp2p-record"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DHTNamespace is the namespace of all biotopium DHT records.
+const DHTNamespace = "biotopium"
+
+// DHTProtocolPrefix is the prefix of the biotopium DHT protocol.
+// A custom prefix is required in order to register the biotopium namespace.
+const DHTProtocolPrefix = "/biotopium"
+
+// dhtTimeout is the maximum duration of a DHT operation.
+const dhtTimeout = 30 * time.Second
+
+// maxRecordClockSkew is the maximum duration a record sequence number may lie in the future.
+const maxRecordClockSkew = time.Minute
+
+// recordSignaturePrefix is prepended to the signed payload of a record.
+const recordSignaturePrefix = "biotopium-record:"
+
+// ErrInvalidRecordName is returned if a record name is empty or contains a slash.
+var ErrInvalidRecordName = errors.New("invalid record name")
+
+// SignedRecord represents a value stored in the DHT.
+// The record is signed by the Ed25519 key of its owner.
+type SignedRecord struct {
+	Value     []byte `json:"value"`     // stored value
+	Seq       uint64 `json:"seq"`       // sequence number, newer records have higher numbers
+	PublicKey []byte `json:"publicKey"` // marshalled public key of the owner
+	Signature []byte `json:"signature"` // signature of the record
+}
+
+// RecordKey returns the DHT key of a record.
+// A record name and the peer ID of the owner have to be given.
+// The key has the form /biotopium/<name>/<owner>.
+func RecordKey(name string, owner peer.ID) (string, error) {
+	if len(name) == 0 || strings.Contains(name, "/") {
+		return "", ErrInvalidRecordName
+	}
+	return fmt.Sprintf("/%s/%s/%s", DHTNamespace, name, owner.Pretty()), nil
+}
+
+// parseRecordKey parses a DHT key of a record.
+// A key has to be given.
+// The record name and the peer ID of the owner are returned.
+func parseRecordKey(key string) (string, peer.ID, error) {
+	parts := strings.Split(key, "/")
+	if len(parts) != 4 || parts[0] != "" || parts[1] != DHTNamespace || len(parts[2]) == 0 {
+		return "", "", fmt.Errorf("malformed record key: %s", key)
+	}
+	owner, err := peer.Decode(parts[3])
+	if err != nil {
+		return "", "", err
+	}
+	return parts[2], owner, nil
+}
+
+// signedPayload returns the bytes which are signed by the owner of a record.
+// A key, a sequence number and a value have to be given.
+func signedPayload(key string, seq uint64, value []byte) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(recordSignaturePrefix)
+	buf.WriteString(key)
+	_ = binary.Write(&buf, binary.BigEndian, seq)
+	buf.Write(value)
+	return buf.Bytes()
+}
+
+// NewSignedRecord creates a new signed record.
+// A key, a sequence number, a value and the private key of the owner have to be given.
+// The serialized record is returned.
+func NewSignedRecord(key string, seq uint64, value []byte, privateKey crypto.PrivKey) ([]byte, error) {
+	if privateKey.Type() != crypto.Ed25519 {
+		return nil, errors.New("records have to be signed with an Ed25519 key")
+	}
+	signature, err := privateKey.Sign(signedPayload(key, seq, value))
+	if err != nil {
+		return nil, err
+	}
+	publicKey, err := crypto.MarshalPublicKey(privateKey.GetPublic())
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(&SignedRecord{
+		Value:     value,
+		Seq:       seq,
+		PublicKey: publicKey,
+		Signature: signature,
+	})
+}
+
+// unmarshalRecord deserializes a signed record.
+// The serialized record has to be given.
+func unmarshalRecord(serialized []byte) (*SignedRecord, error) {
+	rec := &SignedRecord{}
+	if err := json.Unmarshal(serialized, rec); err != nil {
+		return nil, err
+	}
+	return rec, nil
+}
+
+// RecordValidator validates records in the biotopium namespace.
+// Only the owner of a record key is allowed to write it,
+// the record with the highest sequence number wins.
+type RecordValidator struct{}
+
+// Validate validates a record.
+// A key and the serialized record have to be given.
+func (v RecordValidator) Validate(key string, value []byte) error {
+	_, owner, err := parseRecordKey(key)
+	if err != nil {
+		return err
+	}
+	rec, err := unmarshalRecord(value)
+	if err != nil {
+		return err
+	}
+	publicKey, err := crypto.UnmarshalPublicKey(rec.PublicKey)
+	if err != nil {
+		return err
+	}
+	if publicKey.Type() != crypto.Ed25519 {
+		return errors.New("record is not signed with an Ed25519 key")
+	}
+	if !owner.MatchesPublicKey(publicKey) {
+		return fmt.Errorf("record public key does not match owner %s", owner.Pretty())
+	}
+	ok, err := publicKey.Verify(signedPayload(key, rec.Seq, rec.Value), rec.Signature)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("invalid record signature")
+	}
+	if rec.Seq > uint64(time.Now().Add(maxRecordClockSkew).UnixNano()) {
+		return errors.New("record sequence number lies in the future")
+	}
+	return nil
+}
+
+// Select selects the freshest record.
+// A key and the serialized records have to be given.
+func (v RecordValidator) Select(key string, values [][]byte) (int, error) {
+	best := -1
+	var bestSeq uint64
+	for i, value := range values {
+		rec, err := unmarshalRecord(value)
+		if err != nil {
+			continue
+		}
+		if best == -1 || rec.Seq > bestSeq {
+			best = i
+			bestSeq = rec.Seq
+		}
+	}
+	if best == -1 {
+		return 0, errors.New("no valid record to select")
+	}
+	return best, nil
+}
+
+var _ record.Validator = RecordValidator{}
+
+// recordSeq tracks the last sequence number of records put by the local peer.
+var recordSeq struct {
+	sync.Mutex
+	last uint64
+}
+
+// nextRecordSeq returns a new, strictly increasing sequence number based on the current time.
+func nextRecordSeq() uint64 {
+	recordSeq.Lock()
+	defer recordSeq.Unlock()
+	seq := uint64(time.Now().UnixNano())
+	if seq <= recordSeq.last {
+		seq = recordSeq.last + 1
+	}
+	recordSeq.last = seq
+	return seq
+}
+
+// PutValue stores a value owned by the local peer in the DHT.
+// A record name and a value have to be given.
+func (s *Server) PutValue(name string, value []byte) error {
+	return s.putSignedValue(name, value, s.Host.Peerstore().PrivKey(s.Host.ID()))
+}
+
+// putSignedValue stores a value in the DHT, owned by the peer ID derived from the given key.
+// A record name, a value and the private key of the owner have to be given.
+func (s *Server) putSignedValue(name string, value []byte, ownerKey crypto.PrivKey) error {
+	owner, err := peer.IDFromPrivateKey(ownerKey)
+	if err != nil {
+		return err
+	}
+	key, err := RecordKey(name, owner)
+	if err != nil {
+		return err
+	}
+	serialized, err := NewSignedRecord(key, nextRecordSeq(), value, ownerKey)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), dhtTimeout)
+	defer cancel()
+	return s.DHT.PutValue(ctx, key, serialized)
+}
+
+// GetValue retrieves a value from the DHT.
+// A record name and the peer ID of the owner have to be given.
+// The value is returned, routing.ErrNotFound if no value was found.
+func (s *Server) GetValue(name string, owner peer.ID) ([]byte, error) {
+	key, err := RecordKey(name, owner)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), dhtTimeout)
+	defer cancel()
+	serialized, err := s.DHT.GetValue(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	rec, err := unmarshalRecord(serialized)
+	if err != nil {
+		return nil, err
+	}
+	return rec.Value, nil
+}
+
+// SearchValue searches the DHT exhaustively for the freshest value.
+// In contrast to GetValue, the search does not stop after a quorum of peers was reached.
+// A record name and the peer ID of the owner have to be given.
+// The freshest value found is returned, routing.ErrNotFound if no value was found.
+func (s *Server) SearchValue(name string, owner peer.ID) ([]byte, error) {
+	key, err := RecordKey(name, owner)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), dhtTimeout)
+	defer cancel()
+	results, err := s.DHT.SearchValue(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	var best []byte
+	for serialized := range results {
+		best = serialized
+	}
+	if best == nil {
+		return nil, routing.ErrNotFound
+	}
+	rec, err := unmarshalRecord(best)
+	if err != nil {
+		return nil, err
+	}
+	return rec.Value, nil
+}
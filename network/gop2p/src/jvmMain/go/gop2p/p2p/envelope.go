@@ -0,0 +1,159 @@
+/*
+ * Copyright (c) 2021 The biotopium Authors.
+ * This file is part of biotopium.
+ *
+ * biotopium is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * biotopium is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with biotopium.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package p2p
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"sync"
+)
+
+// The serial names of the known message types.
+// The serial name is used as polymorphic class discriminator of the message in an envelope.
+const (
+	MessageTypeBlockAdd        = "BlockAddMessage"
+	MessageTypeActionReq       = "ActionReqMessage"
+	MessageTypeChainReq        = "ChainRequestMessage"
+	MessageTypeChainFwd        = "ChainForwardMessage"
+	MessageTypePeerAddressInfo = "PeerAddressInfoMessage"
+	MessageTypeDebug           = "DebugMessage"
+)
+
+// classDiscriminator is the name of the property holding the serial name of a polymorphic value.
+const classDiscriminator = "class"
+
+// ErrMissingMessageType is returned if the message of an envelope has no class discriminator.
+var ErrMissingMessageType = errors.New("message type missing in envelope")
+
+// Envelope represents a serialized MessageEnvelope.
+// The message itself is not decoded, only its type is extracted.
+type Envelope struct {
+	PeerID  string          `json:"peerId"`  // peer ID of the sender
+	Message json.RawMessage `json:"message"` // serialized message
+	Type    string          `json:"-"`       // serial name of the message type
+}
+
+// ParseEnvelope parses a serialized message envelope.
+// The serialized envelope has to be given.
+// The envelope containing the type of the message is returned.
+func ParseEnvelope(serialized []byte) (*Envelope, error) {
+	envelope := &Envelope{}
+	if err := json.Unmarshal(serialized, envelope); err != nil {
+		return nil, err
+	}
+	var discriminator map[string]json.RawMessage
+	if err := json.Unmarshal(envelope.Message, &discriminator); err != nil {
+		return nil, err
+	}
+	rawType, ok := discriminator[classDiscriminator]
+	if !ok {
+		return nil, ErrMissingMessageType
+	}
+	if err := json.Unmarshal(rawType, &envelope.Type); err != nil {
+		return nil, err
+	}
+	return envelope, nil
+}
+
+// NativeHandler handles a message in Go.
+// The envelope and the authenticated peer the message originates from are given.
+// If true is returned, the message is consumed and not delivered to the host.
+type NativeHandler func(envelope *Envelope, from peer.ID) bool
+
+// MessageTypeFilter decides which message types are delivered to the host.
+// Until the first type is subscribed, all messages are delivered.
+// Afterwards, only subscribed types are delivered, even if all of them are unsubscribed again.
+// Message types can be handled natively, before they are delivered.
+type MessageTypeFilter struct {
+	mutex      sync.RWMutex
+	enabled    bool                     // whether only subscribed message types are delivered
+	subscribed map[string]bool          // subscribed message types
+	handlers   map[string]NativeHandler // native handlers
+}
+
+// NewMessageTypeFilter is the factory function of the MessageTypeFilter struct.
+// A pointer to a new filter delivering all messages is returned.
+func NewMessageTypeFilter() *MessageTypeFilter {
+	return &MessageTypeFilter{
+		subscribed: make(map[string]bool),
+		handlers:   make(map[string]NativeHandler),
+	}
+}
+
+// Handle registers a native handler for a message type, replacing a previous one.
+// The serial name of the message type and the handler have to be given.
+func (f *MessageTypeFilter) Handle(messageType string, handler NativeHandler) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.handlers[messageType] = handler
+}
+
+// Subscribe subscribes to a message type and enables the filter.
+// The serial name of the message type has to be given.
+func (f *MessageTypeFilter) Subscribe(messageType string) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.enabled = true
+	f.subscribed[messageType] = true
+}
+
+// Unsubscribe unsubscribes from a message type.
+// The filter stays enabled, even if no type is subscribed anymore.
+// The serial name of the message type has to be given.
+func (f *MessageTypeFilter) Unsubscribe(messageType string) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	delete(f.subscribed, messageType)
+}
+
+// DeliverAll disables the filter and removes all subscriptions, all message types are delivered again.
+func (f *MessageTypeFilter) DeliverAll() {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.enabled = false
+	f.subscribed = make(map[string]bool)
+}
+
+// Accepts checks whether a message type is delivered.
+// The serial name of the message type has to be given.
+func (f *MessageTypeFilter) Accepts(messageType string) bool {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+	return !f.enabled || f.subscribed[messageType]
+}
+
+// deliver parses a serialized envelope, passes it to its native handler
+// and checks whether it should be delivered to the host.
+// The serialized envelope and the authenticated peer it originates from have to be given.
+// The parsed envelope and whether to deliver it are returned.
+func (f *MessageTypeFilter) deliver(serialized []byte, from peer.ID) (*Envelope, bool) {
+	envelope, err := ParseEnvelope(serialized)
+	if err != nil {
+		logger.Warnw("Dropped malformed envelope", "error", err)
+		return nil, false
+	}
+	f.mutex.RLock()
+	handler := f.handlers[envelope.Type]
+	f.mutex.RUnlock()
+	if handler != nil && handler(envelope, from) {
+		return envelope, false
+	}
+	return envelope, f.Accepts(envelope.Type)
+}
@@ -0,0 +1,89 @@
+/*
+ * Copyright (c) 2021 The biotopium Authors.
+ * This file is part of biotopium.
+ *
+ * biotopium is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * biotopium is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with biotopium.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package p2p
+
+import (
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"sort"
+)
+
+// Peerstore keys under which identify stores the versions of a peer.
+const (
+	agentVersionKey    = "AgentVersion"
+	protocolVersionKey = "ProtocolVersion"
+)
+
+// PeerIdentity represents the identify information of a connected peer.
+type PeerIdentity struct {
+	PeerID          string   `json:"peerId"`                    // peer ID
+	AgentVersion    string   `json:"agentVersion,omitempty"`    // agent version, e.g. biotopium-jvm/0.1.0
+	ProtocolVersion string   `json:"protocolVersion,omitempty"` // libp2p protocol version
+	Protocols       []string `json:"protocols"`                 // supported protocols
+	ObservedAddress string   `json:"observedAddress,omitempty"` // remote address of the connection to the peer
+	ListenAddrs     []string `json:"listenAddrs"`               // known listen addresses
+}
+
+// peerstoreString reads a string value of a peer from the peerstore.
+// The host, the peer ID and the key have to be given.
+// An empty string is returned if the value is unknown.
+func peerstoreString(h host.Host, peerID peer.ID, key string) string {
+	value, err := h.Peerstore().Get(peerID, key)
+	if err != nil {
+		return ""
+	}
+	str, _ := value.(string)
+	return str
+}
+
+// identifyPeer collects the identify information of a peer.
+// The host and the peer ID have to be given.
+// A pointer to the identify information is returned.
+func identifyPeer(h host.Host, peerID peer.ID) *PeerIdentity {
+	identity := &PeerIdentity{
+		PeerID:          peerID.Pretty(),
+		AgentVersion:    peerstoreString(h, peerID, agentVersionKey),
+		ProtocolVersion: peerstoreString(h, peerID, protocolVersionKey),
+		Protocols:       []string{},
+		ListenAddrs:     []string{},
+	}
+	if protocols, err := h.Peerstore().GetProtocols(peerID); err == nil {
+		identity.Protocols = append(identity.Protocols, protocols...)
+		sort.Strings(identity.Protocols)
+	}
+	if conns := h.Network().ConnsToPeer(peerID); len(conns) > 0 {
+		identity.ObservedAddress = conns[0].RemoteMultiaddr().String()
+	}
+	for _, addr := range h.Peerstore().Addrs(peerID) {
+		identity.ListenAddrs = append(identity.ListenAddrs, addr.String())
+	}
+	return identity
+}
+
+// PeerIdentities reports the identify information of all connected peers.
+func (s *Server) PeerIdentities() []*PeerIdentity {
+	identities := []*PeerIdentity{}
+	for _, peerID := range s.Host.Network().Peers() {
+		identities = append(identities, identifyPeer(s.Host, peerID))
+	}
+	sort.Slice(identities, func(i, j int) bool {
+		return identities[i].PeerID < identities[j].PeerID
+	})
+	return identities
+}
@@ -0,0 +1,177 @@
+/*
+ * Copyright (c) 2021 The biotopium Authors.
+ * This file is part of biotopium.
+ *
+ * biotopium is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * biotopium is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with biotopium.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package p2p
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"golang.org/x/crypto/scrypt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// keyFileVersion is the version of the key file format.
+const keyFileVersion = 1
+
+// scrypt parameters used for deriving the key file encryption key from a passphrase.
+const (
+	scryptN      = 1 << 15
+	scryptR      = 8
+	scryptP      = 1
+	scryptKeyLen = 32
+	saltLen      = 16
+)
+
+// ErrWrongPassphrase is returned if a key file cannot be decrypted using the given passphrase.
+var ErrWrongPassphrase = errors.New("wrong passphrase or corrupted key file")
+
+// keyFile represents the content of a passphrase-encrypted identity key file.
+type keyFile struct {
+	Version    int    `json:"version"`    // key file format version
+	Salt       []byte `json:"salt"`       // scrypt salt
+	Nonce      []byte `json:"nonce"`      // AES-GCM nonce
+	Ciphertext []byte `json:"ciphertext"` // encrypted marshalled private key
+}
+
+// GenerateIdentityKey generates a new Ed25519 identity key.
+// The private key, marshalled in the libp2p protobuf format, is returned.
+func GenerateIdentityKey() ([]byte, error) {
+	privateKey, _, err := crypto.GenerateKeyPair(crypto.Ed25519, -1)
+	if err != nil {
+		return nil, err
+	}
+	return crypto.MarshalPrivateKey(privateKey)
+}
+
+// IdentityPeerID derives the peer ID of an identity key.
+// The private key, marshalled in the libp2p protobuf format, has to be given.
+// The peer ID is returned.
+func IdentityPeerID(keyBytes []byte) (peer.ID, error) {
+	privateKey, err := crypto.UnmarshalPrivateKey(keyBytes)
+	if err != nil {
+		return "", err
+	}
+	return peer.IDFromPrivateKey(privateKey)
+}
+
+// fileEncryptionCipher creates the AEAD cipher of a key file.
+// A passphrase and a salt have to be given.
+func fileEncryptionCipher(passphrase string, salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key([]byte(passphrase), salt, scryptN, scryptR, scryptP, scryptKeyLen)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// SaveIdentityKey stores an identity key in a passphrase-encrypted key file.
+// An existing file is overwritten.
+// A file path, a passphrase and the marshalled private key have to be given.
+func SaveIdentityKey(path string, passphrase string, keyBytes []byte) error {
+	if _, err := crypto.UnmarshalPrivateKey(keyBytes); err != nil {
+		return err
+	}
+	salt := make([]byte, saltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+	aead, err := fileEncryptionCipher(passphrase, salt)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	content, err := json.Marshal(&keyFile{
+		Version:    keyFileVersion,
+		Salt:       salt,
+		Nonce:      nonce,
+		Ciphertext: aead.Seal(nil, nonce, keyBytes, nil),
+	})
+	if err != nil {
+		return err
+	}
+
+	// write to a temporary file first, so an existing key is never left half-written
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	tmpPath := path + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, content, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// LoadIdentityKey loads an identity key from a passphrase-encrypted key file.
+// A file path and a passphrase have to be given.
+// The marshalled private key is returned.
+func LoadIdentityKey(path string, passphrase string) ([]byte, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	file := &keyFile{}
+	if err := json.Unmarshal(content, file); err != nil {
+		return nil, err
+	}
+	if file.Version != keyFileVersion {
+		return nil, fmt.Errorf("unsupported key file version: %d", file.Version)
+	}
+	aead, err := fileEncryptionCipher(passphrase, file.Salt)
+	if err != nil {
+		return nil, err
+	}
+	if len(file.Nonce) != aead.NonceSize() {
+		return nil, ErrWrongPassphrase
+	}
+	keyBytes, err := aead.Open(nil, file.Nonce, file.Ciphertext, nil)
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+	return keyBytes, nil
+}
+
+// loadOrCreateIdentityKey loads the identity key of a key file.
+// If the key file does not exist, a new key is generated and stored.
+// A file path and a passphrase have to be given.
+// The marshalled private key is returned.
+func loadOrCreateIdentityKey(path string, passphrase string) ([]byte, error) {
+	keyBytes, err := LoadIdentityKey(path, passphrase)
+	if err == nil || !os.IsNotExist(err) {
+		return keyBytes, err
+	}
+	keyBytes, err = GenerateIdentityKey()
+	if err != nil {
+		return nil, err
+	}
+	return keyBytes, SaveIdentityKey(path, passphrase, keyBytes)
+}
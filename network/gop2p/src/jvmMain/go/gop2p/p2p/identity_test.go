@@ -0,0 +1,150 @@
+/*
+ * Copyright (c) 2021 The biotopium Authors.
+ * This file is part of biotopium.
+ *
+ * biotopium is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * biotopium is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with biotopium.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package p2p
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// saveTestKeyFile stores a new identity key in a key file.
+// The marshalled private key is returned.
+func saveTestKeyFile(t *testing.T, path string, passphrase string) []byte {
+	_, keyBytes := newTestKey(t)
+	if err := SaveIdentityKey(path, passphrase, keyBytes); err != nil {
+		t.Fatal(err)
+	}
+	return keyBytes
+}
+
+func TestIdentityKeyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys", "identity.key")
+	keyBytes := saveTestKeyFile(t, path, "passphrase")
+
+	loaded, err := LoadIdentityKey(path, "passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(loaded, keyBytes) {
+		t.Error("expected the loaded key to equal the saved key")
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := info.Mode().Perm(); mode != 0600 {
+		t.Errorf("expected the key file to be readable by the owner only, got %v", mode)
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(content, keyBytes) {
+		t.Error("expected the key file not to contain the plain key")
+	}
+
+	if _, err := LoadIdentityKey(path, "wrong passphrase"); !errors.Is(err, ErrWrongPassphrase) {
+		t.Errorf("expected %v, got %v", ErrWrongPassphrase, err)
+	}
+}
+
+func TestCorruptedIdentityKeyFile(t *testing.T) {
+	tests := map[string]func(file *keyFile){
+		"flipped ciphertext bit": func(file *keyFile) { file.Ciphertext[0] ^= 1 },
+		"truncated ciphertext":   func(file *keyFile) { file.Ciphertext = file.Ciphertext[:len(file.Ciphertext)-1] },
+		"short nonce":            func(file *keyFile) { file.Nonce = file.Nonce[:4] },
+		"other salt":             func(file *keyFile) { file.Salt[0] ^= 1 },
+	}
+	for name, corrupt := range tests {
+		path := filepath.Join(t.TempDir(), "identity.key")
+		saveTestKeyFile(t, path, "passphrase")
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		file := &keyFile{}
+		if err := json.Unmarshal(content, file); err != nil {
+			t.Fatal(err)
+		}
+		corrupt(file)
+		if content, err = json.Marshal(file); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, content, 0600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadIdentityKey(path, "passphrase"); !errors.Is(err, ErrWrongPassphrase) {
+			t.Errorf("%s: expected %v, got %v", name, ErrWrongPassphrase, err)
+		}
+	}
+
+	malformed := map[string]string{
+		"not JSON":        "not a key file",
+		"unknown version": `{"version":2}`,
+	}
+	for name, content := range malformed {
+		path := filepath.Join(t.TempDir(), "identity.key")
+		if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadIdentityKey(path, "passphrase"); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestLoadOrCreateIdentityKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "identity.key")
+	created, err := loadOrCreateIdentityKey(path, "passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := IdentityPeerID(created); err != nil {
+		t.Errorf("expected a valid identity key, got %v", err)
+	}
+	loaded, err := loadOrCreateIdentityKey(path, "passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(loaded, created) {
+		t.Error("expected the existing key to be loaded instead of creating a new one")
+	}
+	// an existing key is never replaced, even if the passphrase is wrong
+	if _, err := loadOrCreateIdentityKey(path, "wrong passphrase"); !errors.Is(err, ErrWrongPassphrase) {
+		t.Errorf("expected %v, got %v", ErrWrongPassphrase, err)
+	}
+	if loaded, err := LoadIdentityKey(path, "passphrase"); err != nil || !bytes.Equal(loaded, created) {
+		t.Errorf("expected the key file to be unchanged, got %v", err)
+	}
+}
+
+func TestSaveInvalidIdentityKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "identity.key")
+	if err := SaveIdentityKey(path, "passphrase", []byte("not a key")); err == nil {
+		t.Error("expected an error")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expected no key file to be written, got %v", err)
+	}
+}
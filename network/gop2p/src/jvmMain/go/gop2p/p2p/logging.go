@@ -0,0 +1,134 @@
+/*
+ * Copyright (c) 2021 The biotopium Authors.
+ * This file is part of biotopium.
+ *
+ * biotopium is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * biotopium is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with biotopium.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package p2p
+
+import (
+	"bufio"
+	"errors"
+	logging "github.com/ipfs/go-log/v2"
+	"strings"
+	"sync"
+)
+
+// LogSubsystem is the name of the logging subsystem of the p2p package.
+// The libp2p libraries log using their own subsystems, e.g. pubsub or dht.
+const LogSubsystem = "gop2p"
+
+// DefaultLogLevel is the default level of the p2p package's subsystem.
+const DefaultLogLevel = "info"
+
+// logger is the structured, leveled logger of the p2p package.
+var logger = logging.Logger(LogSubsystem)
+
+// The levels set using this package, reapplied when the logging output is changed
+var (
+	levelMutex      sync.Mutex
+	allLevel        = logging.LevelError                               // level of all subsystems
+	subsystemLevels = map[string]string{LogSubsystem: DefaultLogLevel} // levels of single subsystems
+)
+
+func init() {
+	_ = logging.SetLogLevel(LogSubsystem, DefaultLogLevel)
+}
+
+// SetLogLevel sets the level of all logging subsystems, including the subsystems of libp2p.
+// The level (debug, info, warn, error, dpanic, panic or fatal) has to be given.
+func SetLogLevel(level string) error {
+	lvl, err := logging.LevelFromString(level)
+	if err != nil {
+		return err
+	}
+	levelMutex.Lock()
+	defer levelMutex.Unlock()
+	logging.SetAllLoggers(lvl)
+	allLevel = lvl
+	subsystemLevels = make(map[string]string)
+	return nil
+}
+
+// SetSubsystemLogLevel sets the level of a single logging subsystem.
+// The name of the subsystem and the level have to be given.
+func SetSubsystemLogLevel(subsystem string, level string) error {
+	levelMutex.Lock()
+	defer levelMutex.Unlock()
+	if err := logging.SetLogLevel(subsystem, level); err != nil {
+		return err
+	}
+	subsystemLevels[subsystem] = level
+	return nil
+}
+
+// LogSubsystems returns the names of all logging subsystems.
+func LogSubsystems() []string {
+	return logging.GetSubsystems()
+}
+
+// The channel of the forwarded log records, nil if the log records are written to stderr
+var (
+	forwardMutex sync.Mutex
+	forwarded    chan string
+)
+
+// ForwardLogs forwards the log records of all subsystems to a channel instead of writing them to stderr.
+// Log records are dropped if the channel is full, logging never blocks the network.
+// The capacity of the channel has to be given.
+// The channel of the log records as JSON objects is returned.
+func ForwardLogs(capacity int) (<-chan string, error) {
+	forwardMutex.Lock()
+	defer forwardMutex.Unlock()
+	if forwarded != nil {
+		return nil, errors.New("log records are already forwarded")
+	}
+	forwarded = make(chan string, capacity)
+	records := forwarded
+	pipe := logging.NewPipeReader(logging.PipeFormat(logging.JSONOutput))
+	go func() {
+		reader := bufio.NewReader(pipe)
+		for {
+			record, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			select {
+			case records <- strings.TrimSuffix(record, "\n"):
+			default:
+			}
+		}
+	}()
+
+	// replace the stderr output by no output, which resets the levels
+	levelMutex.Lock()
+	defer levelMutex.Unlock()
+	logging.SetupLogging(logging.Config{
+		Format: logging.JSONOutput,
+		Level:  allLevel,
+	})
+	for subsystem, level := range subsystemLevels {
+		_ = logging.SetLogLevel(subsystem, level)
+	}
+	return records, nil
+}
+
+// LogRecords returns the channel of the forwarded log records.
+// Nil is returned if the log records are not forwarded.
+func LogRecords() <-chan string {
+	forwardMutex.Lock()
+	defer forwardMutex.Unlock()
+	return forwarded
+}
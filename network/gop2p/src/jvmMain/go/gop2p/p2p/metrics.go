@@ -0,0 +1,254 @@
+/*
+ * Copyright (c) 2021 The biotopium Authors.
+ * This file is part of biotopium.
+ *
+ * biotopium is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * biotopium is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with biotopium.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package p2p
+
+import (
+	"github.com/libp2p/go-libp2p-core/metrics"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/protocol"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	"strings"
+	"sync"
+)
+
+// MessageCounts counts the messages of a protocol or topic.
+type MessageCounts struct {
+	Sent       uint64 `json:"sent"`       // sent or published messages
+	Received   uint64 `json:"received"`   // received and delivered messages
+	Rejected   uint64 `json:"rejected"`   // messages rejected or ignored during validation
+	Duplicates uint64 `json:"duplicates"` // messages received more than once
+}
+
+// Metrics collects traffic metrics of a peer-to-peer instance.
+type Metrics struct {
+	Bandwidth *metrics.BandwidthCounter // bandwidth reporter of the host
+
+	mutex    sync.Mutex
+	messages map[string]*MessageCounts // message counts indexed by protocol ID or metrics label of the topic
+	rejects  map[string]uint64         // validation rejects indexed by reason
+}
+
+// NewMetrics is the factory function of the Metrics struct.
+// A pointer to new, empty metrics is returned.
+func NewMetrics() *Metrics {
+	return &Metrics{
+		Bandwidth: metrics.NewBandwidthCounter(),
+		messages:  make(map[string]*MessageCounts),
+		rejects:   make(map[string]uint64),
+	}
+}
+
+// metricsLabel returns the name under which the messages of a protocol or topic are counted.
+// The topics of all areas are counted together, e.g. <topic>/area/3/4/gzip as <topic>/area/gzip,
+// hence the number of labels does not grow with the number of visited areas.
+// The protocol ID or topic name has to be given.
+func metricsLabel(name string) string {
+	i := strings.Index(name, areaSegment)
+	if i < 0 {
+		return name
+	}
+	label := name[:i] + strings.TrimSuffix(areaSegment, "/")
+	for _, suffix := range []string{compressionSuffix, binarySuffix} {
+		if strings.HasSuffix(name, suffix) {
+			return label + suffix
+		}
+	}
+	return label
+}
+
+// count updates the message counts of a protocol or topic.
+// The protocol ID or topic name and the update function have to be given.
+func (m *Metrics) count(name string, update func(*MessageCounts)) {
+	if m == nil {
+		return
+	}
+	label := metricsLabel(name)
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	counts, ok := m.messages[label]
+	if !ok {
+		counts = &MessageCounts{}
+		m.messages[label] = counts
+	}
+	update(counts)
+}
+
+// countSent counts a sent message.
+// The protocol ID or topic name has to be given.
+func (m *Metrics) countSent(name string) {
+	m.count(name, func(c *MessageCounts) { c.Sent++ })
+}
+
+// countReceived counts a received message.
+// The protocol ID or topic name has to be given.
+func (m *Metrics) countReceived(name string) {
+	m.count(name, func(c *MessageCounts) { c.Received++ })
+}
+
+// countRejected counts a message rejected during validation.
+// The topic name and the reason have to be given.
+func (m *Metrics) countRejected(name string, reason string) {
+	m.count(name, func(c *MessageCounts) { c.Rejected++ })
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.rejects[reason]++
+}
+
+// countDuplicate counts a message received more than once.
+// The topic name has to be given.
+func (m *Metrics) countDuplicate(name string) {
+	m.count(name, func(c *MessageCounts) { c.Duplicates++ })
+}
+
+// BandwidthStats represents the traffic in bytes and the current rates in bytes per second.
+type BandwidthStats struct {
+	TotalIn  int64   `json:"totalIn"`  // received bytes
+	TotalOut int64   `json:"totalOut"` // sent bytes
+	RateIn   float64 `json:"rateIn"`   // received bytes per second
+	RateOut  float64 `json:"rateOut"`  // sent bytes per second
+}
+
+// newBandwidthStats converts bandwidth statistics of the bandwidth reporter.
+// The statistics have to be given.
+func newBandwidthStats(stats metrics.Stats) BandwidthStats {
+	return BandwidthStats{
+		TotalIn:  stats.TotalIn,
+		TotalOut: stats.TotalOut,
+		RateIn:   stats.RateIn,
+		RateOut:  stats.RateOut,
+	}
+}
+
+// ConnectionCounts represents the number of connected peers and open connections.
+type ConnectionCounts struct {
+	Peers    int `json:"peers"`    // connected peers
+	Inbound  int `json:"inbound"`  // inbound connections
+	Outbound int `json:"outbound"` // outbound connections
+}
+
+// MetricsSnapshot represents a snapshot of the metrics of a peer-to-peer instance.
+type MetricsSnapshot struct {
+	Bandwidth   BandwidthStats            `json:"bandwidth"`   // total traffic
+	Protocols   map[string]BandwidthStats `json:"protocols"`   // traffic indexed by protocol ID
+	Messages    map[string]MessageCounts  `json:"messages"`    // message counts indexed by protocol ID or metrics label of the topic
+	Rejects     map[string]uint64         `json:"rejects"`     // validation rejects indexed by reason
+	Queues      map[string]int            `json:"queues"`      // messages waiting for the host indexed by queue
+	Connections ConnectionCounts          `json:"connections"` // connection counts
+}
+
+// Metrics creates a snapshot of the metrics.
+func (s *Server) Metrics() *MetricsSnapshot {
+	snapshot := &MetricsSnapshot{
+		Bandwidth: newBandwidthStats(s.Traffic.Bandwidth.GetBandwidthTotals()),
+		Protocols: make(map[string]BandwidthStats),
+		Messages:  make(map[string]MessageCounts),
+		Rejects:   make(map[string]uint64),
+		Queues: map[string]int{
+			"pubsub": len(s.PubSub.Messages),
+			"areas":  len(s.Areas.Messages),
+			"stream": len(s.Stream.Messages),
+		},
+	}
+	for id, stats := range s.Traffic.Bandwidth.GetBandwidthByProtocol() {
+		snapshot.Protocols[string(id)] = newBandwidthStats(stats)
+	}
+
+	s.Traffic.mutex.Lock()
+	for name, counts := range s.Traffic.messages {
+		snapshot.Messages[name] = *counts
+	}
+	for reason, count := range s.Traffic.rejects {
+		snapshot.Rejects[reason] = count
+	}
+	s.Traffic.mutex.Unlock()
+
+	snapshot.Connections.Peers = len(s.Host.Network().Peers())
+	for _, conn := range s.Host.Network().Conns() {
+		if conn.Stat().Direction == network.DirInbound {
+			snapshot.Connections.Inbound++
+		} else {
+			snapshot.Connections.Outbound++
+		}
+	}
+	return snapshot
+}
+
+// metricsTracer counts received pubsub messages per topic.
+// Messages published by the local peer are not traced, they are counted when publishing.
+type metricsTracer struct {
+	metrics *Metrics // metrics to update
+}
+
+// metricsTracerOption creates the pubsub option counting received messages per topic.
+// The metrics have to be given.
+func metricsTracerOption(m *Metrics) pubsub.Option {
+	return pubsub.WithRawTracer(&metricsTracer{metrics: m})
+}
+
+// DeliverMessage counts a delivered message.
+func (t *metricsTracer) DeliverMessage(msg *pubsub.Message) {
+	t.metrics.countReceived(msg.GetTopic())
+}
+
+// RejectMessage counts a message rejected during validation.
+func (t *metricsTracer) RejectMessage(msg *pubsub.Message, reason string) {
+	t.metrics.countRejected(msg.GetTopic(), reason)
+}
+
+// DuplicateMessage counts a message received more than once.
+func (t *metricsTracer) DuplicateMessage(msg *pubsub.Message) {
+	t.metrics.countDuplicate(msg.GetTopic())
+}
+
+// AddPeer is not traced.
+func (t *metricsTracer) AddPeer(peer.ID, protocol.ID) {}
+
+// RemovePeer is not traced.
+func (t *metricsTracer) RemovePeer(peer.ID) {}
+
+// Join is not traced.
+func (t *metricsTracer) Join(string) {}
+
+// Leave is not traced.
+func (t *metricsTracer) Leave(string) {}
+
+// Graft is not traced.
+func (t *metricsTracer) Graft(peer.ID, string) {}
+
+// Prune is not traced.
+func (t *metricsTracer) Prune(peer.ID, string) {}
+
+// ValidateMessage is not traced.
+func (t *metricsTracer) ValidateMessage(*pubsub.Message) {}
+
+// ThrottlePeer is not traced.
+func (t *metricsTracer) ThrottlePeer(peer.ID) {}
+
+// RecvRPC is not traced.
+func (t *metricsTracer) RecvRPC(*pubsub.RPC) {}
+
+// SendRPC is not traced.
+func (t *metricsTracer) SendRPC(*pubsub.RPC, peer.ID) {}
+
+// DropRPC is not traced.
+func (t *metricsTracer) DropRPC(*pubsub.RPC, peer.ID) {}
+
+// UndeliverableMessage is not traced.
+func (t *metricsTracer) UndeliverableMessage(*pubsub.Message) {}
@@ -0,0 +1,48 @@
+/*
+ * Copyright (c) 2021 The biotopium Authors.
+ * This file is part of biotopium.
+ *
+ * biotopium is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * biotopium is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with biotopium.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package p2p
+
+import "testing"
+
+func TestMetricsLabel(t *testing.T) {
+	tests := map[string]string{
+		testTopic:                                  testTopic,
+		compressedVariant(testTopic):               compressedVariant(testTopic),
+		testTopic + "/area/3/4":                    testTopic + "/area",
+		compressedVariant(testTopic + "/area/3/4"): compressedVariant(testTopic + "/area"),
+		binaryVariant(testTopic + "/area/0/12"):    binaryVariant(testTopic + "/area"),
+		"/biotopium/direct/1.0.0":                  "/biotopium/direct/1.0.0",
+	}
+	for name, expected := range tests {
+		if label := metricsLabel(name); label != expected {
+			t.Errorf("%s: expected the label %s, got %s", name, expected, label)
+		}
+	}
+
+	m := NewMetrics()
+	m.countSent(testTopic + "/area/1/1")
+	m.countSent(testTopic + "/area/2/1")
+	m.countReceived(testTopic + "/area/1/2")
+	if len(m.messages) != 1 {
+		t.Errorf("expected the area topics to be counted together, got %d labels", len(m.messages))
+	}
+	if counts := m.messages[testTopic+"/area"]; counts == nil || counts.Sent != 2 || counts.Received != 1 {
+		t.Errorf("expected 2 sent and 1 received messages, got %+v", counts)
+	}
+}
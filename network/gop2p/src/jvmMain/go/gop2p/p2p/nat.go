@@ -0,0 +1,108 @@
+/*
+ * Copyright (c) 2021 The biotopium Authors.
+ * This file is part of biotopium.
+ *
+ * biotopium is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * biotopium is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with biotopium.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package p2p
+
+import (
+	"context"
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p-core/event"
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+	circuit "github.com/libp2p/go-libp2p-circuit"
+	maddr "github.com/multiformats/go-multiaddr"
+	"strings"
+	"sync"
+)
+
+// relayOptions creates the libp2p options for relaying and NAT traversal.
+// A configuration has to be given.
+// The libp2p options are returned, an error if a static relay address is malformed.
+func relayOptions(config *config) ([]libp2p.Option, error) {
+	var options []libp2p.Option
+	if config.RelayHop {
+		options = append(options, libp2p.EnableRelay(circuit.OptHop))
+	}
+	if config.NATService {
+		options = append(options, libp2p.EnableNATService())
+	}
+	if len(config.StaticRelays) > 0 {
+		relays := make([]peer.AddrInfo, 0, len(config.StaticRelays))
+		for _, relayAddrStr := range config.StaticRelays {
+			relayAddr, err := maddr.NewMultiaddr(relayAddrStr)
+			if err != nil {
+				return nil, err
+			}
+			relayInfo, err := peer.AddrInfoFromP2pAddr(relayAddr)
+			if err != nil {
+				return nil, err
+			}
+			relays = append(relays, *relayInfo)
+		}
+		options = append(options, libp2p.StaticRelays(relays))
+	}
+	return options, nil
+}
+
+// reachabilityTracker keeps track of the reachability of the local peer.
+type reachabilityTracker struct {
+	mutex        sync.RWMutex
+	reachability network.Reachability
+}
+
+// trackReachability starts tracking the reachability of the local peer.
+// A context and the host have to be given.
+// A reachability tracker is returned.
+func trackReachability(ctx context.Context, h host.Host) (*reachabilityTracker, error) {
+	tracker := &reachabilityTracker{
+		reachability: network.ReachabilityUnknown,
+	}
+	sub, err := h.EventBus().Subscribe(new(event.EvtLocalReachabilityChanged))
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		defer sub.Close()
+		for {
+			select {
+			case evt, ok := <-sub.Out():
+				if !ok {
+					return
+				}
+				reachability := evt.(event.EvtLocalReachabilityChanged).Reachability
+				tracker.mutex.Lock()
+				tracker.reachability = reachability
+				tracker.mutex.Unlock()
+				logger.Infow("Reachability changed", "reachability", reachability.String())
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return tracker, nil
+}
+
+// Reachability returns the current reachability of the local peer.
+// Either "public", "private" or "unknown" is returned.
+func (s *Server) Reachability() string {
+	s.reachability.mutex.RLock()
+	defer s.reachability.mutex.RUnlock()
+	return strings.ToLower(s.reachability.reachability.String())
+}
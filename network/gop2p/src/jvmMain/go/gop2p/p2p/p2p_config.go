@@ -18,24 +18,261 @@
 
 package p2p
 
+import "time"
+
+// DefaultBanDuration is the default duration peers exceeding rate limits are banned.
+const DefaultBanDuration = 10 * time.Minute
+
+// DefaultPeerLookupTimeout is the default timeout for looking up and dialing a peer.
+const DefaultPeerLookupTimeout = 15 * time.Second
+
 // config represent the configuration of a peer-to-peer instance.
 type config struct {
-	Topic        string // topic to listen to
-	ProtocolName string // protocol name
-	Port         int    // port to listen on
-	PKBytes      []byte // bytes for private key
-	BootstrapPeers []string // bootstrap peers
+	Topic              string               // topic to listen to
+	ProtocolName       string               // protocol name
+	Port               int                  // port to listen on
+	PKBytes            []byte               // bytes for private key
+	BootstrapPeers     []string             // bootstrap peers
+	PeerLookupTimeout  time.Duration        // timeout for looking up and dialing a peer
+	RelayHop           bool                 // whether to relay traffic for other peers
+	NATService         bool                 // whether to offer the AutoNAT service to other peers
+	StaticRelays       []string             // relays to use instead of discovering them
+	KeyFilePath        string               // path of the identity key file
+	KeyFilePassphrase  string               // passphrase of the identity key file
+	PlayerKey          string               // base64 encoded raw Ed25519 private key of the player
+	TrustedPeers       []string             // peer IDs of the trusted blocklords
+	TrustedAddresses   []string             // addresses of the trusted blocklords
+	BlockStorePath     string               // path of the block store file
+	SeenCacheTTL       time.Duration        // duration a received action request is remembered
+	CompressDirect     bool                 // whether to compress direct messages if supported by the receiver
+	CompressPubSub     bool                 // whether to publish compressed pubsub messages
+	BinaryDirect       bool                 // whether to send binary encoded direct messages if supported by the receiver
+	BinaryPubSub       bool                 // whether to publish binary encoded pubsub messages
+	AreaSize           uint32               // number of realms per side of an area topic
+	CompatibleVersions []string             // protocol versions supported besides the versions compatible with the configured one
+	RateLimits         map[string]RateLimit // token bucket limits per peer indexed by protocol
+	BanThreshold       uint64               // number of rate limit violations resulting in a ban, 0 if disabled
+	BanDuration        time.Duration        // duration of a ban
+	MetricsAddress     string               // listen address of the Prometheus metrics listener
+	PingInterval       time.Duration        // interval of measuring the latency to connected peers, 0 if disabled
+	AgentVersion       string               // agent version announced through identify, libp2p's default if empty
+	TraceFile          string               // path of the gossipsub trace file, disabled if empty
+	TraceFormat        string               // format of the gossipsub trace file
+	TraceBufferSize    int                  // number of recent gossipsub trace events kept in memory, 0 if disabled
+}
+
+// Option represents an optional configuration value of a peer-to-peer instance.
+type Option func(*config)
+
+// WithPeerLookupTimeout sets the timeout for looking up and dialing a peer.
+// A positive timeout has to be given, other timeouts are rejected when the server is created.
+func WithPeerLookupTimeout(timeout time.Duration) Option {
+	return func(c *config) {
+		c.PeerLookupTimeout = timeout
+	}
+}
+
+// WithRelayHop enables relaying traffic on behalf of other peers.
+func WithRelayHop() Option {
+	return func(c *config) {
+		c.RelayHop = true
+	}
+}
+
+// WithNATService enables the AutoNAT service, other peers can determine their reachability using it.
+func WithNATService() Option {
+	return func(c *config) {
+		c.NATService = true
+	}
+}
+
+// WithStaticRelays sets the relays to use.
+// The multiaddresses of the relays, each containing a peer ID, have to be given.
+func WithStaticRelays(relays []string) Option {
+	return func(c *config) {
+		c.StaticRelays = relays
+	}
+}
+
+// WithIdentityKeyFile sets the passphrase-encrypted key file holding the identity key.
+// The key file is only used if no private key bytes are given.
+// If the key file does not exist, it is created containing a new key.
+// A file path and a passphrase have to be given.
+func WithIdentityKeyFile(path string, passphrase string) Option {
+	return func(c *config) {
+		c.KeyFilePath = path
+		c.KeyFilePassphrase = passphrase
+	}
+}
+
+// WithPlayerKey sets the private key of the player's key pair as identity key.
+// The peer ID of the node is then derivable from the player's address.
+// The player key is only used if no private key bytes are given.
+// The base64 encoded raw Ed25519 private key has to be given.
+func WithPlayerKey(privateKeyBase64 string) Option {
+	return func(c *config) {
+		c.PlayerKey = privateKeyBase64
+	}
+}
+
+// WithTrustedBlocklords sets the trusted blocklords.
+// Block announcements not originating from them are rejected.
+// The peer IDs and the addresses of the trusted blocklords have to be given.
+func WithTrustedBlocklords(peerIDs []string, addresses []string) Option {
+	return func(c *config) {
+		c.TrustedPeers = peerIDs
+		c.TrustedAddresses = addresses
+	}
+}
+
+// WithBlockStore enables the persistent block store.
+// Accepted block announcements are stored and chain requests are answered from the store.
+// A file path has to be given.
+func WithBlockStore(path string) Option {
+	return func(c *config) {
+		c.BlockStorePath = path
+	}
+}
+
+// WithSeenCacheTTL sets the duration a received action request is remembered.
+// Duplicates received within the duration are dropped.
+// A duration has to be given.
+func WithSeenCacheTTL(ttl time.Duration) Option {
+	return func(c *config) {
+		c.SeenCacheTTL = ttl
+	}
+}
+
+// WithCompression enables compression of sent messages.
+// Direct messages are only compressed if the receiver supports the compressed protocol variant.
+// Compressed pubsub messages are published to the compressed topic variant,
+// which is only joined by peers supporting compression.
+// Hence, pubsub compression should only be enabled once all peers support it.
+// Whether to compress direct and pubsub messages has to be given.
+func WithCompression(direct bool, pubSub bool) Option {
+	return func(c *config) {
+		c.CompressDirect = direct
+		c.CompressPubSub = pubSub
+	}
+}
+
+// WithBinaryEncoding enables the binary encoding of sent messages.
+// Direct messages are only binary encoded if the receiver supports the binary protocol variant.
+// Binary encoded pubsub messages are published to the binary topic variant,
+// which is only joined by peers supporting the binary encoding.
+// Hence, the binary pubsub encoding should only be enabled once all peers support it.
+// Whether to binary encode direct and pubsub messages has to be given.
+func WithBinaryEncoding(direct bool, pubSub bool) Option {
+	return func(c *config) {
+		c.BinaryDirect = direct
+		c.BinaryPubSub = pubSub
+	}
+}
+
+// WithAreaSize sets the number of realms per side of an area sharing an area-of-interest topic.
+// A size of 1 results in one topic per realm, larger sizes group neighbouring realms into chunks.
+// The size has to be given.
+func WithAreaSize(size uint32) Option {
+	return func(c *config) {
+		c.AreaSize = size
+	}
+}
+
+// WithCompatibleVersions sets the protocol versions supported besides the version of the protocol and topic names.
+// Protocol IDs of versions compatible with the configured version are accepted anyway,
+// the explicitly supported versions are additionally advertised, used as fallback when sending
+// and their topics are listened and published to.
+// This allows to roll out breaking message changes gradually.
+// The supported versions of the form major.minor.patch have to be given.
+func WithCompatibleVersions(versions []string) Option {
+	return func(c *config) {
+		c.CompatibleVersions = versions
+	}
+}
+
+// WithRateLimit limits the streams or pubsub messages per peer of a protocol using a token bucket.
+// Excess streams are reset, excess pubsub messages are ignored.
+// The protocol (RateLimitDirect, RateLimitSync or RateLimitPubSub),
+// the tokens added per second and the maximum number of tokens have to be given.
+// Unknown protocols and negative limits are rejected when the server is created.
+func WithRateLimit(protocol string, rate float64, burst int) Option {
+	return func(c *config) {
+		c.RateLimits[protocol] = RateLimit{Rate: rate, Burst: burst}
+	}
+}
+
+// WithAutoBan enables banning peers exceeding rate limits.
+// Banned peers are disconnected and their connections are rejected until the ban ends.
+// The number of violations resulting in a ban and the duration of a ban have to be given.
+func WithAutoBan(threshold uint64, duration time.Duration) Option {
+	return func(c *config) {
+		c.BanThreshold = threshold
+		c.BanDuration = duration
+	}
+}
+
+// WithMetricsListener enables the HTTP listener exporting the metrics on /metrics in the Prometheus format.
+// The listener should be bound to a local address, e.g. 127.0.0.1:9464.
+// The listen address has to be given.
+func WithMetricsListener(address string) Option {
+	return func(c *config) {
+		c.MetricsAddress = address
+	}
+}
+
+// WithPingInterval sets the interval of measuring the latency to connected peers.
+// The interval has to be given, 0 disables the periodic measurement.
+func WithPingInterval(interval time.Duration) Option {
+	return func(c *config) {
+		c.PingInterval = interval
+	}
+}
+
+// WithAgentVersion sets the agent version announced to other peers through identify.
+// The agent version, e.g. biotopium-jvm/0.1.0 or biotopium-blocklord/0.1.0, has to be given.
+func WithAgentVersion(agentVersion string) Option {
+	return func(c *config) {
+		c.AgentVersion = agentVersion
+	}
+}
+
+// WithTraceFile writes the gossipsub trace events to a file.
+// The path of the trace file and its format ("json" or "pb") have to be given.
+func WithTraceFile(path string, format string) Option {
+	return func(c *config) {
+		c.TraceFile = path
+		c.TraceFormat = format
+	}
+}
+
+// WithTraceBuffer keeps the most recent gossipsub trace events in memory.
+// The number of kept events has to be given, negative numbers are rejected when the server is created.
+func WithTraceBuffer(size int) Option {
+	return func(c *config) {
+		c.TraceBufferSize = size
+	}
 }
 
 // NewConfig is the factory function of the config struct.
 // A topic, a protocol name, a port, bootstrap peers and private key bytes have to be given.
+// Options can be given optionally.
 // A pointer to a new P2PConfig is returned.
-func NewConfig(topic string, protocolName string, port int, bootstrapPeers []string, pkByte []byte) *config {
-	return &config{
-		Topic:        topic,
-		ProtocolName: protocolName,
-		Port:         port,
-		BootstrapPeers: bootstrapPeers,
-		PKBytes:      pkByte,
+func NewConfig(topic string, protocolName string, port int, bootstrapPeers []string, pkByte []byte, options ...Option) *config {
+	c := &config{
+		Topic:             topic,
+		ProtocolName:      protocolName,
+		Port:              port,
+		BootstrapPeers:    bootstrapPeers,
+		PKBytes:           pkByte,
+		PeerLookupTimeout: DefaultPeerLookupTimeout,
+		SeenCacheTTL:      DefaultSeenCacheTTL,
+		AreaSize:          DefaultAreaSize,
+		RateLimits:        make(map[string]RateLimit),
+		BanDuration:       DefaultBanDuration,
+		PingInterval:      DefaultPingInterval,
+	}
+	for _, option := range options {
+		option(c)
 	}
+	return c
 }
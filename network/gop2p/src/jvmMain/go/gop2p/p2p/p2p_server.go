@@ -30,28 +30,45 @@ import (
 	noise "github.com/libp2p/go-libp2p-noise"
 	pubsub "github.com/libp2p/go-libp2p-pubsub"
 	maddr "github.com/multiformats/go-multiaddr"
-	"log"
+	"net/http"
+	"riesenacht.ch/biotopium/network/gop2p/blockchain"
 	"riesenacht.ch/biotopium/network/gop2p/check"
 	"sync"
 )
 
-// server represents a peer-to-peer server.
-type server struct {
-	Host   host.Host          // P2P host
-	Config *config            // configuration
-	PubSub *PubSubTopic       // ps network
-	Stream *Stream            // stream
-	Cancel context.CancelFunc // running state
+// Server represents a peer-to-peer server.
+type Server struct {
+	Host           host.Host             // P2P host
+	Config         *config               // configuration
+	DHT            *dht.IpfsDHT          // distributed hash table
+	PubSub         *PubSubTopic          // ps network
+	Areas          *AreaTopics           // area-of-interest topics
+	PeerRecords    *PeerRecordBook       // verified peer records
+	MessageTypes   *MessageTypeFilter    // message types delivered to the host
+	BlockValidator *blockchain.Validator // validator of announced blocks
+	Blocklords     *BlocklordTrust       // trusted blocklords
+	Blocks         *blockchain.Store     // persistent block store, nil if disabled
+	Seen           *SeenCache            // hashes of received action records
+	Compression    *CompressionStats     // compression statistics
+	RateLimiter    *RateLimiter          // rate limits of streams and pubsub messages
+	Traffic        *Metrics              // traffic metrics
+	Trace          *TraceRecorder        // gossipsub trace events, nil if disabled
+	Stream         *Stream               // stream
+	Cancel         context.CancelFunc    // running state
+
+	reachability  *reachabilityTracker // reachability of the local peer
+	metricsServer *http.Server         // Prometheus metrics listener, nil if disabled
+	gapSync       int32                // 1 while a sync closing a height gap is running, accessed atomically
 }
 
 // The peer-to-peer server instance
-var instance *server
+var instance *Server
 
 // Instance provides access to the current p2p server instance.
 // The instance if not nil is returned.
-func Instance() *server {
+func Instance() *Server {
 	if instance == nil {
-		log.Fatalln("peer-to-peer server is not created yet.")
+		logger.Fatal("Peer-to-peer server is not created yet")
 		return nil
 	}
 	return instance
@@ -62,28 +79,70 @@ func PeerID() peer.ID {
 	return Instance().Host.ID()
 }
 
+// HostConstructor creates the host of a server, e.g. libp2p.New.
+// The context and the libp2p options have to be given.
+type HostConstructor func(ctx context.Context, options ...libp2p.Option) (host.Host, error)
+
 // StartP2PServer starts the peer-to-peer server with a given configuration.
 // A configuration has to be given.
-func StartP2PServer(config *config) {
-	instance = &server{
-		Config: config,
+// An error is returned if the configuration is invalid or the server could not be started.
+func StartP2PServer(config *config) error {
+	s, err := NewServer(config, libp2p.New)
+	if err != nil {
+		return err
+	}
+	instance = s
+	return nil
+}
+
+// NewServer creates and starts a peer-to-peer server without making it the current instance.
+// A configuration and the constructor of the host have to be given.
+// A pointer to the running server is returned.
+func NewServer(config *config, newHost HostConstructor) (_ *Server, err error) {
+	if config.PeerLookupTimeout <= 0 {
+		return nil, fmt.Errorf("invalid peer lookup timeout %s", config.PeerLookupTimeout)
+	}
+	blocklords, err := newBlocklordTrust(config.TrustedPeers, config.TrustedAddresses)
+	if err != nil {
+		return nil, err
+	}
+	limiter, err := NewRateLimiter(config.RateLimits, config.BanThreshold, config.BanDuration)
+	if err != nil {
+		return nil, err
 	}
+	s := &Server{
+		Config:       config,
+		MessageTypes: NewMessageTypeFilter(),
+		Blocklords:   blocklords,
+		Seen:         NewSeenCache(config.SeenCacheTTL),
+		Compression:  &CompressionStats{},
+		RateLimiter:  limiter,
+		Traffic:      NewMetrics(),
+	}
+	s.MessageTypes.Handle(MessageTypeActionReq, s.dropDuplicateAction)
+	s.BlockValidator = blockchain.NewValidator(s.Blocklords.IsTrustedAuthor)
 	ctx, cancel := context.WithCancel(context.Background())
-	instance.Cancel = cancel
+	s.Cancel = cancel
+	defer func() {
+		if err != nil {
+			_ = s.Stop()
+		}
+	}()
 
-	var err error
-	var privateKey crypto.PrivKey
-	if config.PKBytes != nil {
-		privateKey, err = crypto.UnmarshalPrivateKey(config.PKBytes)
-		check.Err(err)
-	} else {
-		privateKey, _, err = crypto.GenerateKeyPair(
-			crypto.Ed25519,
-			-1,
-		)
+	if len(config.BlockStorePath) > 0 {
+		s.Blocks, err = blockchain.OpenStore(config.BlockStorePath)
+		if err != nil {
+			return nil, err
+		}
+		s.MessageTypes.Handle(MessageTypeChainReq, s.answerChainRequest)
+	}
+
+	privateKey, err := identityKey(config)
+	if err != nil {
+		return nil, err
 	}
 
-	h, err := libp2p.New(ctx,
+	options := []libp2p.Option{
 		libp2p.Identity(privateKey),
 		libp2p.ListenAddrStrings(
 			fmt.Sprintf("/ip4/0.0.0.0/tcp/%d/ws/", config.Port),
@@ -92,23 +151,110 @@ func StartP2PServer(config *config) {
 		libp2p.EnableAutoRelay(), // Advertise node on relays
 		libp2p.DefaultTransports, // default transports, includes WebSockets and TCP
 		libp2p.Security(noise.ID, noise.New),
+		libp2p.Ping(true), // answer pings and measure latencies
+		libp2p.ConnectionGater(s.RateLimiter),
+		libp2p.BandwidthReporter(s.Traffic.Bandwidth),
 		libp2p.Routing(func(h host.Host) (routing.PeerRouting, error) {
 			dhtInstance, err := dht.New(
 				ctx,
 				h,
+				dht.ProtocolPrefix(DHTProtocolPrefix),
+				dht.NamespacedValidator(DHTNamespace, RecordValidator{}),
 			)
+			s.DHT = dhtInstance
 			return dhtInstance, err
 		}),
-	)
-	check.Err(err)
+	}
+	natOptions, err := relayOptions(config)
+	if err != nil {
+		return nil, err
+	}
+	options = append(options, natOptions...)
+	if len(config.AgentVersion) > 0 {
+		options = append(options, libp2p.UserAgent(config.AgentVersion))
+	}
+
+	h, err := newHost(ctx, options...)
+	if err != nil {
+		return nil, err
+	}
+	s.Host = h
+
+	s.reachability, err = trackReachability(ctx, h)
+	if err != nil {
+		return nil, err
+	}
+	if config.PingInterval > 0 {
+		measureLatencies(ctx, h, config.PingInterval)
+	}
+	s.RateLimiter.onBan = func(peerID peer.ID) {
+		_ = h.Network().ClosePeer(peerID)
+	}
+
+	supported, err := parseProtocolVersions(config.CompatibleVersions)
+	if err != nil {
+		return nil, err
+	}
+	var compatibleTopics []string
+	for _, version := range supported {
+		if name := withVersion(config.Topic, version); name != config.Topic {
+			compatibleTopics = append(compatibleTopics, name)
+		}
+	}
 
-	// connect to bootstrap peers concurrently
+	var topics []string
+	for _, name := range append([]string{config.Topic}, compatibleTopics...) {
+		topics = append(topics, name, compressedVariant(name), binaryVariant(name))
+	}
+	psOptions := []pubsub.Option{peerScoreOption(topics...), messageIDOption(), metricsTracerOption(s.Traffic)}
+	if len(config.TraceFile) > 0 || config.TraceBufferSize != 0 {
+		s.Trace, err = NewTraceRecorder(config.TraceBufferSize, config.TraceFile, config.TraceFormat)
+		if err != nil {
+			return nil, err
+		}
+		psOptions = append(psOptions, traceRecorderOption(s.Trace))
+	}
+	ps, err := pubsub.NewGossipSub(ctx, h, psOptions...)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, topic := range topics {
+		err = ps.RegisterTopicValidator(topic, s.topicValidator())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	s.PubSub, err = listenTopic(ctx, ps, config.Topic, h.ID(), s.MessageTypes, config.CompressPubSub, config.BinaryPubSub, s.Compression, s.Traffic, compatibleTopics)
+	if err != nil {
+		return nil, err
+	}
+
+	s.Areas = newAreaTopics(ctx, ps, s)
+
+	s.PeerRecords, err = listenPeerRecords(ctx, ps, h)
+	if err != nil {
+		return nil, err
+	}
+
+	stream := listenProtocol(s, supported)
+	s.Stream = stream
+
+	listenSync(h, s.Blocks, s.RateLimiter)
+
+	// connect to bootstrap peers concurrently once all protocols are handled,
+	// pubsub does not retry opening a stream to a peer which did not support it when connecting
 	var wg sync.WaitGroup
 	for _, peerAddrStr := range config.BootstrapPeers {
 		peerAddr, err := maddr.NewMultiaddr(peerAddrStr)
-		check.Err(err)
+		if err != nil {
+			return nil, err
+		}
 		peerInfo, err := peer.AddrInfoFromP2pAddr(peerAddr)
-		check.Err(err)
+		if err != nil {
+			return nil, err
+		}
 		wg.Add(1)
 		peerAddrStr := peerAddrStr
 
@@ -117,31 +263,86 @@ func StartP2PServer(config *config) {
 			defer wg.Done()
 			err := h.Connect(ctx, *peerInfo)
 			if err != nil {
-				fmt.Printf("Failed to connect to bootstrap peer: %s\n", peerAddrStr)
+				logger.Warnw("Failed to connect to bootstrap peer", "address", peerAddrStr, "error", err)
 			} else {
-				fmt.Printf("Conntected to bootstrap peer: %s\n", peerAddrStr)
+				logger.Infow("Connected to bootstrap peer", "address", peerAddrStr)
 			}
 		}()
 	}
 	wg.Wait()
 
-	instance.Host = h
-
-	ps, err := pubsub.NewGossipSub(ctx, h)
-	check.Err(err)
+	if len(config.MetricsAddress) > 0 {
+		s.metricsServer, err = serveMetrics(config.MetricsAddress, s.Metrics)
+		if err != nil {
+			return nil, err
+		}
+	}
 
-	psNet := listenTopic(ctx, ps, h.ID())
-	instance.PubSub = psNet
+	logger.Infow("P2P server started", "peer", h.ID().Pretty())
+	return s, nil
+}
 
-	stream := listenProtocol(h, config.ProtocolName)
-	instance.Stream = stream
+// topicValidator creates the pubsub validator of the topics carrying host messages.
+// Messages exceeding the rate limit are ignored before the blocks they announce are validated.
+func (s *Server) topicValidator() pubsub.ValidatorEx {
+	return chainValidators(s.RateLimiter.limitPubSub(s.Host.ID()), blockValidator(s.BlockValidator, s.Blocklords, s.storeBlock))
+}
 
-	log.Printf("P2P Server started with peer ID: %s\n", h.ID())
+// identityKey determines the private identity key of the host.
+// The key is taken from the private key bytes, the player key or the key file, in this order.
+// If none of them is configured, a new key is generated.
+// A configuration has to be given.
+// The private key is returned.
+func identityKey(config *config) (crypto.PrivKey, error) {
+	if config.PKBytes != nil {
+		return crypto.UnmarshalPrivateKey(config.PKBytes)
+	}
+	if len(config.PlayerKey) > 0 {
+		keyBytes, err := PlayerIdentityKey(config.PlayerKey)
+		if err != nil {
+			return nil, err
+		}
+		return crypto.UnmarshalPrivateKey(keyBytes)
+	}
+	if len(config.KeyFilePath) > 0 {
+		keyBytes, err := loadOrCreateIdentityKey(config.KeyFilePath, config.KeyFilePassphrase)
+		if err != nil {
+			return nil, err
+		}
+		return crypto.UnmarshalPrivateKey(keyBytes)
+	}
+	privateKey, _, err := crypto.GenerateKeyPair(
+		crypto.Ed25519,
+		-1,
+	)
+	return privateKey, err
 }
 
 // StopP2PServer stops the peer-to-peer instance.
 func StopP2PServer() {
-	defer instance.Cancel()
-	err := instance.Host.Close()
+	err := instance.Stop()
 	check.Err(err)
 }
+
+// Stop stops the server and releases its resources.
+// The first error encountered is returned, the remaining resources are released anyway.
+func (s *Server) Stop() error {
+	defer s.Cancel()
+	var errs []error
+	if s.Host != nil {
+		errs = append(errs, s.Host.Close())
+	}
+	if s.Blocks != nil {
+		errs = append(errs, s.Blocks.Close())
+	}
+	if s.metricsServer != nil {
+		errs = append(errs, s.metricsServer.Close())
+	}
+	s.Trace.Close()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,748 @@
+/*
+ * Copyright (c) 2021 The biotopium Authors.
+ * This file is part of biotopium.
+ *
+ * biotopium is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * biotopium is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with biotopium.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package p2p
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+	"io/ioutil"
+	"riesenacht.ch/biotopium/network/gop2p/blockchain"
+	"riesenacht.ch/biotopium/network/gop2p/internal/simnet"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Names of the topic and the protocol used in tests.
+const (
+	testTopic    = "/biotopium/0.1.0/test"
+	testProtocol = "/biotopium/0.1.0/test-direct"
+)
+
+// testTimeout is the maximum duration to wait for a message or a condition in tests.
+const testTimeout = 10 * time.Second
+
+// testProbeType is the message type of the probes checking whether pubsub delivers messages.
+// Probes are consumed by a native handler and never delivered to the host.
+const testProbeType = "TestProbeMessage"
+
+// testNetwork represents an in-memory network of servers connected through mocknet.
+type testNetwork struct {
+	t       *testing.T
+	net     *simnet.Network
+	servers []*Server
+
+	mutex  sync.Mutex
+	probes map[peer.ID]map[string]bool // received probes indexed by receiver
+	probe  int                         // sequence number of the last probe
+}
+
+// newTestNetwork creates an empty in-memory network, which is stopped after the test.
+func newTestNetwork(t *testing.T) *testNetwork {
+	n := &testNetwork{
+		t:      t,
+		net:    simnet.New(mocknet.LinkOptions{}, 0, 0),
+		probes: make(map[peer.ID]map[string]bool),
+	}
+	t.Cleanup(func() {
+		for _, s := range n.servers {
+			_ = s.Stop()
+		}
+	})
+	return n
+}
+
+// start starts a server bootstrapping from the first server of the network.
+// The configuration passes the same path as StartP2PServer.
+// Options of the configuration can be given.
+func (n *testNetwork) start(options ...Option) *Server {
+	var bootstrapPeers []string
+	if len(n.servers) > 0 {
+		first := n.servers[0].Host
+		bootstrapPeers = append(bootstrapPeers, fmt.Sprintf("%s/p2p/%s", first.Addrs()[0], first.ID()))
+	}
+	options = append([]Option{WithPingInterval(0), WithPeerLookupTimeout(testTimeout)}, options...)
+	config := NewConfig(testTopic, testProtocol, 0, bootstrapPeers, nil, options...)
+	s, err := NewServer(config, n.net.NewHost)
+	if err != nil {
+		n.t.Fatal(err)
+	}
+	receiver := s.Host.ID()
+	s.MessageTypes.Handle(testProbeType, func(envelope *Envelope, _ peer.ID) bool {
+		n.mutex.Lock()
+		defer n.mutex.Unlock()
+		if n.probes[receiver] == nil {
+			n.probes[receiver] = make(map[string]bool)
+		}
+		n.probes[receiver][string(envelope.Message)] = true
+		return true
+	})
+	n.servers = append(n.servers, s)
+	return s
+}
+
+// stop stops a server and unlinks it from the network.
+func (n *testNetwork) stop(s *Server) {
+	// unlink the server first, otherwise the other servers may redial it while it is stopping
+	n.net.Isolate(s.Host.ID())
+	if err := s.Stop(); err != nil {
+		n.t.Fatal(err)
+	}
+	for i, running := range n.servers {
+		if running == s {
+			n.servers = append(n.servers[:i], n.servers[i+1:]...)
+			break
+		}
+	}
+}
+
+// startAll starts a number of servers with the same options and waits until they have formed a mesh.
+func (n *testNetwork) startAll(count int, options ...Option) []*Server {
+	var servers []*Server
+	for i := 0; i < count; i++ {
+		servers = append(servers, n.start(options...))
+	}
+	n.connectAll()
+	return servers
+}
+
+// connectAll connects all servers to each other and waits until pubsub delivers their messages.
+func (n *testNetwork) connectAll() {
+	var peerIDs []peer.ID
+	for _, s := range n.servers {
+		peerIDs = append(peerIDs, s.Host.ID())
+	}
+	if err := n.net.ConnectAll(peerIDs); err != nil {
+		n.t.Fatal(err)
+	}
+	n.awaitPubSub()
+}
+
+// awaitPubSub waits until the messages of each server are delivered to all other servers.
+// Messages published before gossipsub has set up the connections are lost,
+// so probes are published until one of them arrives everywhere.
+func (n *testNetwork) awaitPubSub() {
+	deadline := time.Now().Add(testTimeout)
+	for _, sender := range n.servers {
+		for !n.probeDelivered(sender) {
+			if time.Now().After(deadline) {
+				n.t.Fatal("timed out waiting for pubsub delivery")
+			}
+		}
+	}
+}
+
+// probeDelivered publishes a probe and checks whether it is delivered to all other servers within a short duration.
+func (n *testNetwork) probeDelivered(sender *Server) bool {
+	n.mutex.Lock()
+	n.probe++
+	content := fmt.Sprintf(`{"class":"%s","seq":%d}`, testProbeType, n.probe)
+	n.mutex.Unlock()
+	envelope := fmt.Sprintf(`{"peerId":"%s","message":%s}`, sender.Host.ID().Pretty(), content)
+	if err := sender.PubSub.Publish([]byte(envelope)); err != nil {
+		n.t.Fatal(err)
+	}
+	delivered := func() bool {
+		n.mutex.Lock()
+		defer n.mutex.Unlock()
+		for _, receiver := range n.servers {
+			if receiver != sender && !n.probes[receiver.Host.ID()][content] {
+				return false
+			}
+		}
+		return true
+	}
+	for start := time.Now(); time.Since(start) < 250*time.Millisecond; time.Sleep(10 * time.Millisecond) {
+		if delivered() {
+			return true
+		}
+	}
+	return false
+}
+
+// newTestKey generates a new identity key.
+// The private key and its marshalled bytes are returned.
+func newTestKey(t *testing.T) (crypto.PrivKey, []byte) {
+	privateKey, _, err := crypto.GenerateKeyPair(crypto.Ed25519, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyBytes, err := crypto.MarshalPrivateKey(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return privateKey, keyBytes
+}
+
+// waitFor waits until a condition is met or fails the test after the test timeout.
+func waitFor(t *testing.T, description string, condition func() bool) {
+	deadline := time.Now().Add(testTimeout)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", description)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// receive receives a message or fails the test after the test timeout.
+func receive(t *testing.T, messages <-chan Message) Message {
+	select {
+	case message := <-messages:
+		return message
+	case <-time.After(testTimeout):
+		t.Fatal("timed out waiting for a message")
+		return nil
+	}
+}
+
+// expectNone fails the test if a message is received within a short duration.
+func expectNone(t *testing.T, messages <-chan Message) {
+	select {
+	case message := <-messages:
+		t.Errorf("expected no message, got %s", message)
+	case <-time.After(500 * time.Millisecond):
+	}
+}
+
+// debugMessage creates a serialized envelope of a debug message.
+func debugMessage(from peer.ID, text string) []byte {
+	return []byte(fmt.Sprintf(`{"peerId":"%s","message":{"class":"%s","text":"%s"}}`, from.Pretty(), MessageTypeDebug, text))
+}
+
+// blockAddMessage creates a serialized envelope announcing a block of the test vectors.
+func blockAddMessage(t *testing.T, from peer.ID, vector string) ([]byte, string) {
+	content, err := ioutil.ReadFile("../blockchain/testdata/block_vectors.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	vectors := &struct {
+		TrustedAuthors []string `json:"trustedAuthors"`
+		Vectors        []struct {
+			Name  string          `json:"name"`
+			Block json.RawMessage `json:"block"`
+		} `json:"vectors"`
+	}{}
+	if err := json.Unmarshal(content, vectors); err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range vectors.Vectors {
+		if v.Name == vector {
+			message := fmt.Sprintf(`{"peerId":"%s","message":{"class":"%s","block":%s}}`, from.Pretty(), MessageTypeBlockAdd, v.Block)
+			return []byte(message), vectors.TrustedAuthors[0]
+		}
+	}
+	t.Fatalf("unknown block vector %s", vector)
+	return nil, ""
+}
+
+// testBlock represents a serialized block created in tests.
+type testBlock struct {
+	Height    uint64            `json:"height"`
+	Timestamp int64             `json:"timestamp"`
+	PrevHash  string            `json:"prevHash"`
+	Author    string            `json:"author"`
+	Data      []json.RawMessage `json:"data"`
+	Hash      string            `json:"hash,omitempty"`
+	Sign      string            `json:"sign,omitempty"`
+}
+
+// signedChain creates a chain of empty blocks signed by a blocklord.
+// The private key of the blocklord and the number of blocks have to be given.
+// The decoded blocks are returned.
+func signedChain(t *testing.T, blocklordKey crypto.PrivKey, count int) []*blockchain.Block {
+	author, err := AddressFromPublicKey(blocklordKey.GetPublic())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var blocks []*blockchain.Block
+	prevHash := ""
+	for height := 0; height < count; height++ {
+		block := &testBlock{
+			Height:    uint64(height),
+			Timestamp: int64(height),
+			PrevHash:  prevHash,
+			Author:    string(author),
+			Data:      []json.RawMessage{},
+		}
+		serialized, err := json.Marshal(block)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hashable, err := blockchain.EncodeHashableBlock(serialized)
+		if err != nil {
+			t.Fatal(err)
+		}
+		block.Hash = blockchain.Hash(hashable)
+		sign, err := blocklordKey.Sign([]byte(block.Hash))
+		if err != nil {
+			t.Fatal(err)
+		}
+		block.Sign = base64.StdEncoding.EncodeToString(sign)
+		if serialized, err = json.Marshal(block); err != nil {
+			t.Fatal(err)
+		}
+		decoded, err := blockchain.DecodeBlock(serialized)
+		if err != nil {
+			t.Fatal(err)
+		}
+		blocks = append(blocks, decoded)
+		prevHash = block.Hash
+	}
+	return blocks
+}
+
+// storeBlocks appends blocks to the block store of a server.
+func storeBlocks(t *testing.T, s *Server, blocks []*blockchain.Block) {
+	for _, block := range blocks {
+		if err := s.Blocks.Append(block); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestBroadcast(t *testing.T) {
+	n := newTestNetwork(t)
+	servers := n.startAll(3)
+
+	message := debugMessage(servers[1].Host.ID(), "broadcast")
+	if err := servers[1].PubSub.Publish(message); err != nil {
+		t.Fatal(err)
+	}
+	for _, i := range []int{0, 2} {
+		if received := receive(t, servers[i].PubSub.Messages); string(received) != string(message) {
+			t.Errorf("server %d: expected %s, got %s", i, message, received)
+		}
+	}
+	expectNone(t, servers[1].PubSub.Messages)
+}
+
+func TestBroadcastEncodings(t *testing.T) {
+	n := newTestNetwork(t)
+	plain := n.start()
+	compressed := n.start(WithCompression(true, true))
+	binary := n.start(WithCompression(true, true), WithBinaryEncoding(true, true))
+	n.connectAll()
+
+	for _, sender := range []*Server{plain, compressed, binary} {
+		message := debugMessage(sender.Host.ID(), "encoded broadcast")
+		if err := sender.PubSub.Publish(message); err != nil {
+			t.Fatal(err)
+		}
+		for _, receiver := range n.servers {
+			if receiver == sender {
+				continue
+			}
+			if received := receive(t, receiver.PubSub.Messages); string(received) != string(message) {
+				t.Errorf("expected %s, got %s", message, received)
+			}
+		}
+	}
+}
+
+func TestDirectSend(t *testing.T) {
+	options := map[string][]Option{
+		"plain":      nil,
+		"compressed": {WithCompression(true, false)},
+		"binary":     {WithCompression(true, false), WithBinaryEncoding(true, false)},
+	}
+	for name, option := range options {
+		t.Run(name, func(t *testing.T) {
+			n := newTestNetwork(t)
+			servers := n.startAll(2, option...)
+
+			message := debugMessage(servers[0].Host.ID(), "direct")
+			if err := servers[0].Stream.Send(servers[1].Host.ID(), message); err != nil {
+				t.Fatal(err)
+			}
+			if received := receive(t, servers[1].Stream.Messages); string(received) != string(message) {
+				t.Errorf("expected %s, got %s", message, received)
+			}
+			expectNone(t, servers[1].PubSub.Messages)
+		})
+	}
+}
+
+func TestMessageTypeFilter(t *testing.T) {
+	n := newTestNetwork(t)
+	servers := n.startAll(2)
+	servers[1].MessageTypes.Subscribe(MessageTypeBlockAdd)
+
+	if err := servers[0].Stream.Send(servers[1].Host.ID(), debugMessage(servers[0].Host.ID(), "filtered")); err != nil {
+		t.Fatal(err)
+	}
+	expectNone(t, servers[1].Stream.Messages)
+
+	// unsubscribing the last type does not deliver all types again
+	servers[1].MessageTypes.Unsubscribe(MessageTypeBlockAdd)
+	if servers[1].MessageTypes.Accepts(MessageTypeDebug) || servers[1].MessageTypes.Accepts(MessageTypeBlockAdd) {
+		t.Error("expected the filter to stay enabled")
+	}
+	servers[1].MessageTypes.DeliverAll()
+	message := debugMessage(servers[0].Host.ID(), "unfiltered")
+	if err := servers[0].Stream.Send(servers[1].Host.ID(), message); err != nil {
+		t.Fatal(err)
+	}
+	if received := receive(t, servers[1].Stream.Messages); string(received) != string(message) {
+		t.Errorf("expected %s, got %s", message, received)
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	n := newTestNetwork(t)
+	servers := n.startAll(3)
+
+	n.stop(servers[2])
+	waitFor(t, "disconnect", func() bool {
+		return servers[0].Host.Network().Connectedness(servers[2].Host.ID()) != network.Connected
+	})
+	if err := servers[0].Stream.Send(servers[2].Host.ID(), debugMessage(servers[0].Host.ID(), "gone")); err == nil {
+		t.Error("expected sending to a stopped server to fail")
+	}
+
+	message := debugMessage(servers[0].Host.ID(), "still running")
+	if err := servers[0].PubSub.Publish(message); err != nil {
+		t.Fatal(err)
+	}
+	if received := receive(t, servers[1].PubSub.Messages); string(received) != string(message) {
+		t.Errorf("expected %s, got %s", message, received)
+	}
+}
+
+func TestInvalidConfiguration(t *testing.T) {
+	tests := map[string]Option{
+		"malformed static relay":        WithStaticRelays([]string{"/not/a/multiaddr"}),
+		"malformed trusted peer":        WithTrustedBlocklords([]string{"not a peer ID"}, nil),
+		"unknown rate limited protocol": WithRateLimit("unknown", 1, 1),
+		"negative rate limit":           WithRateLimit(RateLimitPubSub, -1, 1),
+		"negative ban duration":         WithAutoBan(1, -time.Second),
+		"zero peer lookup timeout":      WithPeerLookupTimeout(0),
+		"negative trace buffer size":    WithTraceBuffer(-1),
+	}
+	for name, option := range tests {
+		n := newTestNetwork(t)
+		config := NewConfig(testTopic, testProtocol, 0, nil, nil, option)
+		if s, err := NewServer(config, n.net.NewHost); err == nil {
+			_ = s.Stop()
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestPublishPeerRecord(t *testing.T) {
+	n := newTestNetwork(t)
+	addressKey, _ := newTestKey(t)
+	address, err := AddressFromPublicKey(addressKey.GetPublic())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// without DHT peers the record is still published on pubsub
+	publisher := n.start()
+	if err := publisher.PublishPeerRecord(addressKey); err != nil {
+		t.Fatal(err)
+	}
+
+	receiver := n.start()
+	n.awaitPubSub()
+	waitFor(t, "peer record", func() bool {
+		if err := publisher.PublishPeerRecord(addressKey); err != nil {
+			t.Fatal(err)
+		}
+		peerID, ok := receiver.PeerRecords.Lookup(address)
+		return ok && peerID == publisher.Host.ID()
+	})
+}
+
+func TestSendToUnreachableAddress(t *testing.T) {
+	n := newTestNetwork(t)
+	servers := n.startAll(2)
+	publisher, sender := servers[0], servers[1]
+	addressKey, _ := newTestKey(t)
+	address, err := AddressFromPublicKey(addressKey.GetPublic())
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "peer record", func() bool {
+		if err := publisher.PublishPeerRecord(addressKey); err != nil {
+			t.Fatal(err)
+		}
+		_, ok := sender.PeerRecords.Lookup(address)
+		return ok
+	})
+
+	n.stop(publisher)
+	err = sender.SendToAddress(address, debugMessage(sender.Host.ID(), "unreachable"))
+	var unreachable *AddressUnreachableError
+	if !errors.As(err, &unreachable) {
+		t.Fatalf("expected an AddressUnreachableError, got %v", err)
+	}
+	// a single failed send does not drop the record
+	if peerID, ok := sender.PeerRecords.Lookup(address); !ok || peerID != publisher.Host.ID() {
+		t.Error("expected the peer record to be kept")
+	}
+}
+
+func TestReconnection(t *testing.T) {
+	n := newTestNetwork(t)
+	servers := n.startAll(2)
+	target := servers[1].Host.ID()
+
+	// the peers may reconnect right away, hence the disconnect is awaited as event rather than as state
+	disconnected := make(chan struct{}, 1)
+	servers[0].Host.Network().Notify(&network.NotifyBundle{
+		DisconnectedF: func(_ network.Network, conn network.Conn) {
+			if conn.RemotePeer() == target {
+				select {
+				case disconnected <- struct{}{}:
+				default:
+				}
+			}
+		},
+	})
+	if err := servers[0].Disconnect(target); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-disconnected:
+	case <-time.After(testTimeout):
+		t.Fatal("timed out waiting for disconnect")
+	}
+
+	message := debugMessage(servers[0].Host.ID(), "reconnected")
+	if err := servers[0].Stream.Send(target, message); err != nil {
+		t.Fatal(err)
+	}
+	if received := receive(t, servers[1].Stream.Messages); string(received) != string(message) {
+		t.Errorf("expected %s, got %s", message, received)
+	}
+	if servers[0].Host.Network().Connectedness(target) != network.Connected {
+		t.Error("expected the peer to be connected again")
+	}
+
+	// pubsub recovers as well
+	n.awaitPubSub()
+	broadcast := debugMessage(servers[1].Host.ID(), "mesh restored")
+	if err := servers[1].PubSub.Publish(broadcast); err != nil {
+		t.Fatal(err)
+	}
+	if received := receive(t, servers[0].PubSub.Messages); string(received) != string(broadcast) {
+		t.Errorf("expected %s, got %s", broadcast, received)
+	}
+}
+
+func TestBlockValidation(t *testing.T) {
+	n := newTestNetwork(t)
+	blocklordKey, blocklordKeyBytes := newTestKey(t)
+	blocklordID, err := peer.IDFromPrivateKey(blocklordKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, author := blockAddMessage(t, blocklordID, "valid block")
+	trust := WithTrustedBlocklords([]string{blocklordID.Pretty()}, []string{author})
+
+	blocklord := n.start(trust, func(c *config) {
+		c.PKBytes = blocklordKeyBytes
+	})
+	client := n.start(trust)
+	other := n.start(trust)
+	n.connectAll()
+
+	valid, _ := blockAddMessage(t, blocklord.Host.ID(), "valid block")
+	if err := blocklord.PubSub.Publish(valid); err != nil {
+		t.Fatal(err)
+	}
+	for _, receiver := range []*Server{client, other} {
+		if received := receive(t, receiver.PubSub.Messages); string(received) != string(valid) {
+			t.Errorf("expected %s, got %s", valid, received)
+		}
+	}
+
+	tampered, _ := blockAddMessage(t, blocklord.Host.ID(), "tampered block content")
+	if err := blocklord.PubSub.Publish(tampered); err == nil {
+		t.Error("expected a tampered block to be rejected")
+	}
+	unknown, _ := blockAddMessage(t, blocklord.Host.ID(), "unknown record class")
+	if err := blocklord.PubSub.Publish(unknown); err == nil {
+		t.Error("expected a block of an unknown class to be ignored")
+	}
+	untrusted, _ := blockAddMessage(t, client.Host.ID(), "valid block")
+	if err := client.PubSub.Publish(untrusted); err == nil {
+		t.Error("expected a block announced by an untrusted peer to be rejected")
+	}
+	if err := client.PubSub.Publish([]byte(`{"peerId":"x","message":{}}`)); err == nil {
+		t.Error("expected a malformed envelope to be rejected")
+	}
+	expectNone(t, other.PubSub.Messages)
+}
+
+func TestChainRequest(t *testing.T) {
+	n := newTestNetwork(t)
+	store := n.start(WithBlockStore(t.TempDir() + "/blocks"))
+	requester := n.start()
+	spoofed := n.start()
+	for height := 0; height < 3; height++ {
+		serialized := fmt.Sprintf(`{"height":%d,"timestamp":%d,"prevHash":"h%d","author":"a","data":[],"hash":"h%d","sign":"s"}`, height, height, height-1, height)
+		if height == 0 {
+			serialized = `{"height":0,"timestamp":0,"prevHash":"","author":"a","data":[],"hash":"h0","sign":"s"}`
+		}
+		block, err := blockchain.DecodeBlock([]byte(serialized))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := store.Blocks.Append(block); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the envelope names another peer, the blocks are sent to the requesting peer anyway
+	request := fmt.Sprintf(`{"peerId":"%s","message":{"class":"%s","height":0}}`, spoofed.Host.ID().Pretty(), MessageTypeChainReq)
+	if err := requester.Stream.Send(store.Host.ID(), []byte(request)); err != nil {
+		t.Fatal(err)
+	}
+	envelope, err := ParseEnvelope(receive(t, requester.Stream.Messages))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if envelope.Type != MessageTypeChainFwd {
+		t.Errorf("expected %s, got %s", MessageTypeChainFwd, envelope.Type)
+	}
+	expectNone(t, spoofed.Stream.Messages)
+}
+
+func TestHeightGapSync(t *testing.T) {
+	n := newTestNetwork(t)
+	blocklordKey, blocklordKeyBytes := newTestKey(t)
+	blocklordID, err := peer.IDFromPrivateKey(blocklordKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	trust := WithTrustedBlocklords([]string{blocklordID.Pretty()}, nil)
+	blocklord := n.start(trust, WithBlockStore(t.TempDir()+"/blocks"), func(c *config) {
+		c.PKBytes = blocklordKeyBytes
+	})
+	client := n.start(trust, WithBlockStore(t.TempDir()+"/blocks"))
+	n.connectAll()
+	blocks := signedChain(t, blocklordKey, 6)
+	storeBlocks(t, blocklord, blocks[:5])
+
+	// the client misses all blocks before the announced one and syncs them from the blocklord
+	announced, err := json.Marshal(&Envelope{
+		PeerID:  blocklordID.Pretty(),
+		Message: json.RawMessage(fmt.Sprintf(`{"class":"%s","block":%s}`, MessageTypeBlockAdd, blocks[5].Raw())),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := blocklord.PubSub.Publish(announced); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "gap sync", func() bool {
+		return client.Blocks.Height() == uint64(len(blocks))
+	})
+}
+
+func TestAreaTopics(t *testing.T) {
+	n := newTestNetwork(t)
+	servers := n.startAll(2)
+	subscriber, publisher := servers[0], servers[1]
+	realm := RealmIndex{X: 3, Y: 4}
+	if err := subscriber.Areas.SetInterest([]RealmIndex{realm}); err != nil {
+		t.Fatal(err)
+	}
+
+	// messages are published until the subscription is known, each attempt differs to not be dropped as duplicate
+	attempt := 0
+	waitFor(t, "area message", func() bool {
+		attempt++
+		if err := publisher.Areas.Publish(realm, debugMessage(publisher.Host.ID(), fmt.Sprint(attempt))); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case <-subscriber.Areas.Messages:
+			return true
+		case <-time.After(100 * time.Millisecond):
+			return false
+		}
+	})
+
+	// topics only published to are left once too many are joined
+	for x := uint32(0); x < maxIdleAreas+4; x++ {
+		if err := publisher.Areas.Publish(RealmIndex{X: x, Y: 100}, debugMessage(publisher.Host.ID(), fmt.Sprint("idle ", x))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if joined := len(publisher.Areas.topics); joined != maxIdleAreas {
+		t.Errorf("expected %d joined area topics, got %d", maxIdleAreas, joined)
+	}
+
+	if err := subscriber.Areas.SetInterest(RealmsAround(realm, 5)); err != ErrTooManyAreas {
+		t.Errorf("expected %v, got %v", ErrTooManyAreas, err)
+	}
+}
+
+func TestAreaJoinFailure(t *testing.T) {
+	n := newTestNetwork(t)
+	s := n.start()
+	realm := RealmIndex{X: 9, Y: 9}
+	name := s.Areas.TopicName(realm)
+	accept := func(context.Context, peer.ID, *pubsub.Message) bool { return true }
+	if err := s.Areas.ps.RegisterTopicValidator(compressedVariant(name), accept); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Areas.Publish(realm, debugMessage(s.Host.ID(), "area")); err == nil {
+		t.Fatal("expected joining the area topic to fail")
+	}
+	// the validator registered before the failure is unregistered again
+	if err := s.Areas.ps.RegisterTopicValidator(name, accept); err != nil {
+		t.Errorf("expected the validator of %s to be unregistered, got %v", name, err)
+	}
+}
+
+func TestCompatibleVersionTopics(t *testing.T) {
+	n := newTestNetwork(t)
+	compatible := WithCompatibleVersions([]string{"0.2.0"})
+	publisher := n.start(compatible)
+	newer := n.start(func(c *config) {
+		c.Topic = "/biotopium/0.2.0/test"
+	})
+	both := n.start(compatible)
+	n.connectAll()
+
+	// peers of the other version receive the message, peers of both versions receive it once
+	message := debugMessage(publisher.Host.ID(), "all versions")
+	if err := publisher.PubSub.Publish(message); err != nil {
+		t.Fatal(err)
+	}
+	for _, receiver := range []*Server{newer, both} {
+		if received := receive(t, receiver.PubSub.Messages); string(received) != string(message) {
+			t.Errorf("expected %s, got %s", message, received)
+		}
+	}
+	expectNone(t, both.PubSub.Messages)
+}
@@ -0,0 +1,288 @@
+/*
+ * Copyright (c) 2021 The biotopium Authors.
+ * This file is part of biotopium.
+ *
+ * biotopium is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * biotopium is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with biotopium.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package p2p
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/peer"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	"sync"
+	"time"
+)
+
+// PeerRecordTopic is the pubsub topic signed peer records are published on.
+const PeerRecordTopic = "/biotopium/0.1.0/peer-records"
+
+// peerRecordInterval is the interval in which the local peer record is republished.
+const peerRecordInterval = 2 * time.Minute
+
+// peerRecordSignaturePrefix is prepended to the signed payload of a peer record.
+const peerRecordSignaturePrefix = "biotopium-peer-record:"
+
+// ErrNoAddressKey is returned if a peer record is published before an address key was set.
+var ErrNoAddressKey = errors.New("no address key set")
+
+// PeerRecord binds a peer ID to a biotopium address.
+// The record is signed by both, the identity key of the peer and the key of the address.
+type PeerRecord struct {
+	PeerID           peer.ID `json:"peerId"`           // peer ID of the node
+	Address          Address `json:"address"`          // address of the player
+	Seq              uint64  `json:"seq"`              // sequence number, newer records have higher numbers
+	PeerSignature    []byte  `json:"peerSignature"`    // signature by the identity key
+	AddressSignature []byte  `json:"addressSignature"` // signature by the address key
+}
+
+// payload returns the bytes which are signed by both keys.
+func (r *PeerRecord) payload() []byte {
+	var buf bytes.Buffer
+	buf.WriteString(peerRecordSignaturePrefix)
+	buf.WriteString(r.PeerID.Pretty())
+	buf.WriteString(string(r.Address))
+	_ = binary.Write(&buf, binary.BigEndian, r.Seq)
+	return buf.Bytes()
+}
+
+// NewPeerRecord creates a new signed peer record.
+// The identity key, the address key and a sequence number have to be given.
+// The signed peer record is returned.
+func NewPeerRecord(identityKey crypto.PrivKey, addressKey crypto.PrivKey, seq uint64) (*PeerRecord, error) {
+	peerID, err := peer.IDFromPrivateKey(identityKey)
+	if err != nil {
+		return nil, err
+	}
+	address, err := AddressFromPublicKey(addressKey.GetPublic())
+	if err != nil {
+		return nil, err
+	}
+	rec := &PeerRecord{
+		PeerID:  peerID,
+		Address: address,
+		Seq:     seq,
+	}
+	payload := rec.payload()
+	rec.PeerSignature, err = identityKey.Sign(payload)
+	if err != nil {
+		return nil, err
+	}
+	rec.AddressSignature, err = addressKey.Sign(payload)
+	if err != nil {
+		return nil, err
+	}
+	return rec, nil
+}
+
+// Verify verifies both signatures of a peer record.
+// The identity public key of the peer has to be given.
+func (r *PeerRecord) Verify(identityKey crypto.PubKey) error {
+	if !r.PeerID.MatchesPublicKey(identityKey) {
+		return fmt.Errorf("identity key does not match peer %s", r.PeerID.Pretty())
+	}
+	addressKey, err := DecodeAddress(r.Address)
+	if err != nil {
+		return err
+	}
+	payload := r.payload()
+	if ok, err := identityKey.Verify(payload, r.PeerSignature); err != nil || !ok {
+		return errors.New("invalid peer signature")
+	}
+	if ok, err := addressKey.Verify(payload, r.AddressSignature); err != nil || !ok {
+		return errors.New("invalid address signature")
+	}
+	return nil
+}
+
+// PeerRecordBook keeps track of verified peer records, indexed by address.
+type PeerRecordBook struct {
+	mutex      sync.RWMutex
+	records    map[Address]*PeerRecord // newest record per address
+	addressKey crypto.PrivKey          // address key of the local player
+
+	ctx   context.Context      // Context
+	host  host.Host            // P2P host
+	topic *pubsub.Topic        // peer record topic
+	sub   *pubsub.Subscription // peer record subscription
+}
+
+// listenPeerRecords starts to listen for peer records.
+// A context, a pubsub and the host have to be given.
+// A peer record book is returned.
+func listenPeerRecords(ctx context.Context, ps *pubsub.PubSub, h host.Host) (*PeerRecordBook, error) {
+	book := &PeerRecordBook{
+		records: make(map[Address]*PeerRecord),
+		ctx:     ctx,
+		host:    h,
+	}
+
+	err := ps.RegisterTopicValidator(PeerRecordTopic, book.validate)
+	if err != nil {
+		return nil, err
+	}
+
+	book.topic, err = ps.Join(PeerRecordTopic)
+	if err != nil {
+		return nil, err
+	}
+
+	book.sub, err = book.topic.Subscribe()
+	if err != nil {
+		return nil, err
+	}
+
+	go book.listen()
+	go book.republish()
+	return book, nil
+}
+
+// decodePeerRecord decodes a peer record of a pubsub message and verifies it.
+// The message has to be given.
+// The verified peer record is returned.
+func decodePeerRecord(msg *pubsub.Message) (*PeerRecord, error) {
+	rec := &PeerRecord{}
+	if err := json.Unmarshal(msg.Data, rec); err != nil {
+		return nil, err
+	}
+	author := msg.GetFrom()
+	if rec.PeerID != author {
+		return nil, fmt.Errorf("peer record of %s published by %s", rec.PeerID.Pretty(), author.Pretty())
+	}
+	identityKey, err := author.ExtractPublicKey()
+	if err != nil {
+		return nil, err
+	}
+	return rec, rec.Verify(identityKey)
+}
+
+// validate is the pubsub validator of the peer record topic.
+// Invalid records are rejected, records not newer than the known record of the address are ignored,
+// regardless of the peer they bind the address to.
+func (b *PeerRecordBook) validate(_ context.Context, _ peer.ID, msg *pubsub.Message) pubsub.ValidationResult {
+	rec, err := decodePeerRecord(msg)
+	if err != nil {
+		logger.Warnw("Rejected peer record", "error", err)
+		return pubsub.ValidationReject
+	}
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	if known, ok := b.records[rec.Address]; ok && known.Seq >= rec.Seq {
+		return pubsub.ValidationIgnore
+	}
+	return pubsub.ValidationAccept
+}
+
+// listen listens to incoming peer records and stores them.
+func (b *PeerRecordBook) listen() {
+	for {
+		msg, err := b.sub.Next(b.ctx)
+		if err != nil {
+			return
+		}
+		rec, err := decodePeerRecord(msg)
+		if err != nil {
+			continue
+		}
+		b.add(rec)
+	}
+}
+
+// add stores a verified peer record unless a newer record of the address is known.
+// The verified peer record has to be given.
+func (b *PeerRecordBook) add(rec *PeerRecord) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if known, ok := b.records[rec.Address]; !ok || known.Seq < rec.Seq {
+		b.records[rec.Address] = rec
+	}
+}
+
+// record returns the known peer record of an address.
+// The address has to be given.
+// The peer record and whether a record is known are returned.
+func (b *PeerRecordBook) record(address Address) (*PeerRecord, bool) {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	rec, ok := b.records[address]
+	return rec, ok
+}
+
+// republish periodically republishes the local peer record, so new peers learn about it.
+func (b *PeerRecordBook) republish() {
+	ticker := time.NewTicker(peerRecordInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if _, err := b.publish(); err != nil && err != ErrNoAddressKey {
+				logger.Warnw("Failed to republish peer record", "error", err)
+			}
+		case <-b.ctx.Done():
+			return
+		}
+	}
+}
+
+// Publish sets the address key of the local player and publishes the local peer record.
+// The address key has to be given.
+// The serialized published record is returned.
+func (b *PeerRecordBook) Publish(addressKey crypto.PrivKey) ([]byte, error) {
+	b.mutex.Lock()
+	b.addressKey = addressKey
+	b.mutex.Unlock()
+	return b.publish()
+}
+
+// publish publishes the local peer record.
+// The serialized published record is returned.
+func (b *PeerRecordBook) publish() ([]byte, error) {
+	b.mutex.RLock()
+	addressKey := b.addressKey
+	b.mutex.RUnlock()
+	if addressKey == nil {
+		return nil, ErrNoAddressKey
+	}
+	identityKey := b.host.Peerstore().PrivKey(b.host.ID())
+	rec, err := NewPeerRecord(identityKey, addressKey, nextRecordSeq())
+	if err != nil {
+		return nil, err
+	}
+	serialized, err := json.Marshal(rec)
+	if err != nil {
+		return nil, err
+	}
+	return serialized, b.topic.Publish(b.ctx, serialized)
+}
+
+// Lookup looks up the peer ID bound to an address.
+// The address has to be given.
+// The peer ID and whether a record was found is returned.
+func (b *PeerRecordBook) Lookup(address Address) (peer.ID, bool) {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	rec, ok := b.records[address]
+	if !ok {
+		return "", false
+	}
+	return rec.PeerID, true
+}
@@ -0,0 +1,85 @@
+/*
+ * Copyright (c) 2021 The biotopium Authors.
+ * This file is part of biotopium.
+ *
+ * biotopium is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * biotopium is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with biotopium.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package p2p
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/peer"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	pb "github.com/libp2p/go-libp2p-pubsub/pb"
+	"testing"
+)
+
+// peerRecordMessage creates a pubsub message carrying a new peer record.
+// The identity key, the address key and the sequence number of the record have to be given.
+func peerRecordMessage(t *testing.T, identityKey crypto.PrivKey, addressKey crypto.PrivKey, seq uint64) (*pubsub.Message, *PeerRecord) {
+	rec, err := NewPeerRecord(identityKey, addressKey, seq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &pubsub.Message{Message: &pb.Message{From: []byte(rec.PeerID), Data: data}}, rec
+}
+
+func TestPeerRecordValidation(t *testing.T) {
+	book := &PeerRecordBook{records: make(map[Address]*PeerRecord)}
+	addressKey, _ := newTestKey(t)
+	identityKey, _ := newTestKey(t)
+	otherIdentityKey, _ := newTestKey(t)
+
+	msg, rec := peerRecordMessage(t, identityKey, addressKey, 2)
+	if result := book.validate(context.Background(), "", msg); result != pubsub.ValidationAccept {
+		t.Fatalf("expected a new record to be accepted, got %v", result)
+	}
+	book.add(rec)
+
+	tests := map[string]struct {
+		identityKey crypto.PrivKey
+		seq         uint64
+		expected    pubsub.ValidationResult
+	}{
+		"replayed record":               {identityKey, 2, pubsub.ValidationIgnore},
+		"older record of the same peer": {identityKey, 1, pubsub.ValidationIgnore},
+		"older record of another peer":  {otherIdentityKey, 1, pubsub.ValidationIgnore},
+		"same seq of another peer":      {otherIdentityKey, 2, pubsub.ValidationIgnore},
+		"newer record of another peer":  {otherIdentityKey, 3, pubsub.ValidationAccept},
+	}
+	for name, test := range tests {
+		msg, _ := peerRecordMessage(t, test.identityKey, addressKey, test.seq)
+		if result := book.validate(context.Background(), "", msg); result != test.expected {
+			t.Errorf("%s: expected %v, got %v", name, test.expected, result)
+		}
+	}
+
+	// a record published by another peer than the one it binds is rejected
+	msg, _ = peerRecordMessage(t, otherIdentityKey, addressKey, 3)
+	forger, err := peer.IDFromPrivateKey(identityKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg.From = []byte(forger)
+	if result := book.validate(context.Background(), "", msg); result != pubsub.ValidationReject {
+		t.Errorf("expected a forwarded record of another peer to be rejected, got %v", result)
+	}
+}
@@ -0,0 +1,148 @@
+/*
+ * Copyright (c) 2021 The biotopium Authors.
+ * This file is part of biotopium.
+ *
+ * biotopium is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * biotopium is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with biotopium.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package p2p
+
+import (
+	"context"
+	"errors"
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p/p2p/protocol/ping"
+	"sort"
+	"time"
+)
+
+// DefaultPingInterval is the default interval of measuring the latency to connected peers.
+const DefaultPingInterval = 30 * time.Second
+
+// pingTimeout is the maximum duration of a single ping.
+const pingTimeout = 10 * time.Second
+
+// PingResult represents the round-trip times of pings sent to a peer.
+type PingResult struct {
+	PeerID string    `json:"peerId"`     // peer ID
+	RTTs   []float64 `json:"rttsMillis"` // round-trip times of the answered pings in milliseconds
+	Lost   int       `json:"lost"`       // number of unanswered pings
+	Min    float64   `json:"minMillis"`  // minimum round-trip time in milliseconds
+	Avg    float64   `json:"avgMillis"`  // average round-trip time in milliseconds
+	Max    float64   `json:"maxMillis"`  // maximum round-trip time in milliseconds
+}
+
+// PeerLatency represents the latency to a connected peer.
+type PeerLatency struct {
+	PeerID  string  `json:"peerId"`        // peer ID
+	Latency float64 `json:"latencyMillis"` // exponentially weighted moving average of the round-trip times in milliseconds
+}
+
+// millis converts a duration to milliseconds.
+func millis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// pingOnce sends a single ping to a peer.
+// The round-trip time is recorded in the peerstore.
+// The context, the host and the peer ID have to be given.
+// The round-trip time is returned.
+func pingOnce(ctx context.Context, h host.Host, peerID peer.ID) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, pingTimeout)
+	defer cancel()
+	res, ok := <-ping.Ping(ctx, h, peerID)
+	if !ok {
+		return 0, ctx.Err()
+	}
+	return res.RTT, res.Error
+}
+
+// Ping sends pings to a peer and measures the round-trip times.
+// The peer is dialed if necessary.
+// The peer ID and the number of pings have to be given.
+// A pointer to the result is returned, the error is only set if no ping could be sent.
+func (s *Server) Ping(peerID peer.ID, count int) (*PingResult, error) {
+	if count < 1 {
+		return nil, errors.New("at least one ping has to be sent")
+	}
+	if err := s.ensureConnected(peerID); err != nil {
+		return nil, err
+	}
+	result := &PingResult{
+		PeerID: peerID.Pretty(),
+		RTTs:   []float64{},
+	}
+	var total float64
+	for i := 0; i < count; i++ {
+		rtt, err := pingOnce(context.Background(), s.Host, peerID)
+		if err != nil {
+			result.Lost++
+			continue
+		}
+		rttMillis := millis(rtt)
+		if len(result.RTTs) == 0 || rttMillis < result.Min {
+			result.Min = rttMillis
+		}
+		if rttMillis > result.Max {
+			result.Max = rttMillis
+		}
+		total += rttMillis
+		result.RTTs = append(result.RTTs, rttMillis)
+	}
+	if len(result.RTTs) > 0 {
+		result.Avg = total / float64(len(result.RTTs))
+	}
+	return result, nil
+}
+
+// Latencies reports the latency to all connected peers with a measured round-trip time.
+func (s *Server) Latencies() []*PeerLatency {
+	latencies := []*PeerLatency{}
+	for _, peerID := range s.Host.Network().Peers() {
+		latency := s.Host.Peerstore().LatencyEWMA(peerID)
+		if latency == 0 {
+			continue
+		}
+		latencies = append(latencies, &PeerLatency{
+			PeerID:  peerID.Pretty(),
+			Latency: millis(latency),
+		})
+	}
+	sort.Slice(latencies, func(i, j int) bool {
+		return latencies[i].PeerID < latencies[j].PeerID
+	})
+	return latencies
+}
+
+// measureLatencies periodically pings all connected peers to keep the latencies in the peerstore up to date.
+// The context, the host and the interval have to be given.
+func measureLatencies(ctx context.Context, h host.Host, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				for _, peerID := range h.Network().Peers() {
+					go func(peerID peer.ID) {
+						_, _ = pingOnce(ctx, h, peerID)
+					}(peerID)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
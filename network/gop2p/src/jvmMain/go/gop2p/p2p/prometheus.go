@@ -0,0 +1,123 @@
+/*
+ * Copyright (c) 2021 The biotopium Authors.
+ * This file is part of biotopium.
+ *
+ * biotopium is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * biotopium is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with biotopium.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package p2p
+
+import (
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net"
+	"net/http"
+)
+
+// metricsNamespace is the namespace of the exported Prometheus metrics.
+const metricsNamespace = "biotopium"
+
+// Descriptions of the exported Prometheus metrics.
+var (
+	bandwidthDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "", "bandwidth_bytes_total"),
+		"Transferred bytes.", []string{"direction"}, nil)
+	bandwidthRateDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "", "bandwidth_rate_bytes"),
+		"Current transfer rate in bytes per second.", []string{"direction"}, nil)
+	protocolBandwidthDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "", "protocol_bytes_total"),
+		"Transferred bytes per protocol.", []string{"protocol", "direction"}, nil)
+	messagesDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "", "messages_total"),
+		"Messages per protocol or topic.", []string{"name", "kind"}, nil)
+	rejectsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "", "validation_rejects_total"),
+		"Pubsub messages rejected during validation.", []string{"reason"}, nil)
+	queueDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "", "queue_depth"),
+		"Messages waiting for the host.", []string{"queue"}, nil)
+	peersDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "", "peers"),
+		"Connected peers.", nil, nil)
+	connectionsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "", "connections"),
+		"Open connections.", []string{"direction"}, nil)
+)
+
+// metricsCollector exports snapshots of the metrics to Prometheus.
+type metricsCollector struct {
+	snapshot func() *MetricsSnapshot // creates a snapshot of the metrics
+}
+
+// Describe sends the descriptions of the exported metrics.
+func (c *metricsCollector) Describe(descs chan<- *prometheus.Desc) {
+	for _, desc := range []*prometheus.Desc{bandwidthDesc, bandwidthRateDesc, protocolBandwidthDesc, messagesDesc, rejectsDesc, queueDesc, peersDesc, connectionsDesc} {
+		descs <- desc
+	}
+}
+
+// Collect sends the exported metrics of a new snapshot.
+func (c *metricsCollector) Collect(metrics chan<- prometheus.Metric) {
+	snapshot := c.snapshot()
+	metrics <- prometheus.MustNewConstMetric(bandwidthDesc, prometheus.CounterValue, float64(snapshot.Bandwidth.TotalIn), "in")
+	metrics <- prometheus.MustNewConstMetric(bandwidthDesc, prometheus.CounterValue, float64(snapshot.Bandwidth.TotalOut), "out")
+	metrics <- prometheus.MustNewConstMetric(bandwidthRateDesc, prometheus.GaugeValue, snapshot.Bandwidth.RateIn, "in")
+	metrics <- prometheus.MustNewConstMetric(bandwidthRateDesc, prometheus.GaugeValue, snapshot.Bandwidth.RateOut, "out")
+	for id, stats := range snapshot.Protocols {
+		metrics <- prometheus.MustNewConstMetric(protocolBandwidthDesc, prometheus.CounterValue, float64(stats.TotalIn), id, "in")
+		metrics <- prometheus.MustNewConstMetric(protocolBandwidthDesc, prometheus.CounterValue, float64(stats.TotalOut), id, "out")
+	}
+	for name, counts := range snapshot.Messages {
+		metrics <- prometheus.MustNewConstMetric(messagesDesc, prometheus.CounterValue, float64(counts.Sent), name, "sent")
+		metrics <- prometheus.MustNewConstMetric(messagesDesc, prometheus.CounterValue, float64(counts.Received), name, "received")
+		metrics <- prometheus.MustNewConstMetric(messagesDesc, prometheus.CounterValue, float64(counts.Rejected), name, "rejected")
+		metrics <- prometheus.MustNewConstMetric(messagesDesc, prometheus.CounterValue, float64(counts.Duplicates), name, "duplicate")
+	}
+	for reason, count := range snapshot.Rejects {
+		metrics <- prometheus.MustNewConstMetric(rejectsDesc, prometheus.CounterValue, float64(count), reason)
+	}
+	for queue, depth := range snapshot.Queues {
+		metrics <- prometheus.MustNewConstMetric(queueDesc, prometheus.GaugeValue, float64(depth), queue)
+	}
+	metrics <- prometheus.MustNewConstMetric(peersDesc, prometheus.GaugeValue, float64(snapshot.Connections.Peers))
+	metrics <- prometheus.MustNewConstMetric(connectionsDesc, prometheus.GaugeValue, float64(snapshot.Connections.Inbound), "inbound")
+	metrics <- prometheus.MustNewConstMetric(connectionsDesc, prometheus.GaugeValue, float64(snapshot.Connections.Outbound), "outbound")
+}
+
+// serveMetrics starts an HTTP listener exporting the metrics on /metrics in the Prometheus format.
+// The listen address and a function creating a snapshot of the metrics have to be given.
+// A pointer to the started HTTP server is returned.
+func serveMetrics(address string, snapshot func() *MetricsSnapshot) (*http.Server, error) {
+	registry := prometheus.NewRegistry()
+	if err := registry.Register(&metricsCollector{snapshot: snapshot}); err != nil {
+		return nil, err
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	server := &http.Server{Handler: mux}
+	go func() {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			logger.Errorw("Metrics listener stopped", "error", err)
+		}
+	}()
+	logger.Infow("Serving metrics", "url", fmt.Sprintf("http://%s/metrics", listener.Addr()))
+	return server, nil
+}
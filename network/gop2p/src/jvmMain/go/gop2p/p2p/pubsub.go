@@ -19,69 +19,283 @@
 package p2p
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/base64"
 	"github.com/libp2p/go-libp2p-core/peer"
 	pubsub "github.com/libp2p/go-libp2p-pubsub"
-	"riesenacht.ch/biotopium/network/gop2p/check"
 )
 
 // PubSubBufSize is the buffer size for pubsub
 const PubSubBufSize = 128
 
 // PubSubTopic represents a pubsub topic.
+// Besides the topic itself, its compressed and its binary encoded variants are joined,
+// which are only joined by peers supporting compression or the binary encoding respectively.
 type PubSubTopic struct {
 	Messages chan Message // Message input channel
 
-	ctx    context.Context      // Context
-	ps     *pubsub.PubSub       // PubSub instance
-	topic  *pubsub.Topic        // Topic
-	sub    *pubsub.Subscription // Subscription
-	peerID peer.ID              // Peer ID
+	ctx          context.Context        // Context
+	ps           *pubsub.PubSub         // PubSub instance
+	name         string                 // topic name
+	topic        *pubsub.Topic          // Topic
+	compressed   *pubsub.Topic          // compressed variant of the topic
+	binary       *pubsub.Topic          // binary encoded variant of the topic
+	subs         []*pubsub.Subscription // subscriptions of all variants, nil if not subscribed
+	compress     bool                   // whether to publish compressed messages
+	encodeBinary bool                   // whether to publish to the binary encoded variant
+	stats        *CompressionStats      // compression statistics
+	metrics      *Metrics               // traffic metrics
+	peerID       peer.ID                // Peer ID
+	filter       *MessageTypeFilter     // message type filter
+	compatible   []*PubSubTopic         // topics of other supported versions
+	seen         *SeenCache             // payloads received on any version of the topic, nil if not deduplicated
 }
 
-// listenTopic starts to listen to a topic.
-// A context, a pubsub, and a peer ID have to be given.
-// A ps topic is returned.
-func listenTopic(ctx context.Context, ps *pubsub.PubSub, peerID peer.ID) *PubSubTopic {
+// joinTopic joins a topic and its compressed and binary encoded variants without subscribing to them.
+// A context, a pubsub, the topic name, a peer ID, a message type filter, whether to publish compressed messages,
+// whether to publish binary encoded messages, the compression statistics and the traffic metrics have to be given.
+// A pointer to the joined topic is returned.
+func joinTopic(ctx context.Context, ps *pubsub.PubSub, name string, peerID peer.ID, filter *MessageTypeFilter, compress bool, encodeBinary bool, stats *CompressionStats, metrics *Metrics) (*PubSubTopic, error) {
+	topic, err := ps.Join(name)
+	if err != nil {
+		return nil, err
+	}
+	compressed, err := ps.Join(compressedVariant(name))
+	if err != nil {
+		_ = topic.Close()
+		return nil, err
+	}
+	binary, err := ps.Join(binaryVariant(name))
+	if err != nil {
+		_ = topic.Close()
+		_ = compressed.Close()
+		return nil, err
+	}
+	return &PubSubTopic{
+		ctx:          ctx,
+		ps:           ps,
+		name:         name,
+		topic:        topic,
+		compressed:   compressed,
+		binary:       binary,
+		compress:     compress,
+		encodeBinary: encodeBinary,
+		stats:        stats,
+		metrics:      metrics,
+		peerID:       peerID,
+		filter:       filter,
+	}, nil
+}
+
+// listenTopic starts to listen to a topic and its compressed and binary encoded variants.
+// The topics of other supported versions are listened to and published to as well,
+// hence peers supporting only one of the versions receive the messages.
+// Payloads received on several versions are delivered once.
+// A context, a pubsub, the topic name, a peer ID, a message type filter, whether to publish compressed messages,
+// whether to publish binary encoded messages, the compression statistics, the traffic metrics
+// and the names of the topics of other supported versions have to be given.
+// A ps topic is returned, if joining or subscribing fails, the joined topics are left again.
+func listenTopic(ctx context.Context, ps *pubsub.PubSub, name string, peerID peer.ID, filter *MessageTypeFilter, compress bool, encodeBinary bool, stats *CompressionStats, metrics *Metrics, compatible []string) (_ *PubSubTopic, err error) {
+	t, err := joinTopic(ctx, ps, name, peerID, filter, compress, encodeBinary, stats, metrics)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			for _, topic := range append([]*PubSubTopic{t}, t.compatible...) {
+				topic.unsubscribe()
+				_ = topic.close()
+			}
+		}
+	}()
+	for _, compatibleName := range compatible {
+		compatibleTopic, err := joinTopic(ctx, ps, compatibleName, peerID, filter, compress, encodeBinary, stats, metrics)
+		if err != nil {
+			return nil, err
+		}
+		t.compatible = append(t.compatible, compatibleTopic)
+	}
+	if len(t.compatible) > 0 {
+		t.seen = NewSeenCache(DefaultSeenCacheTTL)
+		for _, compatibleTopic := range t.compatible {
+			compatibleTopic.seen = t.seen
+		}
+	}
+
+	t.Messages = make(chan Message, PubSubBufSize)
+	var done []<-chan struct{}
+	for _, topic := range append([]*PubSubTopic{t}, t.compatible...) {
+		topicDone, err := topic.subscribe(t.Messages)
+		if err != nil {
+			return nil, err
+		}
+		done = append(done, topicDone)
+	}
+	go func() {
+		for _, topicDone := range done {
+			<-topicDone
+		}
+		close(t.Messages)
+	}()
+	return t, nil
+}
 
-	topic, err := ps.Join(instance.Config.Topic)
-	check.Err(err)
+// versionedPeers determines the versions of the topics each peer is subscribed to.
+// Peers are only known if they share a topic with the local peer.
+func (t *PubSubTopic) versionedPeers() map[peer.ID][]string {
+	peers := make(map[peer.ID][]string)
+	for _, versioned := range append([]*PubSubTopic{t}, t.compatible...) {
+		version, ok := versionOf(versioned.name)
+		if !ok {
+			continue
+		}
+		subscribed := make(map[peer.ID]bool)
+		for _, topic := range []*pubsub.Topic{versioned.topic, versioned.compressed, versioned.binary} {
+			for _, peerID := range topic.ListPeers() {
+				subscribed[peerID] = true
+			}
+		}
+		for peerID := range subscribed {
+			peers[peerID] = append(peers[peerID], version.String())
+		}
+	}
+	return peers
+}
 
-	sub, err := topic.Subscribe()
-	check.Err(err)
+// subscribe subscribes to the topic and its variants.
+// Received messages are delivered to the given channel.
+// The returned channel is closed once all subscriptions ended.
+// A channel for the received messages has to be given.
+func (t *PubSubTopic) subscribe(messages chan<- Message) (<-chan struct{}, error) {
+	var subs []*pubsub.Subscription
+	for _, topic := range []*pubsub.Topic{t.topic, t.compressed, t.binary} {
+		sub, err := topic.Subscribe()
+		if err != nil {
+			for _, s := range subs {
+				s.Cancel()
+			}
+			return nil, err
+		}
+		subs = append(subs, sub)
+	}
+	t.subs = subs
 
-	t := &PubSubTopic{
-		ctx:      ctx,
-		ps:       ps,
-		topic:    topic,
-		sub:      sub,
-		peerID:   peerID,
-		Messages: make(chan Message, PubSubBufSize),
+	done := make(chan struct{})
+	ended := make(chan struct{})
+	for _, sub := range subs {
+		go t.listen(sub, messages, ended)
 	}
+	go func() {
+		for range subs {
+			<-ended
+		}
+		close(done)
+	}()
+	return done, nil
+}
 
-	go t.listen()
-	return t
+// unsubscribe cancels the subscriptions of the topic and its variants.
+// The topics stay joined, hence messages can still be published.
+func (t *PubSubTopic) unsubscribe() {
+	for _, sub := range t.subs {
+		sub.Cancel()
+	}
+	t.subs = nil
 }
 
-// listen listens to incoming messages of a pubsub topic.
-func (t *PubSubTopic) listen() {
+// listen listens to incoming messages of a subscription.
+// The subscription, a channel for the received messages
+// and a channel signalling the end of the subscription have to be given.
+func (t *PubSubTopic) listen(sub *pubsub.Subscription, messages chan<- Message, ended chan<- struct{}) {
+	defer func() {
+		ended <- struct{}{}
+	}()
 	for {
-		msg, err := t.sub.Next(t.ctx)
+		msg, err := sub.Next(t.ctx)
 		if err != nil {
-			close(t.Messages)
 			return
 		}
 		// exclude current peer ID
 		if msg.ReceivedFrom == t.peerID {
 			continue
 		}
-		t.Messages <- msg.Data
+		payload, err := decodePayload(msg.Data)
+		if err != nil {
+			continue
+		}
+		if bytes.HasPrefix(msg.Data, gzipMagic) {
+			t.stats.addReceived(len(payload), len(msg.Data))
+		}
+		// drop payloads already received on another version of the topic
+		if t.seen != nil {
+			sum := sha256.Sum256(payload)
+			if !t.seen.Add(base64.RawURLEncoding.EncodeToString(sum[:])) {
+				continue
+			}
+		}
+		// drop message types the host is not interested in
+		if _, ok := t.filter.deliver(payload, msg.GetFrom()); !ok {
+			continue
+		}
+		messages <- payload
+	}
+}
+
+// close leaves the unsubscribed topic and its variants.
+// The first error encountered is returned.
+func (t *PubSubTopic) close() error {
+	for _, topic := range []*pubsub.Topic{t.topic, t.compressed, t.binary} {
+		if err := topic.Close(); err != nil {
+			return err
+		}
 	}
+	return nil
 }
 
-// Publish publishes a message to the pubsub topic.
+// Publish publishes a message to the pubsub topic and the topics of the other supported versions.
+// If the binary encoding is enabled, the message is transcoded and published to the binary encoded variant.
+// If compression is enabled, the message is compressed, either on the binary encoded or the compressed variant.
+// The message is validated before publishing, invalid messages are not published.
 // A message has to be given.
-func (t *PubSubTopic) Publish(message []byte) {
-	err := t.topic.Publish(t.ctx, message)
-	check.Err(err)
+func (t *PubSubTopic) Publish(message []byte) error {
+	if err := t.publish(message); err != nil {
+		return err
+	}
+	for _, compatibleTopic := range t.compatible {
+		if err := compatibleTopic.publish(message); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// publish publishes a message to the pubsub topic of a single version.
+// A message has to be given.
+func (t *PubSubTopic) publish(message []byte) error {
+	topic, payload := t.topic, message
+	if t.encodeBinary {
+		encoded, err := EncodeBinary(message)
+		if err != nil {
+			return err
+		}
+		topic, payload = t.binary, encoded
+	}
+	if t.compress {
+		compressed, err := compress(payload)
+		if err != nil {
+			return err
+		}
+		t.stats.addSent(len(payload), len(compressed))
+		if !t.encodeBinary {
+			topic = t.compressed
+		}
+		payload = compressed
+	}
+	if err := topic.Publish(t.ctx, payload); err != nil {
+		return err
+	}
+	t.metrics.countSent(topic.String())
+	return nil
 }
@@ -0,0 +1,279 @@
+/*
+ * Copyright (c) 2021 The biotopium Authors.
+ * This file is part of biotopium.
+ *
+ * biotopium is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * biotopium is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with biotopium.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package p2p
+
+import (
+	"context"
+	"fmt"
+	"github.com/libp2p/go-libp2p-core/control"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	maddr "github.com/multiformats/go-multiaddr"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Protocols which can be rate limited.
+const (
+	RateLimitDirect = "direct" // streams of the direct protocol and its variants
+	RateLimitSync   = "sync"   // streams of the sync protocol
+	RateLimitPubSub = "pubsub" // pubsub messages, limited by their origin
+)
+
+// bucketIdleTimeout is the duration after which idle buckets are removed.
+const bucketIdleTimeout = 10 * time.Minute
+
+// RateLimit represents a token bucket limit.
+type RateLimit struct {
+	Rate  float64 // tokens added per second
+	Burst int     // maximum number of tokens
+}
+
+// tokenBucket represents the tokens of a peer for a protocol.
+type tokenBucket struct {
+	tokens float64   // available tokens
+	last   time.Time // time of the last refill
+}
+
+// bucketKey identifies the bucket of a peer for a protocol.
+type bucketKey struct {
+	peerID   peer.ID // peer ID
+	protocol string  // rate limited protocol
+}
+
+// Offender represents a peer which exceeded a rate limit.
+type Offender struct {
+	PeerID        string    `json:"peerId"`                // peer ID
+	Violations    uint64    `json:"violations"`            // number of dropped streams and messages
+	LastViolation time.Time `json:"lastViolation"`         // time of the last violation
+	LastProtocol  string    `json:"lastProtocol"`          // protocol of the last violation
+	BannedUntil   time.Time `json:"bannedUntil,omitempty"` // end of the ban, zero if not banned
+}
+
+// RateLimiter limits the streams and pubsub messages per peer and protocol using token buckets.
+// Peers exceeding a limit are reported and, if enabled, banned after a number of violations.
+// The rate limiter also acts as connection gater rejecting banned peers.
+type RateLimiter struct {
+	mutex        sync.Mutex
+	limits       map[string]RateLimit       // limits indexed by protocol
+	buckets      map[bucketKey]*tokenBucket // token buckets
+	offenders    map[peer.ID]*Offender      // peers which exceeded a limit
+	banThreshold uint64                     // number of violations resulting in a ban, 0 if disabled
+	banDuration  time.Duration              // duration of a ban
+	lastSweep    time.Time                  // time of the last removal of idle buckets
+	onBan        func(peer.ID)              // called when a peer is banned
+}
+
+// ValidateRateLimit checks whether a limit can be applied to a protocol.
+// The protocol (RateLimitDirect, RateLimitSync or RateLimitPubSub) and the limit have to be given.
+// An error is returned if the protocol is unknown or the limit is negative.
+func ValidateRateLimit(protocol string, limit RateLimit) error {
+	switch protocol {
+	case RateLimitDirect, RateLimitSync, RateLimitPubSub:
+	default:
+		return fmt.Errorf("unknown rate limited protocol %q", protocol)
+	}
+	if limit.Rate < 0 || limit.Burst < 0 {
+		return fmt.Errorf("invalid %s rate limit: rate %g, burst %d", protocol, limit.Rate, limit.Burst)
+	}
+	return nil
+}
+
+// NewRateLimiter is the factory function of the RateLimiter struct.
+// The limits indexed by protocol, the number of violations resulting in a ban (0 disables banning)
+// and the duration of a ban have to be given.
+// A pointer to a new rate limiter is returned, an error if a limit is invalid.
+func NewRateLimiter(limits map[string]RateLimit, banThreshold uint64, banDuration time.Duration) (*RateLimiter, error) {
+	for protocol, limit := range limits {
+		if err := ValidateRateLimit(protocol, limit); err != nil {
+			return nil, err
+		}
+	}
+	if banDuration < 0 {
+		return nil, fmt.Errorf("invalid ban duration %s", banDuration)
+	}
+	return &RateLimiter{
+		limits:       limits,
+		buckets:      make(map[bucketKey]*tokenBucket),
+		offenders:    make(map[peer.ID]*Offender),
+		banThreshold: banThreshold,
+		banDuration:  banDuration,
+		lastSweep:    time.Now(),
+	}, nil
+}
+
+// Allow takes a token of a peer for a protocol.
+// Protocols without limit are always allowed, a violation is recorded if no token is available.
+// The peer ID and the protocol have to be given.
+// Whether a token was available is returned.
+func (r *RateLimiter) Allow(peerID peer.ID, protocol string) bool {
+	if r == nil {
+		return true
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	limit, ok := r.limits[protocol]
+	if !ok {
+		return true
+	}
+	now := time.Now()
+	if now.Sub(r.lastSweep) > bucketIdleTimeout {
+		r.sweep(now)
+	}
+	key := bucketKey{peerID: peerID, protocol: protocol}
+	bucket, ok := r.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: float64(limit.Burst), last: now}
+		r.buckets[key] = bucket
+	}
+	bucket.tokens += now.Sub(bucket.last).Seconds() * limit.Rate
+	if bucket.tokens > float64(limit.Burst) {
+		bucket.tokens = float64(limit.Burst)
+	}
+	bucket.last = now
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		return true
+	}
+	r.violate(peerID, protocol, now)
+	return false
+}
+
+// violate records a violation of a peer, the lock has to be held.
+// The peer is banned if the number of violations reaches the threshold.
+// The peer ID, the protocol and the current time have to be given.
+func (r *RateLimiter) violate(peerID peer.ID, protocol string, now time.Time) {
+	offender, ok := r.offenders[peerID]
+	if !ok {
+		offender = &Offender{PeerID: peerID.Pretty()}
+		r.offenders[peerID] = offender
+	}
+	offender.Violations++
+	offender.LastViolation = now
+	offender.LastProtocol = protocol
+	if offender.Violations == 1 {
+		logger.Infow("Peer exceeded rate limit", "peer", peerID.Pretty(), "protocol", protocol)
+	}
+	if r.banThreshold == 0 || offender.Violations < r.banThreshold || now.Before(offender.BannedUntil) {
+		return
+	}
+	offender.BannedUntil = now.Add(r.banDuration)
+	offender.Violations = 0
+	logger.Warnw("Banned peer for exceeding rate limit", "peer", peerID.Pretty(), "until", offender.BannedUntil.Format(time.RFC3339), "protocol", protocol)
+	if r.onBan != nil {
+		go r.onBan(peerID)
+	}
+}
+
+// sweep removes buckets which were not used within the idle timeout, the lock has to be held.
+// The current time has to be given.
+func (r *RateLimiter) sweep(now time.Time) {
+	for key, bucket := range r.buckets {
+		if now.Sub(bucket.last) > bucketIdleTimeout {
+			delete(r.buckets, key)
+		}
+	}
+	r.lastSweep = now
+}
+
+// IsBanned checks whether a peer is currently banned.
+// The peer ID has to be given.
+func (r *RateLimiter) IsBanned(peerID peer.ID) bool {
+	if r == nil {
+		return false
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	offender, ok := r.offenders[peerID]
+	return ok && time.Now().Before(offender.BannedUntil)
+}
+
+// Unban lifts the ban of a peer and forgets its violations.
+// The peer ID has to be given.
+func (r *RateLimiter) Unban(peerID peer.ID) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	delete(r.offenders, peerID)
+}
+
+// Offenders reports the peers which exceeded a rate limit, the most recent violation first.
+func (r *RateLimiter) Offenders() []Offender {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	offenders := make([]Offender, 0, len(r.offenders))
+	for _, offender := range r.offenders {
+		offenders = append(offenders, *offender)
+	}
+	sort.Slice(offenders, func(i, j int) bool {
+		return offenders[i].LastViolation.After(offenders[j].LastViolation)
+	})
+	return offenders
+}
+
+// limitStream wraps a stream handler, streams exceeding the rate limit of the remote peer are reset.
+// The protocol and the stream handler have to be given.
+func (r *RateLimiter) limitStream(protocol string, handler network.StreamHandler) network.StreamHandler {
+	return func(s network.Stream) {
+		if !r.Allow(s.Conn().RemotePeer(), protocol) {
+			_ = s.Reset()
+			return
+		}
+		handler(s)
+	}
+}
+
+// limitPubSub creates a pubsub validator, messages exceeding the rate limit of their origin are ignored
+// without penalising the forwarding peer.
+// Messages published by the local peer are validated too, they are never limited.
+// The peer ID of the local peer has to be given.
+func (r *RateLimiter) limitPubSub(local peer.ID) pubsub.ValidatorEx {
+	return func(_ context.Context, _ peer.ID, msg *pubsub.Message) pubsub.ValidationResult {
+		if msg.GetFrom() != local && !r.Allow(msg.GetFrom(), RateLimitPubSub) {
+			return pubsub.ValidationIgnore
+		}
+		return pubsub.ValidationAccept
+	}
+}
+
+// InterceptPeerDial rejects dialing banned peers.
+func (r *RateLimiter) InterceptPeerDial(peerID peer.ID) bool {
+	return !r.IsBanned(peerID)
+}
+
+// InterceptAddrDial allows dialing all addresses.
+func (r *RateLimiter) InterceptAddrDial(peer.ID, maddr.Multiaddr) bool {
+	return true
+}
+
+// InterceptAccept allows all inbound connections, the peer is not known yet.
+func (r *RateLimiter) InterceptAccept(network.ConnMultiaddrs) bool {
+	return true
+}
+
+// InterceptSecured rejects connections of banned peers.
+func (r *RateLimiter) InterceptSecured(_ network.Direction, peerID peer.ID, _ network.ConnMultiaddrs) bool {
+	return !r.IsBanned(peerID)
+}
+
+// InterceptUpgraded allows all upgraded connections.
+func (r *RateLimiter) InterceptUpgraded(network.Conn) (bool, control.DisconnectReason) {
+	return true, 0
+}
@@ -0,0 +1,151 @@
+/*
+ * Copyright (c) 2021 The biotopium Authors.
+ * This file is part of biotopium.
+ *
+ * biotopium is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * biotopium is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with biotopium.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package p2p
+
+import (
+	"context"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	pb "github.com/libp2p/go-libp2p-pubsub/pb"
+	"testing"
+	"time"
+)
+
+// newTestRateLimiter creates a rate limiter allowing a burst of two pubsub messages and one message per second.
+// The number of violations resulting in a ban has to be given.
+func newTestRateLimiter(t *testing.T, banThreshold uint64) *RateLimiter {
+	limiter, err := NewRateLimiter(map[string]RateLimit{RateLimitPubSub: {Rate: 1, Burst: 2}}, banThreshold, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return limiter
+}
+
+func TestRateLimiterAllow(t *testing.T) {
+	limiter := newTestRateLimiter(t, 0)
+	const p = peer.ID("p")
+	if !limiter.Allow(p, RateLimitPubSub) || !limiter.Allow(p, RateLimitPubSub) {
+		t.Fatal("expected the burst to be allowed")
+	}
+	if limiter.Allow(p, RateLimitPubSub) {
+		t.Fatal("expected the message exceeding the burst to be limited")
+	}
+	if !limiter.Allow(peer.ID("other"), RateLimitPubSub) {
+		t.Error("expected the buckets to be kept per peer")
+	}
+	if !limiter.Allow(p, RateLimitDirect) {
+		t.Error("expected protocols without limit to be allowed")
+	}
+	var unlimited *RateLimiter
+	if !unlimited.Allow(p, RateLimitPubSub) {
+		t.Error("expected a missing rate limiter to allow everything")
+	}
+
+	// one token is added per second
+	limiter.mutex.Lock()
+	limiter.buckets[bucketKey{peerID: p, protocol: RateLimitPubSub}].last = time.Now().Add(-time.Second)
+	limiter.mutex.Unlock()
+	if !limiter.Allow(p, RateLimitPubSub) {
+		t.Error("expected the refilled token to be allowed")
+	}
+	if limiter.Allow(p, RateLimitPubSub) {
+		t.Error("expected a single token to be refilled")
+	}
+
+	offenders := limiter.Offenders()
+	if len(offenders) != 1 || offenders[0].PeerID != p.Pretty() || offenders[0].Violations != 2 || offenders[0].LastProtocol != RateLimitPubSub {
+		t.Errorf("expected two violations of %s, got %+v", p.Pretty(), offenders)
+	}
+	if limiter.IsBanned(p) {
+		t.Error("expected no ban if banning is disabled")
+	}
+}
+
+func TestRateLimiterBan(t *testing.T) {
+	limiter := newTestRateLimiter(t, 2)
+	banned := make(chan peer.ID, 1)
+	limiter.onBan = func(peerID peer.ID) {
+		banned <- peerID
+	}
+	const p = peer.ID("p")
+	for i := 0; i < 3; i++ {
+		limiter.Allow(p, RateLimitPubSub)
+	}
+	if limiter.IsBanned(p) {
+		t.Fatal("expected no ban below the threshold")
+	}
+	limiter.Allow(p, RateLimitPubSub)
+	if !limiter.IsBanned(p) {
+		t.Fatal("expected a ban when reaching the threshold")
+	}
+	select {
+	case peerID := <-banned:
+		if peerID != p {
+			t.Errorf("expected %s to be reported as banned, got %s", p, peerID)
+		}
+	case <-time.After(time.Second):
+		t.Error("expected the ban to be reported")
+	}
+	if offenders := limiter.Offenders(); len(offenders) != 1 || offenders[0].BannedUntil.IsZero() {
+		t.Errorf("expected the offender to be banned, got %+v", offenders)
+	}
+
+	// the gater rejects the banned peer only
+	if limiter.InterceptPeerDial(p) || limiter.InterceptSecured(network.DirInbound, p, nil) {
+		t.Error("expected the connections of the banned peer to be rejected")
+	}
+	other := peer.ID("other")
+	if !limiter.InterceptPeerDial(other) || !limiter.InterceptSecured(network.DirOutbound, other, nil) {
+		t.Error("expected the connections of other peers to be allowed")
+	}
+
+	limiter.Unban(p)
+	if limiter.IsBanned(p) || len(limiter.Offenders()) != 0 {
+		t.Error("expected the ban and the violations to be lifted")
+	}
+	if !limiter.InterceptPeerDial(p) {
+		t.Error("expected the connections of the unbanned peer to be allowed")
+	}
+}
+
+func TestLimitPubSub(t *testing.T) {
+	limiter := newTestRateLimiter(t, 0)
+	local, remote, forwarder := peer.ID("local"), peer.ID("remote"), peer.ID("forwarder")
+	validate := limiter.limitPubSub(local)
+	message := func(from peer.ID) *pubsub.Message {
+		return &pubsub.Message{Message: &pb.Message{From: []byte(from)}}
+	}
+	for i := 0; i < 5; i++ {
+		if result := validate(context.Background(), local, message(local)); result != pubsub.ValidationAccept {
+			t.Fatalf("expected messages of the local peer not to be limited, got %d", result)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		if result := validate(context.Background(), forwarder, message(remote)); result != pubsub.ValidationAccept {
+			t.Fatalf("expected the burst to be accepted, got %d", result)
+		}
+	}
+	if result := validate(context.Background(), forwarder, message(remote)); result != pubsub.ValidationIgnore {
+		t.Errorf("expected the message exceeding the burst to be ignored, got %d", result)
+	}
+	if offenders := limiter.Offenders(); len(offenders) != 1 || offenders[0].PeerID != remote.Pretty() {
+		t.Errorf("expected the origin rather than the forwarding peer to be the only offender, got %+v", offenders)
+	}
+}
@@ -0,0 +1,98 @@
+/*
+ * Copyright (c) 2021 The biotopium Authors.
+ * This file is part of biotopium.
+ *
+ * biotopium is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * biotopium is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with biotopium.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package p2p
+
+import (
+	"context"
+	"fmt"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/peerstore"
+	maddr "github.com/multiformats/go-multiaddr"
+	"strings"
+)
+
+// FindPeer looks up the addresses of a peer using the routing layer.
+// The peer ID has to be given.
+// The address information of the peer is returned.
+func (s *Server) FindPeer(peerID peer.ID) (peer.AddrInfo, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.Config.PeerLookupTimeout)
+	defer cancel()
+	return s.DHT.FindPeer(ctx, peerID)
+}
+
+// Connect connects to a peer.
+// Either a peer ID or a multiaddress containing a peer ID has to be given.
+// If the peer ID is unknown, its addresses are looked up using the routing layer.
+func (s *Server) Connect(target string) error {
+	var peerInfo peer.AddrInfo
+	if strings.HasPrefix(target, "/") {
+		addr, err := maddr.NewMultiaddr(target)
+		if err != nil {
+			return err
+		}
+		info, err := peer.AddrInfoFromP2pAddr(addr)
+		if err != nil {
+			return err
+		}
+		peerInfo = *info
+		s.Host.Peerstore().AddAddrs(peerInfo.ID, peerInfo.Addrs, peerstore.TempAddrTTL)
+	} else {
+		peerID, err := peer.Decode(target)
+		if err != nil {
+			return err
+		}
+		peerInfo.ID = peerID
+	}
+	return s.ensureConnected(peerInfo.ID)
+}
+
+// Disconnect closes all connections to a peer.
+// The peer ID has to be given.
+func (s *Server) Disconnect(peerID peer.ID) error {
+	return s.Host.Network().ClosePeer(peerID)
+}
+
+// ensureConnected makes sure a connection to a peer exists.
+// If dialing the known addresses fails, the addresses are looked up using the routing layer
+// and dialing is retried once.
+// The peer ID has to be given.
+func (s *Server) ensureConnected(peerID peer.ID) error {
+	if s.Host.Network().Connectedness(peerID) == network.Connected {
+		return nil
+	}
+	hadAddrs := len(s.Host.Peerstore().Addrs(peerID)) > 0
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.Config.PeerLookupTimeout)
+	defer cancel()
+	err := s.Host.Connect(ctx, peer.AddrInfo{ID: peerID})
+	if err == nil || !hadAddrs {
+		return err
+	}
+
+	// the known addresses might be stale, resolve them again
+	peerInfo, lookupErr := s.FindPeer(peerID)
+	if lookupErr != nil {
+		return fmt.Errorf("failed to dial %s: %v, lookup failed: %v", peerID.Pretty(), err, lookupErr)
+	}
+	s.Host.Peerstore().AddAddrs(peerID, peerInfo.Addrs, peerstore.TempAddrTTL)
+	ctx, cancel = context.WithTimeout(context.Background(), s.Config.PeerLookupTimeout)
+	defer cancel()
+	return s.Host.Connect(ctx, peerInfo)
+}
@@ -0,0 +1,152 @@
+/*
+ * Copyright (c) 2021 The biotopium Authors.
+ * This file is part of biotopium.
+ *
+ * biotopium is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * biotopium is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with biotopium.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package p2p
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/libp2p/go-libp2p-core/peer"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	pb "github.com/libp2p/go-libp2p-pubsub/pb"
+	"riesenacht.ch/biotopium/network/gop2p/blockchain"
+	"sync"
+	"time"
+)
+
+// DefaultSeenCacheTTL is the default duration an action request is remembered.
+const DefaultSeenCacheTTL = 2 * time.Minute
+
+// actionMessageIDPrefix is prepended to the message ID of action requests.
+const actionMessageIDPrefix = "action:"
+
+// SeenCache remembers keys for a limited duration.
+type SeenCache struct {
+	mutex     sync.Mutex
+	ttl       time.Duration        // duration a key is remembered
+	seen      map[string]time.Time // expiry times indexed by key
+	lastSweep time.Time            // time of the last removal of expired keys
+}
+
+// NewSeenCache is the factory function of the SeenCache struct.
+// The duration a key is remembered has to be given.
+// A pointer to a new, empty seen cache is returned.
+func NewSeenCache(ttl time.Duration) *SeenCache {
+	return &SeenCache{
+		ttl:       ttl,
+		seen:      make(map[string]time.Time),
+		lastSweep: time.Now(),
+	}
+}
+
+// Add remembers a key.
+// The key has to be given.
+// Whether the key was not seen before within the duration is returned.
+func (c *SeenCache) Add(key string) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	now := time.Now()
+	if now.Sub(c.lastSweep) > c.ttl {
+		c.sweep(now)
+	}
+	if expiry, ok := c.seen[key]; ok && now.Before(expiry) {
+		return false
+	}
+	c.seen[key] = now.Add(c.ttl)
+	return true
+}
+
+// Len returns the number of remembered keys, including expired keys not removed yet.
+func (c *SeenCache) Len() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return len(c.seen)
+}
+
+// sweep removes all expired keys, the lock has to be held.
+// The current time has to be given.
+func (c *SeenCache) sweep(now time.Time) {
+	for key, expiry := range c.seen {
+		if !now.Before(expiry) {
+			delete(c.seen, key)
+		}
+	}
+	c.lastSweep = now
+}
+
+// actionRequest represents an ActionReqMessage, only the action record is decoded.
+type actionRequest struct {
+	Action *blockchain.Record `json:"action"` // requested action record
+}
+
+// actionHash extracts the hash of the action record of an ActionReqMessage.
+// The hash is only used if it matches the content of the record and the record is signed by its author,
+// otherwise a peer could claim the hash of another action to get it dropped as duplicate.
+// The envelope has to be given.
+// The verified hash and whether it was found are returned.
+func actionHash(envelope *Envelope) (string, bool) {
+	request := &actionRequest{}
+	if err := json.Unmarshal(envelope.Message, request); err != nil || request.Action == nil {
+		return "", false
+	}
+	if err := blockchain.ValidateRecord(request.Action); err != nil {
+		logger.Debugw("Action request without verifiable hash", "hash", request.Action.Hash, "error", err)
+		return "", false
+	}
+	return request.Action.Hash, true
+}
+
+// dropDuplicateAction drops action requests which were already received, e.g. via pubsub and stream.
+// The envelope and the peer it was received from have to be given.
+// Whether the request is a duplicate is returned.
+func (s *Server) dropDuplicateAction(envelope *Envelope, from peer.ID) bool {
+	hash, ok := actionHash(envelope)
+	if !ok {
+		return false
+	}
+	if s.Seen.Add(hash) {
+		return false
+	}
+	logger.Debugw("Dropped duplicate action request", "hash", hash, "peer", from.Pretty())
+	return true
+}
+
+// messageIDOption creates the pubsub option deriving message IDs from the topic and the content.
+func messageIDOption() pubsub.Option {
+	return pubsub.WithMessageIdFn(messageID)
+}
+
+// messageID derives the ID of a pubsub message from the topic and the content,
+// so the same content published by several peers is only delivered and forwarded once per topic.
+// The topic is part of the ID, since the same content is published to the topics of all supported versions.
+// Action requests are identified by the verified hash of their action record,
+// since the envelope differs in the peer ID of the sender.
+// Action requests without a verifiable hash are identified by their content.
+// The message has to be given.
+func messageID(msg *pb.Message) string {
+	if payload, err := decodePayload(msg.Data); err == nil {
+		if envelope, err := ParseEnvelope(payload); err == nil && envelope.Type == MessageTypeActionReq {
+			if hash, ok := actionHash(envelope); ok {
+				return actionMessageIDPrefix + msg.GetTopic() + ":" + hash
+			}
+		}
+	}
+	sum := sha256.Sum256(append([]byte(msg.GetTopic()+"\x00"), msg.Data...))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
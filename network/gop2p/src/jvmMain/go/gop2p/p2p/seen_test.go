@@ -0,0 +1,123 @@
+/*
+ * Copyright (c) 2021 The biotopium Authors.
+ * This file is part of biotopium.
+ *
+ * biotopium is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * biotopium is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with biotopium.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package p2p
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/libp2p/go-libp2p-core/crypto"
+	pb "github.com/libp2p/go-libp2p-pubsub/pb"
+	"riesenacht.ch/biotopium/network/gop2p/blockchain"
+	"strings"
+	"testing"
+)
+
+// actionRequestEnvelope creates a parsed envelope of an ActionReqMessage requesting a signed seed action.
+// The private key of the author and the x coordinate of the seeded realm have to be given.
+// The envelope and the hash of the action record are returned.
+func actionRequestEnvelope(t *testing.T, authorKey crypto.PrivKey, x int) (*Envelope, string) {
+	author, err := AddressFromPublicKey(authorKey.GetPublic())
+	if err != nil {
+		t.Fatal(err)
+	}
+	record := fmt.Sprintf(`{"class":"ActionRecord","timestamp":5,"author":"%s","content":{"class":"SeedAction","produce":{"x":%d,"y":0,"plant":{"owner":"%[1]s","type":"CORN","growth":"GROWN"}},"consume":{"owner":"%[1]s","plantType":"CORN","type":"SEED"}}`, author, x)
+	hashable, err := blockchain.EncodeHashableRecord([]byte(record + "}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash := blockchain.Hash(hashable)
+	sign, err := authorKey.Sign([]byte(hash))
+	if err != nil {
+		t.Fatal(err)
+	}
+	record += fmt.Sprintf(`,"hash":"%s","sign":"%s"}`, hash, base64.StdEncoding.EncodeToString(sign))
+	return actionEnvelope(t, record), hash
+}
+
+// actionEnvelope creates a parsed envelope of an ActionReqMessage.
+// The serialized action record has to be given.
+func actionEnvelope(t *testing.T, record string) *Envelope {
+	envelope, err := ParseEnvelope([]byte(fmt.Sprintf(`{"peerId":"p","message":{"class":"%s","action":%s}}`, MessageTypeActionReq, record)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return envelope
+}
+
+func TestActionHash(t *testing.T) {
+	authorKey, _ := newTestKey(t)
+	envelope, hash := actionRequestEnvelope(t, authorKey, 1)
+	if verified, ok := actionHash(envelope); !ok || verified != hash {
+		t.Errorf("expected the hash %s, got %s", hash, verified)
+	}
+
+	other, otherHash := actionRequestEnvelope(t, authorKey, 2)
+	record := string(other.Message)[strings.Index(string(other.Message), `"action":`)+len(`"action":`) : len(other.Message)-1]
+	tests := map[string]string{
+		"claimed hash of another action": strings.Replace(record, otherHash, hash, 1),
+		"tampered content":               strings.Replace(record, `"x":2`, `"x":1`, 1),
+		"invalid signature":              record[:strings.Index(record, `"sign":`)] + `"sign":"` + base64.StdEncoding.EncodeToString(make([]byte, 64)) + `"}`,
+		"missing hash":                   `{"class":"ActionRecord","timestamp":5}`,
+	}
+	for name, record := range tests {
+		if verified, ok := actionHash(actionEnvelope(t, record)); ok {
+			t.Errorf("%s: expected no verified hash, got %s", name, verified)
+		}
+	}
+}
+
+func TestDuplicateActionMessageID(t *testing.T) {
+	authorKey, _ := newTestKey(t)
+	envelope, hash := actionRequestEnvelope(t, authorKey, 1)
+	other, otherHash := actionRequestEnvelope(t, authorKey, 2)
+	forged := []byte(strings.Replace(string(other.Message), otherHash, hash, 1))
+
+	idOf := func(message json.RawMessage, from string) string {
+		data, err := json.Marshal(&Envelope{PeerID: from, Message: message})
+		if err != nil {
+			t.Fatal(err)
+		}
+		topic := testTopic
+		return messageID(&pb.Message{Data: data, Topic: &topic})
+	}
+	// the same action sent by several peers is identified by its hash
+	if idOf(envelope.Message, "a") != idOf(envelope.Message, "b") {
+		t.Error("expected the same message ID for the same action")
+	}
+	// another action claiming the hash is identified by its content
+	if idOf(forged, "a") == idOf(envelope.Message, "a") {
+		t.Error("expected another message ID for an action claiming a foreign hash")
+	}
+
+	s := &Server{Seen: NewSeenCache(DefaultSeenCacheTTL)}
+	if s.dropDuplicateAction(envelope, "") {
+		t.Error("expected the first request to be delivered")
+	}
+	if !s.dropDuplicateAction(envelope, "") {
+		t.Error("expected the duplicate request to be dropped")
+	}
+	forgedEnvelope, err := ParseEnvelope([]byte(fmt.Sprintf(`{"peerId":"p","message":%s}`, forged)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.dropDuplicateAction(forgedEnvelope, "") {
+		t.Error("expected a request claiming a foreign hash to be delivered")
+	}
+}
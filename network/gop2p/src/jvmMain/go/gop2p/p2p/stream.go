@@ -19,14 +19,16 @@
 package p2p
 
 import (
-	"bufio"
+	"bytes"
 	"context"
 	"github.com/libp2p/go-libp2p-core/host"
 	"github.com/libp2p/go-libp2p-core/network"
 	"github.com/libp2p/go-libp2p-core/peer"
 	"github.com/libp2p/go-libp2p-core/protocol"
-	"log"
-	"riesenacht.ch/biotopium/network/gop2p/check"
+	"io"
+	"io/ioutil"
+	"sync"
+	"time"
 )
 
 const StreamBufSize = 128
@@ -35,50 +37,179 @@ const StreamBufSize = 128
 type Stream struct {
 	Messages chan Message // Message input channel
 
-	protocolID protocol.ID // Protocol ID
+	protocolID   protocol.ID         // Protocol ID
+	compressedID protocol.ID         // protocol ID of the compressed variant
+	binaryID     protocol.ID         // protocol ID of the binary encoded variant
+	compress     bool                // whether to compress sent messages
+	encodeBinary bool                // whether to prefer the binary encoded variant when sending
+	stats        *CompressionStats   // compression statistics
+	fallbackIDs  []protocol.ID       // protocol IDs of the explicitly supported older versions
+	match        func(string) bool   // matches the protocol IDs of all supported versions
+	metrics      *Metrics            // traffic metrics
+	host         host.Host           // host opening the streams
+	connect      func(peer.ID) error // connects to a peer if not connected yet
+	dialTimeout  time.Duration       // timeout for opening a stream
+
+	mutex      sync.Mutex
+	negotiated map[peer.ID]protocol.ID // protocol IDs negotiated on the last stream with a peer
 }
 
-// listenProtocol listens to a protocol of the given name.
-// The host and the protocol name must be given.
+// listenProtocol listens to a protocol of the given name and its compressed and binary encoded variants.
+// Messages of the binary encoded variant may be compressed additionally.
+// Besides the version contained in the protocol name, compatible and explicitly supported versions are accepted.
+// The protocol name, the encoding and the timeout for opening a stream are taken from the configuration of the server,
+// received messages are filtered by its message type filter and counted in its statistics and metrics.
+// Streams exceeding the rate limit of the remote peer are reset.
+// The server and the explicitly supported versions must be given.
 // A pointer to a new stream is returned
-func listenProtocol(h host.Host, protocolName string) *Stream {
+func listenProtocol(srv *Server, supported []ProtocolVersion) *Stream {
+	h, filter, stats, limiter := srv.Host, srv.MessageTypes, srv.Compression, srv.RateLimiter
+	protocolName := srv.Config.ProtocolName
 	protocolID := protocol.ID(protocolName)
 	stream := &Stream{
-		Messages:   make(chan Message, StreamBufSize),
-		protocolID: protocolID,
+		Messages:     make(chan Message, StreamBufSize),
+		protocolID:   protocolID,
+		compressedID: protocol.ID(compressedVariant(protocolName)),
+		binaryID:     protocol.ID(binaryVariant(protocolName)),
+		compress:     srv.Config.CompressDirect,
+		encodeBinary: srv.Config.BinaryDirect,
+		stats:        stats,
+		fallbackIDs:  fallbackIDs(protocolID, supported),
+		match:        protocolMatcher(protocolID, supported),
+		negotiated:   make(map[peer.ID]protocol.ID),
+		metrics:      srv.Traffic,
+		host:         h,
+		connect:      srv.ensureConnected,
+		dialTimeout:  srv.Config.PeerLookupTimeout,
 	}
-	h.SetStreamHandler(protocolID, func(s network.Stream) {
-		buf := bufio.NewReader(s)
-		str, err := buf.ReadString('\n')
+	setVersionedHandler(h, protocolID, supported, limiter.limitStream(RateLimitDirect, func(s network.Stream) {
+		message, err := ioutil.ReadAll(io.LimitReader(s, maxDecompressedSize))
 		if err != nil {
-			err = s.Reset()
-			check.Err(err)
+			_ = s.Reset()
+			return
 		}
-
-		peerID, err := s.Conn().RemotePeer().MarshalText()
-		check.Err(err)
-		log.Printf("received " + str + "from " + string(peerID))
-		stream.Messages <- []byte(str)
-		err = s.Close()
+		stream.deliver(s, message, filter)
+	}))
+	setVersionedHandler(h, stream.compressedID, supported, limiter.limitStream(RateLimitDirect, func(s network.Stream) {
+		compressed, err := ioutil.ReadAll(io.LimitReader(s, maxDecompressedSize))
+		if err != nil {
+			_ = s.Reset()
+			return
+		}
+		payload, err := decompress(bytes.NewReader(compressed))
+		if err != nil {
+			logger.Warnw("Dropped undecodable payload", "peer", s.Conn().RemotePeer().Pretty(), "error", err)
+			_ = s.Reset()
+			return
+		}
+		stats.addReceived(len(payload), len(compressed))
+		stream.deliver(s, payload, filter)
+	}))
+	setVersionedHandler(h, stream.binaryID, supported, limiter.limitStream(RateLimitDirect, func(s network.Stream) {
+		encoded, err := ioutil.ReadAll(io.LimitReader(s, maxDecompressedSize))
+		if err != nil {
+			_ = s.Reset()
+			return
+		}
+		payload, err := decodePayload(encoded)
 		if err != nil {
-			err = s.Reset()
-			check.Err(err)
+			logger.Warnw("Dropped undecodable payload", "peer", s.Conn().RemotePeer().Pretty(), "error", err)
+			_ = s.Reset()
+			return
 		}
-	})
+		if bytes.HasPrefix(encoded, gzipMagic) {
+			stats.addReceived(len(payload), len(encoded))
+		}
+		stream.deliver(s, payload, filter)
+	}))
 
 	return stream
 }
 
+// deliver delivers a received message to the host and closes the stream.
+// The stream, the received message and a message type filter have to be given.
+func (st *Stream) deliver(s network.Stream, message []byte, filter *MessageTypeFilter) {
+	logger.Debugw("Received direct message", "peer", s.Conn().RemotePeer().Pretty(), "protocol", string(s.Protocol()), "bytes", len(message))
+	st.recordNegotiated(s)
+	st.metrics.countReceived(string(s.Protocol()))
+	if _, ok := filter.deliver(message, s.Conn().RemotePeer()); ok {
+		st.Messages <- message
+	}
+	if err := s.Close(); err != nil {
+		_ = s.Reset()
+	}
+}
+
 // Send sends a message to a specific peer.
+// If the peer is not connected, it is looked up and dialed first.
+// If the binary encoding is enabled and supported by the peer, the message is binary encoded.
+// If compression is enabled and supported by the peer, the message is compressed.
 // The peer ID of the receiver and the serialized message has to be given.
-func (s *Stream) Send(peerID peer.ID, serialized []byte) {
-	stream, err := instance.Host.NewStream(context.Background(), peerID, instance.Stream.protocolID)
-	check.Err(err)
-	_, err = stream.Write(serialized)
-	check.Err(err)
+func (s *Stream) Send(peerID peer.ID, serialized []byte) error {
+	err := s.connect(peerID)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), s.dialTimeout)
+	defer cancel()
+	var protocols []protocol.ID
+	if s.encodeBinary {
+		protocols = append(protocols, s.binaryID)
+	}
+	if s.compress {
+		protocols = append(protocols, s.compressedID)
+	}
+	protocols = append(protocols, s.protocolID)
+	protocols = append(protocols, s.fallbackIDs...)
+	stream, err := s.host.NewStream(ctx, peerID, protocols...)
+	if err != nil {
+		return err
+	}
+	s.recordNegotiated(stream)
+	payload := serialized
+	if stream.Protocol() == s.binaryID {
+		payload, err = EncodeBinary(serialized)
+		if err != nil {
+			_ = stream.Reset()
+			return err
+		}
+	}
+	if s.compress && (stream.Protocol() == s.compressedID || stream.Protocol() == s.binaryID) {
+		compressed, err := compress(payload)
+		if err != nil {
+			_ = stream.Reset()
+			return err
+		}
+		s.stats.addSent(len(payload), len(compressed))
+		payload = compressed
+	}
+	_, err = stream.Write(payload)
+	if err != nil {
+		_ = stream.Reset()
+		return err
+	}
+	s.metrics.countSent(string(stream.Protocol()))
 	err = stream.Close()
 	if err != nil {
-		err = stream.Reset()
-		check.Err(err)
+		_ = stream.Reset()
+		return err
 	}
+	return nil
+}
+
+// recordNegotiated records the protocol ID negotiated on a stream.
+// The stream has to be given.
+func (st *Stream) recordNegotiated(s network.Stream) {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+	st.negotiated[s.Conn().RemotePeer()] = s.Protocol()
+}
+
+// negotiatedWith returns the protocol ID negotiated on the last stream with a peer.
+// An empty protocol ID is returned if no stream was opened yet.
+// The peer ID has to be given.
+func (st *Stream) negotiatedWith(peerID peer.ID) protocol.ID {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+	return st.negotiated[peerID]
 }
@@ -0,0 +1,298 @@
+/*
+ * Copyright (c) 2021 The biotopium Authors.
+ * This file is part of biotopium.
+ *
+ * biotopium is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * biotopium is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with biotopium.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package p2p
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/protocol"
+	"riesenacht.ch/biotopium/network/gop2p/blockchain"
+	"time"
+)
+
+// SyncProtocol is the protocol for fetching blocks by height range.
+const SyncProtocol = protocol.ID("/biotopium/0.1.0/sync")
+
+// Limits of the sync protocol.
+const (
+	syncChunkBlocks  = 64               // maximum number of blocks in a chunk
+	syncChunkBytes   = 1 << 20          // maximum size of the blocks in a chunk, at least one block is sent
+	syncFrameBytes   = 4 << 20          // maximum size of a frame read from a sync stream
+	syncChunkTimeout = 30 * time.Second // maximum duration for transferring a chunk
+	syncRetries      = 3                // number of resumptions after a failed transfer
+)
+
+// Errors of the sync protocol.
+var (
+	ErrSyncRejected = errors.New("sync request rejected")           // the remote peer could not serve a sync request
+	ErrSyncStalled  = errors.New("sync transfer makes no progress") // the remote peer sent a chunk not advancing the transfer
+)
+
+// SyncRequest represents a request for a height range of blocks.
+type SyncRequest struct {
+	From     uint64  `json:"from"`               // first requested height
+	FromHash string  `json:"fromHash,omitempty"` // hash of a known block, the blocks after it are requested instead of From
+	To       *uint64 `json:"to,omitempty"`       // last requested height (inclusive), up to the head if nil
+	Chunks   int     `json:"chunks,omitempty"`   // maximum number of chunks sent, unlimited if 0
+}
+
+// SyncChunk represents a chunk of blocks sent in response to a sync request.
+type SyncChunk struct {
+	Blocks []json.RawMessage `json:"blocks"`          // serialized blocks
+	Next   uint64            `json:"next"`            // height of the next block, used to resume the transfer
+	Done   bool              `json:"done"`            // whether this is the last chunk
+	Error  string            `json:"error,omitempty"` // reason if the request could not be served
+}
+
+// listenSync serves sync requests from the block store.
+// Each request is answered with chunks of bounded size until the requested range is transferred.
+// Requests of compatible protocol versions are accepted, requests exceeding the rate limit of the peer are reset.
+// The host, the block store (nil if disabled) and the rate limiter have to be given.
+func listenSync(h host.Host, store *blockchain.Store, limiter *RateLimiter) {
+	setVersionedHandler(h, SyncProtocol, nil, limiter.limitStream(RateLimitSync, func(s network.Stream) {
+		defer s.Close()
+		request := &SyncRequest{}
+		if err := readFrame(s, request); err != nil {
+			_ = s.Reset()
+			return
+		}
+		if err := serveSync(s, store, request); err != nil {
+			logger.Warnw("Could not serve sync request", "peer", s.Conn().RemotePeer().Pretty(), "error", err)
+			_ = s.Reset()
+		}
+	}))
+}
+
+// serveSync writes the chunks answering a sync request.
+// The stream, the block store and the request have to be given.
+func serveSync(s network.Stream, store *blockchain.Store, request *SyncRequest) error {
+	if store == nil {
+		return writeFrame(s, &SyncChunk{Done: true, Error: ErrBlockStoreDisabled.Error()})
+	}
+	from := request.From
+	if len(request.FromHash) > 0 {
+		height, ok := store.HeightOf(request.FromHash)
+		if !ok {
+			return writeFrame(s, &SyncChunk{Done: true, Error: fmt.Sprintf("unknown block %s", request.FromHash)})
+		}
+		from = height + 1
+	}
+	for sent := 1; ; sent++ {
+		chunk, err := nextChunk(store, from, request.To)
+		if err != nil {
+			return err
+		}
+		if err := writeFrame(s, chunk); err != nil {
+			return err
+		}
+		if chunk.Done || sent == request.Chunks {
+			return nil
+		}
+		from = chunk.Next
+	}
+}
+
+// nextChunk reads the next chunk of blocks from the block store.
+// A chunk contains at most syncChunkBlocks blocks of syncChunkBytes bytes, but at least one block.
+// The block store, the first height and the last height (inclusive, up to the head if nil) have to be given.
+func nextChunk(store *blockchain.Store, from uint64, last *uint64) (*SyncChunk, error) {
+	head := store.Height()
+	to := head - 1
+	if last != nil && *last < to {
+		to = *last
+	}
+	chunk := &SyncChunk{Next: from}
+	size := 0
+	for chunk.Next <= to && chunk.Next < head && len(chunk.Blocks) < syncChunkBlocks {
+		block, err := store.Get(chunk.Next)
+		if err != nil {
+			return nil, err
+		}
+		if len(chunk.Blocks) > 0 && size+len(block) > syncChunkBytes {
+			break
+		}
+		chunk.Blocks = append(chunk.Blocks, block)
+		size += len(block)
+		chunk.Next++
+	}
+	chunk.Done = chunk.Next > to || chunk.Next >= head
+	return chunk, nil
+}
+
+// writeFrame writes a newline-terminated JSON frame.
+// The stream and the value to write have to be given.
+func writeFrame(s network.Stream, value interface{}) error {
+	// deadlines are not supported by all transports
+	_ = s.SetWriteDeadline(time.Now().Add(syncChunkTimeout))
+	serialized, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	_, err = s.Write(append(serialized, '\n'))
+	return err
+}
+
+// readFrame reads a newline-terminated JSON frame.
+// The stream and the value to read into have to be given.
+func readFrame(s network.Stream, value interface{}) error {
+	_ = s.SetReadDeadline(time.Now().Add(syncChunkTimeout))
+	return readFrameFrom(bufio.NewReaderSize(s, 4096), value)
+}
+
+// readFrameFrom reads a newline-terminated JSON frame from a buffered reader.
+// The reader and the value to read into have to be given.
+func readFrameFrom(reader *bufio.Reader, value interface{}) error {
+	var frame []byte
+	for {
+		line, isPrefix, err := reader.ReadLine()
+		if err != nil {
+			return err
+		}
+		frame = append(frame, line...)
+		if len(frame) > syncFrameBytes {
+			return fmt.Errorf("frame exceeds %d bytes", syncFrameBytes)
+		}
+		if !isPrefix {
+			break
+		}
+	}
+	return json.Unmarshal(frame, value)
+}
+
+// FetchBlocks fetches blocks from a peer using the sync protocol.
+// Each received chunk is passed to the handler.
+// If the transfer fails, it is resumed at the next missing height.
+// The peer ID, the request and the chunk handler have to be given.
+func (s *Server) FetchBlocks(peerID peer.ID, request SyncRequest, handle func(chunk *SyncChunk) error) error {
+	var err error
+	for attempt := 0; attempt <= syncRetries; attempt++ {
+		var done bool
+		done, err = s.fetchChunks(peerID, &request, handle)
+		if done || errors.Is(err, ErrSyncRejected) {
+			return err
+		}
+		logger.Warnw("Sync interrupted", "peer", peerID.Pretty(), "height", request.From, "error", err)
+	}
+	return err
+}
+
+// FetchChunk fetches the next chunk of blocks from a peer using the sync protocol.
+// The transfer of a height range is continued by requesting the next height of the chunk until the chunk is done.
+// The peer ID and the request have to be given.
+// The received chunk is returned.
+func (s *Server) FetchChunk(peerID peer.ID, request SyncRequest) (*SyncChunk, error) {
+	request.Chunks = 1
+	var received *SyncChunk
+	err := s.FetchBlocks(peerID, request, func(chunk *SyncChunk) error {
+		received = chunk
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return received, nil
+}
+
+// fetchChunks opens a sync stream and receives chunks until the transfer is done or fails.
+// The request is updated with the height to resume the transfer at.
+// The peer ID, the request and the chunk handler have to be given.
+// Whether the transfer is done is returned.
+func (s *Server) fetchChunks(peerID peer.ID, request *SyncRequest, handle func(chunk *SyncChunk) error) (bool, error) {
+	if err := s.ensureConnected(peerID); err != nil {
+		return false, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), s.Config.PeerLookupTimeout)
+	defer cancel()
+	stream, err := s.Host.NewStream(ctx, peerID, SyncProtocol)
+	if err != nil {
+		return false, err
+	}
+	defer stream.Close()
+	if err := writeFrame(stream, request); err != nil {
+		_ = stream.Reset()
+		return false, err
+	}
+	reader := bufio.NewReaderSize(stream, 4096)
+	for {
+		_ = stream.SetReadDeadline(time.Now().Add(syncChunkTimeout))
+		chunk := &SyncChunk{}
+		if err := readFrameFrom(reader, chunk); err != nil {
+			_ = stream.Reset()
+			return false, err
+		}
+		if len(chunk.Error) > 0 {
+			return true, fmt.Errorf("%w: %s", ErrSyncRejected, chunk.Error)
+		}
+		// the height is unknown to the requester if the transfer starts after a hash
+		if !chunk.Done && (len(chunk.Blocks) == 0 || (len(request.FromHash) == 0 && chunk.Next <= request.From)) {
+			_ = stream.Reset()
+			return true, fmt.Errorf("%w: %d blocks up to height %d requested from height %d", ErrSyncStalled, len(chunk.Blocks), chunk.Next, request.From)
+		}
+		if err := handle(chunk); err != nil {
+			_ = stream.Reset()
+			return true, err
+		}
+		// resume after the received blocks
+		request.From = chunk.Next
+		request.FromHash = ""
+		if chunk.Done {
+			return true, nil
+		}
+		if request.Chunks > 0 {
+			if request.Chunks--; request.Chunks == 0 {
+				return true, nil
+			}
+		}
+	}
+}
+
+// SyncChain fetches the blocks following the stored chain from a peer.
+// The blocks are validated and appended to the block store.
+// The peer ID has to be given.
+// The number of stored blocks is returned.
+func (s *Server) SyncChain(peerID peer.ID) (uint64, error) {
+	if s.Blocks == nil {
+		return 0, ErrBlockStoreDisabled
+	}
+	request := SyncRequest{From: s.Blocks.Height()}
+	var stored uint64
+	err := s.FetchBlocks(peerID, request, func(chunk *SyncChunk) error {
+		for _, serialized := range chunk.Blocks {
+			block, err := blockchain.DecodeBlock(serialized)
+			if err != nil {
+				return err
+			}
+			if err := s.BlockValidator.ValidateBlock(block); err != nil {
+				return err
+			}
+			if err := s.Blocks.Append(block); err != nil {
+				return err
+			}
+			stored++
+		}
+		return nil
+	})
+	return stored, err
+}
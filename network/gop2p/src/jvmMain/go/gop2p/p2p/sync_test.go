@@ -0,0 +1,220 @@
+/*
+ * Copyright (c) 2021 The biotopium Authors.
+ * This file is part of biotopium.
+ *
+ * biotopium is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * biotopium is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with biotopium.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package p2p
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/libp2p/go-libp2p-core/network"
+	"riesenacht.ch/biotopium/network/gop2p/blockchain"
+	"sync/atomic"
+	"testing"
+)
+
+// newSyncNetwork starts a server with a block store containing a signed chain and a requesting server.
+// The number of stored blocks has to be given.
+// The serving server, the requesting server and the stored blocks are returned.
+func newSyncNetwork(t *testing.T, count int) (*Server, *Server, []*blockchain.Block) {
+	n := newTestNetwork(t)
+	server := n.start(WithBlockStore(t.TempDir() + "/blocks"))
+	requester := n.start()
+	n.connectAll()
+	blocklordKey, _ := newTestKey(t)
+	blocks := signedChain(t, blocklordKey, count)
+	storeBlocks(t, server, blocks)
+	return server, requester, blocks
+}
+
+// fetchAll fetches blocks using the sync protocol.
+// The requesting server, the serving server and the request have to be given.
+// The received chunks are returned.
+func fetchAll(t *testing.T, requester *Server, server *Server, request SyncRequest) []*SyncChunk {
+	var chunks []*SyncChunk
+	err := requester.FetchBlocks(server.Host.ID(), request, func(chunk *SyncChunk) error {
+		chunks = append(chunks, chunk)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return chunks
+}
+
+// expectBlocks checks whether chunks contain consecutive blocks of a chain.
+// The chunks, the chain and the first expected height have to be given.
+func expectBlocks(t *testing.T, chunks []*SyncChunk, blocks []*blockchain.Block, from int) {
+	height := from
+	for i, chunk := range chunks {
+		for _, serialized := range chunk.Blocks {
+			if height >= len(blocks) || string(serialized) != string(blocks[height].Raw()) {
+				t.Fatalf("chunk %d: unexpected block at height %d", i, height)
+			}
+			height++
+		}
+		if chunk.Next != uint64(height) {
+			t.Errorf("chunk %d: expected next height %d, got %d", i, height, chunk.Next)
+		}
+		if last := i == len(chunks)-1; chunk.Done != last {
+			t.Errorf("chunk %d: expected done to be %t", i, last)
+		}
+	}
+	if height != len(blocks) {
+		t.Errorf("expected blocks up to height %d, got %d", len(blocks), height)
+	}
+}
+
+func TestSyncChunking(t *testing.T) {
+	server, requester, blocks := newSyncNetwork(t, 2*syncChunkBlocks+5)
+
+	chunks := fetchAll(t, requester, server, SyncRequest{})
+	if len(chunks) != 3 {
+		t.Fatalf("expected 3 chunks, got %d", len(chunks))
+	}
+	expectBlocks(t, chunks, blocks, 0)
+
+	// the last requested height is inclusive
+	last := uint64(syncChunkBlocks)
+	chunks = fetchAll(t, requester, server, SyncRequest{From: 1, To: &last})
+	expectBlocks(t, chunks, blocks[:last+1], 1)
+}
+
+func TestSyncResume(t *testing.T) {
+	server, requester, blocks := newSyncNetwork(t, 2*syncChunkBlocks+5)
+
+	// the chunk cursor continues at the next height of each chunk
+	var chunks []*SyncChunk
+	request := SyncRequest{}
+	for len(chunks) == 0 || !chunks[len(chunks)-1].Done {
+		chunk, err := requester.FetchChunk(server.Host.ID(), request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		chunks = append(chunks, chunk)
+		request.From = chunk.Next
+	}
+	expectBlocks(t, chunks, blocks, 0)
+
+	// an interrupted transfer is resumed at the next missing height
+	var interrupted int32
+	server.Host.SetStreamHandler(SyncProtocol, func(s network.Stream) {
+		request := &SyncRequest{}
+		if err := readFrame(s, request); err != nil {
+			_ = s.Reset()
+			return
+		}
+		if atomic.CompareAndSwapInt32(&interrupted, 0, 1) {
+			request.Chunks = 1
+			_ = serveSync(s, server.Blocks, request)
+			_ = s.Reset()
+			return
+		}
+		_ = serveSync(s, server.Blocks, request)
+		_ = s.Close()
+	})
+	expectBlocks(t, fetchAll(t, requester, server, SyncRequest{}), blocks, 0)
+	if atomic.LoadInt32(&interrupted) == 0 {
+		t.Error("expected the transfer to be interrupted")
+	}
+}
+
+func TestSyncFromHash(t *testing.T) {
+	server, requester, blocks := newSyncNetwork(t, 10)
+
+	chunks := fetchAll(t, requester, server, SyncRequest{FromHash: blocks[6].Hash})
+	expectBlocks(t, chunks, blocks, 7)
+
+	// the blocks after the head are an empty, done chunk
+	chunks = fetchAll(t, requester, server, SyncRequest{FromHash: blocks[9].Hash})
+	if len(chunks) != 1 || len(chunks[0].Blocks) != 0 || !chunks[0].Done {
+		t.Errorf("expected a single empty chunk, got %d chunks", len(chunks))
+	}
+
+	err := requester.FetchBlocks(server.Host.ID(), SyncRequest{FromHash: "unknown"}, func(*SyncChunk) error {
+		return nil
+	})
+	if !errors.Is(err, ErrSyncRejected) {
+		t.Errorf("expected %v, got %v", ErrSyncRejected, err)
+	}
+}
+
+func TestSyncEmptyStore(t *testing.T) {
+	server, requester, _ := newSyncNetwork(t, 0)
+
+	chunks := fetchAll(t, requester, server, SyncRequest{})
+	if len(chunks) != 1 || len(chunks[0].Blocks) != 0 || !chunks[0].Done || chunks[0].Next != 0 {
+		t.Errorf("expected a single empty chunk, got %d chunks", len(chunks))
+	}
+
+	// a disabled block store rejects the request
+	err := server.FetchBlocks(requester.Host.ID(), SyncRequest{}, func(*SyncChunk) error {
+		return nil
+	})
+	if !errors.Is(err, ErrSyncRejected) {
+		t.Errorf("expected %v, got %v", ErrSyncRejected, err)
+	}
+}
+
+func TestSyncStalled(t *testing.T) {
+	server, requester, _ := newSyncNetwork(t, 0)
+	stalled := map[string]*SyncChunk{
+		"empty chunk":       {Next: 5},
+		"next not advanced": {Blocks: []json.RawMessage{json.RawMessage(`{}`)}, Next: 3},
+	}
+	for name, chunk := range stalled {
+		chunk := chunk
+		var streams int32
+		server.Host.SetStreamHandler(SyncProtocol, func(s network.Stream) {
+			atomic.AddInt32(&streams, 1)
+			if err := readFrame(s, &SyncRequest{}); err != nil {
+				_ = s.Reset()
+				return
+			}
+			// the chunk is repeated as long as the requester reads
+			for writeFrame(s, chunk) == nil {
+			}
+		})
+		err := requester.FetchBlocks(server.Host.ID(), SyncRequest{From: 3}, func(*SyncChunk) error {
+			return nil
+		})
+		if !errors.Is(err, ErrSyncStalled) {
+			t.Errorf("%s: expected %v, got %v", name, ErrSyncStalled, err)
+		}
+		if opened := atomic.LoadInt32(&streams); opened != 1 {
+			t.Errorf("%s: expected no resumption, got %d streams", name, opened)
+		}
+	}
+}
+
+func TestGetBlocks(t *testing.T) {
+	server, _, blocks := newSyncNetwork(t, syncChunkBlocks+5)
+
+	var chunks []*SyncChunk
+	for from := uint64(0); len(chunks) == 0 || !chunks[len(chunks)-1].Done; {
+		chunk, err := server.GetBlocks(from, uint64(len(blocks)-1))
+		if err != nil {
+			t.Fatal(err)
+		}
+		chunks = append(chunks, chunk)
+		from = chunk.Next
+	}
+	if len(chunks) != 2 {
+		t.Errorf("expected 2 chunks, got %d", len(chunks))
+	}
+	expectBlocks(t, chunks, blocks, 0)
+}
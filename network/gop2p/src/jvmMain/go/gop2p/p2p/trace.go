@@ -0,0 +1,123 @@
+/*
+ * Copyright (c) 2021 The biotopium Authors.
+ * This file is part of biotopium.
+ *
+ * biotopium is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * biotopium is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with biotopium.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package p2p
+
+import (
+	"fmt"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	pb "github.com/libp2p/go-libp2p-pubsub/pb"
+	"sync"
+)
+
+// Formats of the trace file.
+const (
+	TraceFormatJSON     = "json" // JSON lines
+	TraceFormatProtobuf = "pb"   // length delimited protobufs
+)
+
+// fileTracer writes trace events to a file.
+type fileTracer interface {
+	pubsub.EventTracer
+	Close()
+}
+
+// TraceRecorder records the gossipsub trace events.
+// The most recent events are kept in a ring buffer, all events can additionally be written to a file.
+type TraceRecorder struct {
+	mutex  sync.Mutex
+	events []*pb.TraceEvent // ring buffer of the most recent events
+	next   int              // index of the next event in the ring buffer
+	full   bool             // whether the ring buffer is full
+	file   fileTracer       // tracer writing to the trace file, nil if disabled
+}
+
+// NewTraceRecorder is the factory function of the TraceRecorder struct.
+// The size of the ring buffer, the path of the trace file and its format have to be given.
+// A size of 0 disables the ring buffer, an empty path disables the trace file.
+// A pointer to a new trace recorder is returned, an error if the size is negative or the trace file cannot be created.
+func NewTraceRecorder(size int, path string, format string) (*TraceRecorder, error) {
+	if size < 0 {
+		return nil, fmt.Errorf("invalid trace buffer size %d", size)
+	}
+	r := &TraceRecorder{
+		events: make([]*pb.TraceEvent, size),
+	}
+	if len(path) == 0 {
+		return r, nil
+	}
+	var err error
+	switch format {
+	case TraceFormatJSON, "":
+		r.file, err = pubsub.NewJSONTracer(path)
+	case TraceFormatProtobuf:
+		r.file, err = pubsub.NewPBTracer(path)
+	default:
+		err = fmt.Errorf("unknown trace format %s", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// traceRecorderOption creates the pubsub option passing the trace events to the recorder.
+// The option has to be given after the message ID option, the message IDs of the events are derived when tracing.
+// The trace recorder has to be given.
+func traceRecorderOption(r *TraceRecorder) pubsub.Option {
+	return pubsub.WithEventTracer(r)
+}
+
+// Trace records a trace event.
+// The event has to be given.
+func (r *TraceRecorder) Trace(evt *pb.TraceEvent) {
+	if r.file != nil {
+		r.file.Trace(evt)
+	}
+	if len(r.events) == 0 {
+		return
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.events[r.next] = evt
+	r.next = (r.next + 1) % len(r.events)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// Events returns the recorded trace events in chronological order.
+func (r *TraceRecorder) Events() []*pb.TraceEvent {
+	if r == nil {
+		return []*pb.TraceEvent{}
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	events := make([]*pb.TraceEvent, 0, len(r.events))
+	if r.full {
+		events = append(events, r.events[r.next:]...)
+	}
+	return append(events, r.events[:r.next]...)
+}
+
+// Close flushes and closes the trace file.
+func (r *TraceRecorder) Close() {
+	if r != nil && r.file != nil {
+		r.file.Close()
+	}
+}
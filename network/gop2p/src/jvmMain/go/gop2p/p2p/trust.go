@@ -0,0 +1,133 @@
+/*
+ * Copyright (c) 2021 The biotopium Authors.
+ * This file is part of biotopium.
+ *
+ * biotopium is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * biotopium is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with biotopium.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package p2p
+
+import (
+	"fmt"
+	"github.com/libp2p/go-libp2p-core/peer"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	"time"
+)
+
+// Peer score parameters penalising peers which deliver invalid messages, e.g. forged block announcements.
+const (
+	invalidMessageDeliveriesWeight = -100
+	invalidMessageDeliveriesDecay  = 0.9
+	gossipThreshold                = -100
+	publishThreshold               = -500
+	graylistThreshold              = -1000
+)
+
+// BlocklordTrust represents the set of trusted blocklords.
+// A blocklord is identified either by its peer ID or by its address.
+type BlocklordTrust struct {
+	peers     map[peer.ID]bool // trusted peer IDs
+	addresses map[Address]bool // trusted addresses
+}
+
+// newBlocklordTrust is the factory function of the BlocklordTrust struct.
+// The trusted peer IDs and addresses have to be given.
+// A pointer to a new blocklord trust is returned, an error if a peer ID is malformed.
+func newBlocklordTrust(peerIDs []string, addresses []string) (*BlocklordTrust, error) {
+	trust := &BlocklordTrust{
+		peers:     make(map[peer.ID]bool),
+		addresses: make(map[Address]bool),
+	}
+	for _, encoded := range peerIDs {
+		peerID, err := peer.Decode(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("trusted peer %q: %w", encoded, err)
+		}
+		trust.peers[peerID] = true
+	}
+	for _, address := range addresses {
+		trust.addresses[Address(address)] = true
+	}
+	return trust, nil
+}
+
+// Enabled checks whether a trusted blocklord set is configured.
+// If not, all peers are trusted.
+func (t *BlocklordTrust) Enabled() bool {
+	return len(t.peers) > 0 || len(t.addresses) > 0
+}
+
+// IsTrustedAuthor checks whether the author address of a block is a trusted blocklord.
+// If only peer IDs are configured, the addresses derived from them are trusted.
+// The address of the author has to be given.
+func (t *BlocklordTrust) IsTrustedAuthor(author string) bool {
+	if !t.Enabled() {
+		return true
+	}
+	if t.addresses[Address(author)] {
+		return true
+	}
+	derived, err := AddressToPeerID(Address(author))
+	return err == nil && t.peers[derived]
+}
+
+// IsTrustedOrigin checks whether a peer is a trusted blocklord.
+// The peer is trusted if its peer ID is configured,
+// or if its peer ID is derived from a configured address.
+// The peer ID has to be given.
+func (t *BlocklordTrust) IsTrustedOrigin(peerID peer.ID) bool {
+	if !t.Enabled() {
+		return true
+	}
+	if t.peers[peerID] {
+		return true
+	}
+	address, err := PeerIDToAddress(peerID)
+	return err == nil && t.addresses[address]
+}
+
+// peerScoreOption creates the gossipsub option enabling peer scoring on topics.
+// Peers delivering messages rejected by a validator are penalised and eventually graylisted.
+// The topic names have to be given.
+func peerScoreOption(topics ...string) pubsub.Option {
+	topicParams := make(map[string]*pubsub.TopicScoreParams)
+	for _, topic := range topics {
+		topicParams[topic] = topicScoreParams()
+	}
+	return pubsub.WithPeerScore(
+		&pubsub.PeerScoreParams{
+			Topics:           topicParams,
+			AppSpecificScore: func(peer.ID) float64 { return 0 },
+			DecayInterval:    time.Second,
+			DecayToZero:      0.01,
+			RetainScore:      time.Hour,
+		},
+		&pubsub.PeerScoreThresholds{
+			GossipThreshold:   gossipThreshold,
+			PublishThreshold:  publishThreshold,
+			GraylistThreshold: graylistThreshold,
+		},
+	)
+}
+
+// topicScoreParams creates the score parameters of a topic.
+// Topics joined after the creation of the pubsub use them as well.
+func topicScoreParams() *pubsub.TopicScoreParams {
+	return &pubsub.TopicScoreParams{
+		TopicWeight:                    1,
+		TimeInMeshQuantum:              time.Second,
+		InvalidMessageDeliveriesWeight: invalidMessageDeliveriesWeight,
+		InvalidMessageDeliveriesDecay:  invalidMessageDeliveriesDecay,
+	}
+}
@@ -0,0 +1,246 @@
+/*
+ * Copyright (c) 2021 The biotopium Authors.
+ * This file is part of biotopium.
+ *
+ * biotopium is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * biotopium is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with biotopium.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package p2p
+
+import (
+	"fmt"
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/protocol"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ProtocolVersion represents the semantic version contained in a protocol ID or topic name,
+// e.g. 0.1.0 in /biotopium/0.1.0/direct.
+type ProtocolVersion struct {
+	Major uint64
+	Minor uint64
+	Patch uint64
+}
+
+// ParseProtocolVersion parses a semantic version of the form major.minor.patch.
+// The version string has to be given.
+func ParseProtocolVersion(version string) (ProtocolVersion, error) {
+	parts := strings.Split(version, ".")
+	if len(parts) != 3 {
+		return ProtocolVersion{}, fmt.Errorf("invalid protocol version %q", version)
+	}
+	var numbers [3]uint64
+	for i, part := range parts {
+		number, err := strconv.ParseUint(part, 10, 64)
+		if err != nil {
+			return ProtocolVersion{}, fmt.Errorf("invalid protocol version %q", version)
+		}
+		numbers[i] = number
+	}
+	return ProtocolVersion{Major: numbers[0], Minor: numbers[1], Patch: numbers[2]}, nil
+}
+
+// parseProtocolVersions parses a list of semantic versions.
+// The version strings have to be given.
+func parseProtocolVersions(versions []string) ([]ProtocolVersion, error) {
+	parsed := make([]ProtocolVersion, 0, len(versions))
+	for _, version := range versions {
+		v, err := ParseProtocolVersion(version)
+		if err != nil {
+			return nil, err
+		}
+		parsed = append(parsed, v)
+	}
+	return parsed, nil
+}
+
+// String returns the version in the form major.minor.patch.
+func (v ProtocolVersion) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+// Compatible checks whether messages of another version are understood.
+// Versions are compatible if the major versions are equal,
+// during initial development (major version 0) the minor versions have to be equal as well.
+// The other version has to be given.
+func (v ProtocolVersion) Compatible(other ProtocolVersion) bool {
+	if v.Major != other.Major {
+		return false
+	}
+	return v.Major > 0 || v.Minor == other.Minor
+}
+
+// less checks whether the version precedes another version.
+// The other version has to be given.
+func (v ProtocolVersion) less(other ProtocolVersion) bool {
+	if v.Major != other.Major {
+		return v.Major < other.Major
+	}
+	if v.Minor != other.Minor {
+		return v.Minor < other.Minor
+	}
+	return v.Patch < other.Patch
+}
+
+// splitVersioned splits a protocol ID or topic name into its segments and finds the version segment.
+// The protocol ID or topic name has to be given.
+// The segments, the index of the version segment and the version are returned.
+func splitVersioned(name string) ([]string, int, ProtocolVersion, bool) {
+	parts := strings.Split(name, "/")
+	for i, part := range parts {
+		if version, err := ParseProtocolVersion(part); err == nil {
+			return parts, i, version, true
+		}
+	}
+	return nil, 0, ProtocolVersion{}, false
+}
+
+// withVersion replaces the version of a protocol ID or topic name.
+// Names without version are returned unchanged.
+// The protocol ID or topic name and the new version have to be given.
+func withVersion(name string, version ProtocolVersion) string {
+	parts, index, _, ok := splitVersioned(name)
+	if !ok {
+		return name
+	}
+	parts[index] = version.String()
+	return strings.Join(parts, "/")
+}
+
+// versionOf returns the version of a protocol ID or topic name.
+// The protocol ID or topic name has to be given.
+func versionOf(name string) (ProtocolVersion, bool) {
+	_, _, version, ok := splitVersioned(name)
+	return version, ok
+}
+
+// protocolMatcher creates a function matching protocol IDs which only differ in a supported version.
+// Versions compatible with the version of the protocol ID and explicitly supported versions are accepted.
+// The protocol ID and the explicitly supported versions have to be given.
+func protocolMatcher(id protocol.ID, supported []ProtocolVersion) func(string) bool {
+	parts, index, local, ok := splitVersioned(string(id))
+	return func(candidate string) bool {
+		if !ok {
+			return candidate == string(id)
+		}
+		candidateParts := strings.Split(candidate, "/")
+		if len(candidateParts) != len(parts) {
+			return false
+		}
+		for i, part := range candidateParts {
+			if i != index && part != parts[i] {
+				return false
+			}
+		}
+		version, err := ParseProtocolVersion(candidateParts[index])
+		if err != nil {
+			return false
+		}
+		if local.Compatible(version) {
+			return true
+		}
+		for _, s := range supported {
+			if s == version {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// setVersionedHandler registers a stream handler for a protocol and all supported versions of it.
+// Compatible versions are matched, explicitly supported versions are registered as well,
+// hence they are advertised through identify.
+// The host, the protocol ID, the explicitly supported versions and the handler have to be given.
+func setVersionedHandler(h host.Host, id protocol.ID, supported []ProtocolVersion, handler network.StreamHandler) {
+	h.SetStreamHandlerMatch(id, protocolMatcher(id, supported), handler)
+	for _, version := range supported {
+		if versioned := protocol.ID(withVersion(string(id), version)); versioned != id {
+			h.SetStreamHandler(versioned, handler)
+		}
+	}
+}
+
+// fallbackIDs returns the protocol IDs of the explicitly supported versions, the latest version first.
+// The protocol ID and the explicitly supported versions have to be given.
+func fallbackIDs(id protocol.ID, supported []ProtocolVersion) []protocol.ID {
+	sorted := append([]ProtocolVersion(nil), supported...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[j].less(sorted[i])
+	})
+	var ids []protocol.ID
+	for _, version := range sorted {
+		if versioned := protocol.ID(withVersion(string(id), version)); versioned != id {
+			ids = append(ids, versioned)
+		}
+	}
+	return ids
+}
+
+// PeerProtocols represents the protocol versions of a connected peer.
+type PeerProtocols struct {
+	PeerID     string   `json:"peerId"`               // peer ID
+	Negotiated string   `json:"negotiated,omitempty"` // protocol ID negotiated on the last direct stream
+	Direct     string   `json:"direct,omitempty"`     // latest supported direct protocol version known from identify
+	PubSub     []string `json:"pubSub"`               // versions of the topics the peer is subscribed to
+}
+
+// PeerProtocols reports the protocol versions of all connected peers.
+func (s *Server) PeerProtocols() []*PeerProtocols {
+	var reports []*PeerProtocols
+	topicPeers := s.PubSub.versionedPeers()
+	for _, peerID := range s.Host.Network().Peers() {
+		report := &PeerProtocols{
+			PeerID:     peerID.Pretty(),
+			Negotiated: string(s.Stream.negotiatedWith(peerID)),
+			PubSub:     topicPeers[peerID],
+		}
+		if report.PubSub == nil {
+			report.PubSub = []string{}
+		}
+		if version, ok := s.Stream.advertisedVersion(s.Host, peerID); ok {
+			report.Direct = version.String()
+		}
+		reports = append(reports, report)
+	}
+	sort.Slice(reports, func(i, j int) bool {
+		return reports[i].PeerID < reports[j].PeerID
+	})
+	return reports
+}
+
+// advertisedVersion determines the latest supported version of the direct protocol a peer is known to support.
+// The protocols of a peer are known from identify and from previous protocol negotiations.
+// The host and the peer ID have to be given.
+func (st *Stream) advertisedVersion(h host.Host, peerID peer.ID) (ProtocolVersion, bool) {
+	protocols, err := h.Peerstore().GetProtocols(peerID)
+	if err != nil {
+		return ProtocolVersion{}, false
+	}
+	var latest ProtocolVersion
+	found := false
+	for _, id := range protocols {
+		if !st.match(id) {
+			continue
+		}
+		if version, ok := versionOf(id); ok && (!found || latest.less(version)) {
+			latest, found = version, true
+		}
+	}
+	return latest, found
+}
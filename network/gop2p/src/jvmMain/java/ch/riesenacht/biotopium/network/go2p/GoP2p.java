@@ -21,9 +21,13 @@ package ch.riesenacht.biotopium.network.go2p;
 import jnr.ffi.LibraryLoader;
 import jnr.ffi.Pointer;
 import jnr.ffi.Runtime;
+import jnr.ffi.Struct;
 
 import java.io.File;
 import java.nio.charset.StandardCharsets;
+import java.util.LinkedHashMap;
+import java.util.Map;
+import java.util.function.Consumer;
 
 /**
  * Wrapper for the gop2p library.
@@ -39,11 +43,39 @@ public class GoP2p {
 
     private static final String STRING_BUNDLE_SEPARATOR = ";";
 
+    private static final int ERROR_CODE_ADDRESS_UNREACHABLE = 2;
+
     private final String topic;
     private final String protocolName;
     private final int port;
     private final String[] bootstrapPeers;
     private final String privateKeyBase64;
+    private final Integer peerLookupTimeoutMillis;
+    private final boolean relayHop;
+    private final boolean natService;
+    private final String[] staticRelays;
+    private final String keyFilePath;
+    private final String keyFilePassphrase;
+    private final String playerKeyBase64;
+    private final String[] trustedBlocklordPeerIds;
+    private final String[] trustedBlocklordAddresses;
+    private final String blockStorePath;
+    private final Integer seenCacheTtlMillis;
+    private final boolean compressDirect;
+    private final boolean compressPubSub;
+    private final boolean binaryDirect;
+    private final boolean binaryPubSub;
+    private final Integer areaSize;
+    private final String[] compatibleVersions;
+    private final Map<String, RateLimit> rateLimits;
+    private final Integer banThreshold;
+    private final Integer banDurationMillis;
+    private final String metricsAddress;
+    private final Integer pingIntervalMillis;
+    private final String agentVersion;
+    private final String traceFile;
+    private final String traceFormat;
+    private final Integer traceBufferSize;
 
     static {
         String buildDirPath = new File(GoP2p.class.getProtectionDomain().getCodeSource().getLocation().getPath()).toPath().getParent().getParent().toAbsolutePath().toString();
@@ -51,12 +83,52 @@ public class GoP2p {
         GO_P2P_LIBRARY = LibraryLoader.create(GoP2pLibrary.class).load(path);
     }
 
-    private GoP2p(String topic, String protocolName, int port, String[] bootstrapPeers, String privateKeyBase64) {
+    private GoP2p(String topic, String protocolName, int port, String[] bootstrapPeers, String privateKeyBase64, Integer peerLookupTimeoutMillis, boolean relayHop, boolean natService, String[] staticRelays, String keyFilePath, String keyFilePassphrase, String playerKeyBase64, String[] trustedBlocklordPeerIds, String[] trustedBlocklordAddresses, String blockStorePath, Integer seenCacheTtlMillis, boolean compressDirect, boolean compressPubSub, boolean binaryDirect, boolean binaryPubSub, Integer areaSize, String[] compatibleVersions, Map<String, RateLimit> rateLimits, Integer banThreshold, Integer banDurationMillis, String metricsAddress, Integer pingIntervalMillis, String agentVersion, String traceFile, String traceFormat, Integer traceBufferSize) {
         this.topic = topic;
         this.protocolName = protocolName;
         this.port = port;
         this.bootstrapPeers = bootstrapPeers;
         this.privateKeyBase64 = privateKeyBase64;
+        this.peerLookupTimeoutMillis = peerLookupTimeoutMillis;
+        this.relayHop = relayHop;
+        this.natService = natService;
+        this.staticRelays = staticRelays;
+        this.keyFilePath = keyFilePath;
+        this.keyFilePassphrase = keyFilePassphrase;
+        this.playerKeyBase64 = playerKeyBase64;
+        this.trustedBlocklordPeerIds = trustedBlocklordPeerIds;
+        this.trustedBlocklordAddresses = trustedBlocklordAddresses;
+        this.blockStorePath = blockStorePath;
+        this.seenCacheTtlMillis = seenCacheTtlMillis;
+        this.compressDirect = compressDirect;
+        this.compressPubSub = compressPubSub;
+        this.binaryDirect = binaryDirect;
+        this.binaryPubSub = binaryPubSub;
+        this.areaSize = areaSize;
+        this.compatibleVersions = compatibleVersions;
+        this.rateLimits = rateLimits;
+        this.banThreshold = banThreshold;
+        this.banDurationMillis = banDurationMillis;
+        this.metricsAddress = metricsAddress;
+        this.pingIntervalMillis = pingIntervalMillis;
+        this.agentVersion = agentVersion;
+        this.traceFile = traceFile;
+        this.traceFormat = traceFormat;
+        this.traceBufferSize = traceBufferSize;
+    }
+
+    /**
+     * Represents a token bucket rate limit.
+     */
+    private static class RateLimit {
+
+        private final double rate;
+        private final int burst;
+
+        private RateLimit(double rate, int burst) {
+            this.rate = rate;
+            this.burst = burst;
+        }
     }
 
     /**
@@ -69,6 +141,32 @@ public class GoP2p {
         private int port;
         private String[] bootstrapPeers;
         private String privateKeyBase64;
+        private Integer peerLookupTimeoutMillis;
+        private boolean relayHop;
+        private boolean natService;
+        private String[] staticRelays;
+        private String keyFilePath;
+        private String keyFilePassphrase;
+        private String playerKeyBase64;
+        private String[] trustedBlocklordPeerIds;
+        private String[] trustedBlocklordAddresses;
+        private String blockStorePath;
+        private Integer seenCacheTtlMillis;
+        private boolean compressDirect;
+        private boolean compressPubSub;
+        private boolean binaryDirect;
+        private boolean binaryPubSub;
+        private Integer areaSize;
+        private String[] compatibleVersions;
+        private final Map<String, RateLimit> rateLimits = new LinkedHashMap<>();
+        private Integer banThreshold;
+        private Integer banDurationMillis;
+        private String metricsAddress;
+        private Integer pingIntervalMillis;
+        private String agentVersion;
+        private String traceFile;
+        private String traceFormat;
+        private Integer traceBufferSize;
 
         private Builder() { }
 
@@ -122,6 +220,235 @@ public class GoP2p {
             return this;
         }
 
+        /**
+         * Sets the timeout for looking up and dialing peers of the new {@link GoP2p} instance.
+         * @param peerLookupTimeoutMillis timeout in milliseconds
+         * @return builder
+         */
+        public Builder peerLookupTimeoutMillis(int peerLookupTimeoutMillis) {
+            this.peerLookupTimeoutMillis = peerLookupTimeoutMillis;
+            return this;
+        }
+
+        /**
+         * Enables relaying traffic on behalf of other peers on the new {@link GoP2p} instance.
+         * @param relayHop whether to act as relay hop
+         * @return builder
+         */
+        public Builder relayHop(boolean relayHop) {
+            this.relayHop = relayHop;
+            return this;
+        }
+
+        /**
+         * Enables the AutoNAT service on the new {@link GoP2p} instance.
+         * @param natService whether to offer the AutoNAT service
+         * @return builder
+         */
+        public Builder natService(boolean natService) {
+            this.natService = natService;
+            return this;
+        }
+
+        /**
+         * Sets the static relays of the new {@link GoP2p} instance.
+         * @param staticRelays multiaddresses of the relays to use
+         * @return builder
+         */
+        public Builder staticRelays(String[] staticRelays) {
+            this.staticRelays = staticRelays;
+            return this;
+        }
+
+        /**
+         * Sets the passphrase-encrypted identity key file of the new {@link GoP2p} instance.
+         * The key file is only used if no private key is set.
+         * If the file does not exist, it is created containing a new key.
+         * @param keyFilePath path of the key file
+         * @param keyFilePassphrase passphrase of the key file
+         * @return builder
+         */
+        public Builder keyFile(String keyFilePath, String keyFilePassphrase) {
+            this.keyFilePath = keyFilePath;
+            this.keyFilePassphrase = keyFilePassphrase;
+            return this;
+        }
+
+        /**
+         * Sets the private key of the player's key pair as identity key of the new {@link GoP2p} instance.
+         * The player key is only used if no private key is set.
+         * @param playerKeyBase64 base64 encoded raw Ed25519 private key
+         * @return builder
+         */
+        public Builder playerKeyBase64(String playerKeyBase64) {
+            this.playerKeyBase64 = playerKeyBase64;
+            return this;
+        }
+
+        /**
+         * Sets the trusted blocklords of the new {@link GoP2p} instance.
+         * Block announcements not originating from them are rejected.
+         * @param peerIds peer IDs of the trusted blocklords
+         * @param addresses addresses of the trusted blocklords
+         * @return builder
+         */
+        public Builder trustedBlocklords(String[] peerIds, String[] addresses) {
+            this.trustedBlocklordPeerIds = peerIds;
+            this.trustedBlocklordAddresses = addresses;
+            return this;
+        }
+
+        /**
+         * Enables the persistent block store of the new {@link GoP2p} instance.
+         * Accepted block announcements are stored and chain requests are answered without the host.
+         * @param blockStorePath path of the block store file
+         * @return builder
+         */
+        public Builder blockStorePath(String blockStorePath) {
+            this.blockStorePath = blockStorePath;
+            return this;
+        }
+
+        /**
+         * Sets the duration a received action request is remembered by the new {@link GoP2p} instance.
+         * Duplicates received within the duration are dropped.
+         * @param seenCacheTtlMillis duration in milliseconds
+         * @return builder
+         */
+        public Builder seenCacheTtlMillis(int seenCacheTtlMillis) {
+            this.seenCacheTtlMillis = seenCacheTtlMillis;
+            return this;
+        }
+
+        /**
+         * Enables compression of messages sent by the new {@link GoP2p} instance.
+         * Direct messages are only compressed if the receiver supports compression.
+         * Pubsub compression should only be enabled once all peers support compression.
+         * @param direct whether to compress direct messages
+         * @param pubSub whether to compress pubsub messages
+         * @return builder
+         */
+        public Builder compression(boolean direct, boolean pubSub) {
+            this.compressDirect = direct;
+            this.compressPubSub = pubSub;
+            return this;
+        }
+
+        /**
+         * Enables the binary encoding of messages sent by the new {@link GoP2p} instance.
+         * Direct messages are only binary encoded if the receiver supports the binary encoding.
+         * The binary pubsub encoding should only be enabled once all peers support the binary encoding.
+         * @param direct whether to binary encode direct messages
+         * @param pubSub whether to binary encode pubsub messages
+         * @return builder
+         */
+        public Builder binaryEncoding(boolean direct, boolean pubSub) {
+            this.binaryDirect = direct;
+            this.binaryPubSub = pubSub;
+            return this;
+        }
+
+        /**
+         * Sets the number of realms per side of an area sharing an area-of-interest topic
+         * of the new {@link GoP2p} instance.
+         * @param areaSize number of realms per side of an area
+         * @return builder
+         */
+        public Builder areaSize(int areaSize) {
+            this.areaSize = areaSize;
+            return this;
+        }
+
+        /**
+         * Sets the protocol versions supported by the new {@link GoP2p} instance
+         * besides the version of the protocol and topic names.
+         * The supported versions are advertised, used as fallback when sending and their topics are listened and published to.
+         * @param compatibleVersions supported versions of the form major.minor.patch
+         * @return builder
+         */
+        public Builder compatibleVersions(String[] compatibleVersions) {
+            this.compatibleVersions = compatibleVersions;
+            return this;
+        }
+
+        /**
+         * Limits the streams or pubsub messages per peer of a protocol of the new {@link GoP2p} instance.
+         * Excess streams are reset, excess pubsub messages are ignored.
+         * @param protocol protocol to limit, either "direct", "sync" or "pubsub"
+         * @param rate tokens added per second
+         * @param burst maximum number of tokens
+         * @return builder
+         */
+        public Builder rateLimit(String protocol, double rate, int burst) {
+            this.rateLimits.put(protocol, new RateLimit(rate, burst));
+            return this;
+        }
+
+        /**
+         * Enables banning peers exceeding rate limits of the new {@link GoP2p} instance.
+         * @param threshold number of violations resulting in a ban
+         * @param banDurationMillis duration of a ban in milliseconds
+         * @return builder
+         */
+        public Builder autoBan(int threshold, int banDurationMillis) {
+            this.banThreshold = threshold;
+            this.banDurationMillis = banDurationMillis;
+            return this;
+        }
+
+        /**
+         * Enables the HTTP listener of the new {@link GoP2p} instance,
+         * which exports the metrics on /metrics in the Prometheus format.
+         * @param metricsAddress listen address, e.g. 127.0.0.1:9464
+         * @return builder
+         */
+        public Builder metricsAddress(String metricsAddress) {
+            this.metricsAddress = metricsAddress;
+            return this;
+        }
+
+        /**
+         * Sets the interval of measuring the latency to connected peers of the new {@link GoP2p} instance.
+         * @param pingIntervalMillis interval in milliseconds, 0 disables the periodic measurement
+         * @return builder
+         */
+        public Builder pingInterval(int pingIntervalMillis) {
+            this.pingIntervalMillis = pingIntervalMillis;
+            return this;
+        }
+
+        /**
+         * Sets the agent version the new {@link GoP2p} instance announces to other peers.
+         * @param agentVersion agent version, e.g. biotopium-jvm/0.1.0
+         * @return builder
+         */
+        public Builder agentVersion(String agentVersion) {
+            this.agentVersion = agentVersion;
+            return this;
+        }
+
+        /**
+         * Enables writing the gossipsub trace events of the new {@link GoP2p} instance to a file.
+         * @param traceFile path of the trace file
+         * @param traceFormat format of the trace file, either "json" for JSON lines or "pb" for delimited protobufs
+         * @return builder
+         */
+        public Builder traceFile(String traceFile, String traceFormat) {
+            this.traceFile = traceFile;
+            this.traceFormat = traceFormat;
+            return this;
+        }
+
+        /**
+         * Enables keeping the most recent gossipsub trace events of the new {@link GoP2p} instance in memory.
+         * @param traceBufferSize non-negative number of kept events
+         * @return builder
+         */
+        public Builder traceBuffer(int traceBufferSize) {
+            this.traceBufferSize = traceBufferSize;
+            return this;
+        }
+
         /**
          * Finishes the building process.
          * @return new {@link GoP2p} instance
@@ -130,7 +457,19 @@ public class GoP2p {
             if(bootstrapPeers == null) {
                 bootstrapPeers = new String[0];
             }
-            return new GoP2p(topic, protocolName, port, bootstrapPeers, privateKeyBase64);
+            if(staticRelays == null) {
+                staticRelays = new String[0];
+            }
+            if(compatibleVersions == null) {
+                compatibleVersions = new String[0];
+            }
+            if(trustedBlocklordPeerIds == null) {
+                trustedBlocklordPeerIds = new String[0];
+            }
+            if(trustedBlocklordAddresses == null) {
+                trustedBlocklordAddresses = new String[0];
+            }
+            return new GoP2p(topic, protocolName, port, bootstrapPeers, privateKeyBase64, peerLookupTimeoutMillis, relayHop, natService, staticRelays, keyFilePath, keyFilePassphrase, playerKeyBase64, trustedBlocklordPeerIds, trustedBlocklordAddresses, blockStorePath, seenCacheTtlMillis, compressDirect, compressPubSub, binaryDirect, binaryPubSub, areaSize, compatibleVersions, rateLimits, banThreshold, banDurationMillis, metricsAddress, pingIntervalMillis, agentVersion, traceFile, traceFormat, traceBufferSize);
         }
     }
 
@@ -144,8 +483,10 @@ public class GoP2p {
 
     /**
      * Starts the peer-to-peer server.
+     * @throws GoP2pException if the configuration is invalid or the server could not be started
      */
     public void start() {
+        GoError error = new GoError();
         Pointer privateKeyPtr = null;
         if(privateKeyBase64 != null) {
             privateKeyPtr = createPointerFromString(privateKeyBase64);
@@ -153,7 +494,60 @@ public class GoP2p {
         Pointer topicPtr = createPointerFromString(topic);
         Pointer protocolNamePtr = createPointerFromString(protocolName);
         Pointer bootstrapPeerBundlePtr = createPointerFromString(String.join(STRING_BUNDLE_SEPARATOR, bootstrapPeers));
-        GO_P2P_LIBRARY.StartServer(topicPtr, protocolNamePtr, port, bootstrapPeerBundlePtr, privateKeyPtr);
+        if(peerLookupTimeoutMillis != null) {
+            GO_P2P_LIBRARY.ConfigurePeerLookupTimeout(peerLookupTimeoutMillis, error);
+            error.check();
+        }
+        Pointer staticRelayBundlePtr = createPointerFromString(String.join(STRING_BUNDLE_SEPARATOR, staticRelays));
+        GO_P2P_LIBRARY.ConfigureRelay(relayHop, natService, staticRelayBundlePtr);
+        if(keyFilePath != null) {
+            GO_P2P_LIBRARY.ConfigureIdentityKeyFile(createPointerFromString(keyFilePath), createPointerFromString(keyFilePassphrase));
+        }
+        if(playerKeyBase64 != null) {
+            GO_P2P_LIBRARY.ConfigurePlayerKey(createPointerFromString(playerKeyBase64));
+        }
+        Pointer trustedPeerIdBundlePtr = createPointerFromString(String.join(STRING_BUNDLE_SEPARATOR, trustedBlocklordPeerIds));
+        Pointer trustedAddressBundlePtr = createPointerFromString(String.join(STRING_BUNDLE_SEPARATOR, trustedBlocklordAddresses));
+        GO_P2P_LIBRARY.ConfigureTrustedBlocklords(trustedPeerIdBundlePtr, trustedAddressBundlePtr);
+        if(blockStorePath != null) {
+            GO_P2P_LIBRARY.ConfigureBlockStore(createPointerFromString(blockStorePath));
+        }
+        if(seenCacheTtlMillis != null) {
+            GO_P2P_LIBRARY.ConfigureSeenCache(seenCacheTtlMillis);
+        }
+        GO_P2P_LIBRARY.ConfigureCompression(compressDirect, compressPubSub);
+        GO_P2P_LIBRARY.ConfigureBinaryEncoding(binaryDirect, binaryPubSub);
+        if(areaSize != null) {
+            GO_P2P_LIBRARY.ConfigureAreaSize(areaSize, error);
+            error.check();
+        }
+        GO_P2P_LIBRARY.ConfigureCompatibleVersions(createPointerFromString(String.join(STRING_BUNDLE_SEPARATOR, compatibleVersions)));
+        for(Map.Entry<String, RateLimit> rateLimit : rateLimits.entrySet()) {
+            GO_P2P_LIBRARY.ConfigureRateLimit(createPointerFromString(rateLimit.getKey()), rateLimit.getValue().rate, rateLimit.getValue().burst, error);
+            error.check();
+        }
+        if(banThreshold != null) {
+            GO_P2P_LIBRARY.ConfigureAutoBan(banThreshold, banDurationMillis, error);
+            error.check();
+        }
+        if(metricsAddress != null) {
+            GO_P2P_LIBRARY.ConfigureMetricsListener(createPointerFromString(metricsAddress));
+        }
+        if(pingIntervalMillis != null) {
+            GO_P2P_LIBRARY.ConfigurePingInterval(pingIntervalMillis);
+        }
+        if(agentVersion != null) {
+            GO_P2P_LIBRARY.ConfigureAgentVersion(createPointerFromString(agentVersion));
+        }
+        if(traceFile != null) {
+            GO_P2P_LIBRARY.ConfigureTraceFile(createPointerFromString(traceFile), createPointerFromString(traceFormat));
+        }
+        if(traceBufferSize != null) {
+            GO_P2P_LIBRARY.ConfigureTraceBuffer(traceBufferSize, error);
+            error.check();
+        }
+        GO_P2P_LIBRARY.StartServer(topicPtr, protocolNamePtr, port, bootstrapPeerBundlePtr, privateKeyPtr, error);
+        error.check();
     }
 
     /**
@@ -172,6 +566,39 @@ public class GoP2p {
         return peerId;
     }
 
+    /**
+     * Provides the reachability of the local peer.
+     * @return either "public", "private" or "unknown"
+     */
+    public String getReachability() {
+        return GO_P2P_LIBRARY.Reachability().getString(0);
+    }
+
+    /**
+     * Subscribes to a message type.
+     * Once a message type is subscribed, messages of unsubscribed types are no longer delivered.
+     * @param messageType serial name of the message type
+     */
+    public void subscribeMessageType(String messageType) {
+        GO_P2P_LIBRARY.SubscribeMessageType(createPointerFromString(messageType));
+    }
+
+    /**
+     * Unsubscribes from a message type.
+     * Messages of unsubscribed types are still not delivered, even if no message type is subscribed anymore.
+     * @param messageType serial name of the message type
+     */
+    public void unsubscribeMessageType(String messageType) {
+        GO_P2P_LIBRARY.UnsubscribeMessageType(createPointerFromString(messageType));
+    }
+
+    /**
+     * Removes all message type subscriptions, messages of all types are delivered again.
+     */
+    public void deliverAllMessageTypes() {
+        GO_P2P_LIBRARY.DeliverAllMessageTypes();
+    }
+
     /**
      * Listens to new messages.
      * This method is blocking.
@@ -192,24 +619,562 @@ public class GoP2p {
         return result.getString(0);
     }
 
+    /**
+     * Sets the level of all logging subsystems, including the subsystems of libp2p.
+     * @param level logging level, either "debug", "info", "warn" or "error"
+     * @throws GoP2pException if the level is invalid
+     */
+    public void setLogLevel(String level) {
+        GoError error = new GoError();
+        GO_P2P_LIBRARY.SetLogLevel(createPointerFromString(level), error);
+        error.check();
+    }
+
+    /**
+     * Sets the level of a single logging subsystem.
+     * @param subsystem name of the subsystem, e.g. gop2p, pubsub or dht
+     * @param level logging level, either "debug", "info", "warn" or "error"
+     * @throws GoP2pException if the subsystem or the level is invalid
+     */
+    public void setSubsystemLogLevel(String subsystem, String level) {
+        GoError error = new GoError();
+        GO_P2P_LIBRARY.SetSubsystemLogLevel(createPointerFromString(subsystem), createPointerFromString(level), error);
+        error.check();
+    }
+
+    /**
+     * Provides the names of all logging subsystems.
+     * @return names of the subsystems
+     */
+    public String[] getLogSubsystems() {
+        return GO_P2P_LIBRARY.LogSubsystems().getString(0).split(STRING_BUNDLE_SEPARATOR);
+    }
+
+    /**
+     * Forwards the log records of all subsystems to a callback instead of writing them to stderr.
+     * The callback is invoked on a daemon thread, records are dropped if too many are pending.
+     * Should be called before {@link #start()}.
+     * @param capacity maximum number of pending records
+     * @param callback callback receiving the records as JSON objects
+     * @throws GoP2pException if the records are already forwarded
+     */
+    public void forwardLogs(int capacity, Consumer<String> callback) {
+        GoError error = new GoError();
+        GO_P2P_LIBRARY.ForwardLogs(capacity, error);
+        error.check();
+        Thread listener = new Thread(() -> {
+            while(true) {
+                callback.accept(listenLogBlocking());
+            }
+        }, "gop2p-log");
+        listener.setDaemon(true);
+        listener.start();
+    }
+
+    /**
+     * Listens to new log records.
+     * This method is blocking.
+     * @return log record as JSON object
+     * @throws GoP2pException if the records are not forwarded
+     */
+    public String listenLogBlocking() {
+        GoError error = new GoError();
+        String record = GO_P2P_LIBRARY.ListenLogBlocking(error).getString(0);
+        error.check();
+        return record;
+    }
+
     /**
      * Broadcasts a message.
      * @param serialized serialized message
+     * @throws GoP2pException if the message could not be published, e.g. if it is invalid
      */
     public void sendPubSub(String serialized) {
+        GoError error = new GoError();
+        Pointer ptr = createPointerFromString(serialized);
+        GO_P2P_LIBRARY.SendPubSub(ptr, error);
+        error.check();
+    }
+
+    /**
+     * Listens to new messages on the subscribed area-of-interest topics.
+     * This method is blocking.
+     * @return received message
+     */
+    public String listenAreaPubSubBlocking() {
+        Pointer result = GO_P2P_LIBRARY.ListenAreaPubSubBlocking();
+        return result.getString(0);
+    }
+
+    /**
+     * Broadcasts a message to all peers interested in a realm.
+     * @param ix horizontal realm index
+     * @param iy vertical realm index
+     * @param serialized serialized message
+     * @throws GoP2pException if the message could not be published
+     */
+    public void sendAreaPubSub(int ix, int iy, String serialized) {
+        GoError error = new GoError();
         Pointer ptr = createPointerFromString(serialized);
-        GO_P2P_LIBRARY.SendPubSub(ptr);
+        GO_P2P_LIBRARY.SendAreaPubSub(ix, iy, ptr, error);
+        error.check();
+    }
+
+    /**
+     * Sets the realms of interest.
+     * Messages of the areas containing the realms are received, messages of all other areas are not.
+     * @param realmsJson JSON array of objects containing the realm indices ix and iy
+     * @throws GoP2pException if the interest set could not be applied
+     */
+    public void setAreaInterest(String realmsJson) {
+        GoError error = new GoError();
+        Pointer ptr = createPointerFromString(realmsJson);
+        GO_P2P_LIBRARY.SetAreaInterest(ptr, error);
+        error.check();
+    }
+
+    /**
+     * Sets the realms within a square around a realm as realms of interest.
+     * @param ix horizontal index of the realm in the center
+     * @param iy vertical index of the realm in the center
+     * @param radius radius in realms
+     * @throws GoP2pException if the interest set could not be applied
+     */
+    public void setAreaInterestAround(int ix, int iy, int radius) {
+        GoError error = new GoError();
+        GO_P2P_LIBRARY.SetAreaInterestAround(ix, iy, radius, error);
+        error.check();
+    }
+
+    /**
+     * Provides the subscribed area-of-interest topics.
+     * @return names of the subscribed area topics
+     */
+    public String[] getAreaInterest() {
+        String topicBundle = GO_P2P_LIBRARY.AreaInterest().getString(0);
+        if(topicBundle.isEmpty()) {
+            return new String[0];
+        }
+        return topicBundle.split(STRING_BUNDLE_SEPARATOR);
     }
 
     /**
      * Sends a message to a peer.
+     * Unknown peers are looked up using the routing layer.
      * @param peerId peer ID of receiver
      * @param serialized serialized message
+     * @throws GoP2pException if the message could not be sent
      */
     public void sendStream(String peerId, String serialized) {
+        GoError error = new GoError();
         Pointer peerIdPtr = createPointerFromString(peerId);
         Pointer serializedPtr = createPointerFromString(serialized);
-        GO_P2P_LIBRARY.SendStream(peerIdPtr, serializedPtr);
+        GO_P2P_LIBRARY.SendStream(peerIdPtr, serializedPtr, error);
+        error.check();
+    }
+
+    /**
+     * Looks up the addresses of a peer using the routing layer.
+     * @param peerId peer ID to look up
+     * @return addresses of the peer or null if the peer was not found
+     * @throws GoP2pException if the peer ID is invalid or the lookup failed
+     */
+    public String[] findPeer(String peerId) {
+        GoError error = new GoError();
+        Pointer peerIdPtr = createPointerFromString(peerId);
+        Pointer result = GO_P2P_LIBRARY.FindPeer(peerIdPtr, error);
+        error.check();
+        if(result == null) {
+            return null;
+        }
+        return result.getString(0).split(STRING_BUNDLE_SEPARATOR);
+    }
+
+    /**
+     * Connects to a peer.
+     * @param target peer ID or multiaddress containing a peer ID
+     * @throws GoP2pException if the connection failed
+     */
+    public void connect(String target) {
+        GoError error = new GoError();
+        Pointer targetPtr = createPointerFromString(target);
+        GO_P2P_LIBRARY.Connect(targetPtr, error);
+        error.check();
+    }
+
+    /**
+     * Closes all connections to a peer.
+     * @param peerId peer ID to disconnect from
+     * @throws GoP2pException if the peer could not be disconnected
+     */
+    public void disconnect(String peerId) {
+        GoError error = new GoError();
+        Pointer peerIdPtr = createPointerFromString(peerId);
+        GO_P2P_LIBRARY.Disconnect(peerIdPtr, error);
+        error.check();
+    }
+
+    /**
+     * Stores a value owned by the local peer in the DHT.
+     * @param name record name
+     * @param value value to store
+     * @throws GoP2pException if the value could not be stored
+     */
+    public void putValue(String name, String value) {
+        GoError error = new GoError();
+        Pointer namePtr = createPointerFromString(name);
+        Pointer valuePtr = createPointerFromString(value);
+        GO_P2P_LIBRARY.PutValue(namePtr, valuePtr, error);
+        error.check();
+    }
+
+    /**
+     * Retrieves a value from the DHT.
+     * @param name record name
+     * @param ownerPeerId peer ID of the record owner
+     * @return value or null if no value was found
+     * @throws GoP2pException if the value could not be retrieved
+     */
+    public String getValue(String name, String ownerPeerId) {
+        GoError error = new GoError();
+        Pointer namePtr = createPointerFromString(name);
+        Pointer ownerPtr = createPointerFromString(ownerPeerId);
+        Pointer result = GO_P2P_LIBRARY.GetValue(namePtr, ownerPtr, error);
+        error.check();
+        if(result == null) {
+            return null;
+        }
+        return result.getString(0);
+    }
+
+    /**
+     * Searches the DHT exhaustively for the freshest value.
+     * @param name record name
+     * @param ownerPeerId peer ID of the record owner
+     * @return value or null if no value was found
+     * @throws GoP2pException if the value could not be retrieved
+     */
+    public String searchValue(String name, String ownerPeerId) {
+        GoError error = new GoError();
+        Pointer namePtr = createPointerFromString(name);
+        Pointer ownerPtr = createPointerFromString(ownerPeerId);
+        Pointer result = GO_P2P_LIBRARY.SearchValue(namePtr, ownerPtr, error);
+        error.check();
+        if(result == null) {
+            return null;
+        }
+        return result.getString(0);
+    }
+
+    /**
+     * Publishes a peer record binding the local peer ID to the player's address.
+     * The record is republished periodically and stored in the DHT.
+     * @param playerKeyBase64 base64 encoded raw Ed25519 private key of the player
+     * @throws GoP2pException if the record could not be published
+     */
+    public void publishPeerRecord(String playerKeyBase64) {
+        GoError error = new GoError();
+        GO_P2P_LIBRARY.PublishPeerRecord(createPointerFromString(playerKeyBase64), error);
+        error.check();
+    }
+
+    /**
+     * Looks up the peer ID bound to an address by a verified peer record.
+     * @param address biotopium address
+     * @return peer ID or null if no record is known
+     */
+    public String lookupPeerRecord(String address) {
+        return nullIfEmpty(GO_P2P_LIBRARY.LookupPeerRecord(createPointerFromString(address)).getString(0));
+    }
+
+    /**
+     * Resolves the peer ID of an address using peer records, the DHT and the address key.
+     * @param address biotopium address
+     * @return peer ID
+     * @throws AddressUnreachableException if the address could not be resolved
+     */
+    public String resolveAddress(String address) {
+        GoError error = new GoError();
+        String peerId = GO_P2P_LIBRARY.ResolveAddress(createPointerFromString(address), error).getString(0);
+        error.check();
+        return peerId;
+    }
+
+    /**
+     * Sends a message to the peer of an address.
+     * The address is resolved and the peer is dialed if necessary.
+     * @param address biotopium address of the receiver
+     * @param serialized serialized message
+     * @throws AddressUnreachableException if the address could not be resolved or reached
+     */
+    public void sendToAddress(String address, String serialized) {
+        GoError error = new GoError();
+        Pointer addressPtr = createPointerFromString(address);
+        Pointer serializedPtr = createPointerFromString(serialized);
+        GO_P2P_LIBRARY.SendToAddress(addressPtr, serializedPtr, error);
+        error.check();
+    }
+
+    /**
+     * Generates a new Ed25519 identity key.
+     * @return private key in the base64 encoded libp2p protobuf format
+     * @throws GoP2pException if the key could not be generated
+     */
+    public static String generateIdentityKey() {
+        GoError error = new GoError();
+        String key = GO_P2P_LIBRARY.GenerateIdentityKey(error).getString(0);
+        error.check();
+        return key;
+    }
+
+    /**
+     * Derives the peer ID of an identity key.
+     * @param privateKeyBase64 private key in the base64 encoded libp2p protobuf format
+     * @return peer ID
+     * @throws GoP2pException if the key is invalid
+     */
+    public static String identityPeerId(String privateKeyBase64) {
+        GoError error = new GoError();
+        String peerId = GO_P2P_LIBRARY.IdentityPeerID(createPointerFromString(privateKeyBase64), error).getString(0);
+        error.check();
+        return peerId;
+    }
+
+    /**
+     * Stores an identity key in a passphrase-encrypted key file.
+     * @param path path of the key file
+     * @param passphrase passphrase to encrypt the key file with
+     * @param privateKeyBase64 private key in the base64 encoded libp2p protobuf format
+     * @throws GoP2pException if the key could not be stored
+     */
+    public static void saveIdentityKey(String path, String passphrase, String privateKeyBase64) {
+        GoError error = new GoError();
+        Pointer pathPtr = createPointerFromString(path);
+        Pointer passphrasePtr = createPointerFromString(passphrase);
+        Pointer keyPtr = createPointerFromString(privateKeyBase64);
+        GO_P2P_LIBRARY.SaveIdentityKey(pathPtr, passphrasePtr, keyPtr, error);
+        error.check();
+    }
+
+    /**
+     * Loads an identity key from a passphrase-encrypted key file.
+     * @param path path of the key file
+     * @param passphrase passphrase of the key file
+     * @return private key in the base64 encoded libp2p protobuf format
+     * @throws GoP2pException if the key could not be loaded
+     */
+    public static String loadIdentityKey(String path, String passphrase) {
+        GoError error = new GoError();
+        String key = GO_P2P_LIBRARY.LoadIdentityKey(createPointerFromString(path), createPointerFromString(passphrase), error).getString(0);
+        error.check();
+        return key;
+    }
+
+    /**
+     * Derives the peer ID of a node using the key pair of an address.
+     * @param address biotopium address
+     * @return peer ID
+     * @throws GoP2pException if the address is invalid
+     */
+    public static String addressToPeerId(String address) {
+        GoError error = new GoError();
+        String peerId = GO_P2P_LIBRARY.AddressToPeerID(createPointerFromString(address), error).getString(0);
+        error.check();
+        return peerId;
+    }
+
+    /**
+     * Derives the address of a peer ID embedding an Ed25519 public key.
+     * @param peerId peer ID
+     * @return biotopium address
+     * @throws GoP2pException if no address can be derived
+     */
+    public static String peerIdToAddress(String peerId) {
+        GoError error = new GoError();
+        String address = GO_P2P_LIBRARY.PeerIDToAddress(createPointerFromString(peerId), error).getString(0);
+        error.check();
+        return address;
+    }
+
+    /**
+     * Provides the compression statistics.
+     * @return JSON object containing the raw and compressed bytes and the compression ratios
+     */
+    public String getCompressionStats() {
+        return GO_P2P_LIBRARY.CompressionStats().getString(0);
+    }
+
+    /**
+     * Provides the protocol versions of the connected peers.
+     * @return JSON array containing the negotiated, advertised and subscribed protocol versions of each peer
+     */
+    public String getPeerProtocols() {
+        return GO_P2P_LIBRARY.PeerProtocols().getString(0);
+    }
+
+    /**
+     * Provides the identify information of the connected peers.
+     * @return JSON array containing the agent version, protocol version, protocols, observed address and listen addresses of each peer
+     */
+    public String getPeerIdentities() {
+        return GO_P2P_LIBRARY.PeerIdentities().getString(0);
+    }
+
+    /**
+     * Provides the gossipsub trace events kept in memory.
+     * @return JSON array containing the trace events in chronological order, empty if the trace buffer is disabled
+     */
+    public String getTraceEvents() {
+        return GO_P2P_LIBRARY.TraceEvents().getString(0);
+    }
+
+    /**
+     * Provides a snapshot of the metrics.
+     * @return JSON object containing the bandwidth, message counts, validation rejects, queue depths and connection counts
+     */
+    public String getMetrics() {
+        return GO_P2P_LIBRARY.Metrics().getString(0);
+    }
+
+    /**
+     * Sends pings to a peer and measures the round-trip times.
+     * The peer is dialed if necessary.
+     * @param peerId peer ID of the peer to ping
+     * @param count number of pings
+     * @return JSON object containing the round-trip times, the number of lost pings and the minimum, average and maximum round-trip time
+     * @throws GoP2pException if no ping could be sent
+     */
+    public String ping(String peerId, int count) {
+        GoError error = new GoError();
+        Pointer peerIdPtr = createPointerFromString(peerId);
+        String result = GO_P2P_LIBRARY.Ping(peerIdPtr, count, error).getString(0);
+        error.check();
+        return result;
+    }
+
+    /**
+     * Provides the latencies to the connected peers.
+     * @return JSON array containing the moving average of the round-trip times of each peer with a measured latency
+     */
+    public String getLatencies() {
+        return GO_P2P_LIBRARY.Latencies().getString(0);
+    }
+
+    /**
+     * Provides the peers which exceeded a rate limit.
+     * @return JSON array containing the violations and the end of a ban of each peer
+     */
+    public String getRateLimitOffenders() {
+        return GO_P2P_LIBRARY.RateLimitOffenders().getString(0);
+    }
+
+    /**
+     * Lifts the ban of a peer and forgets its rate limit violations.
+     * @param peerId peer ID of the banned peer
+     * @throws GoP2pException if the peer ID is invalid
+     */
+    public void unbanPeer(String peerId) {
+        GoError error = new GoError();
+        Pointer peerIdPtr = createPointerFromString(peerId);
+        GO_P2P_LIBRARY.UnbanPeer(peerIdPtr, error);
+        error.check();
+    }
+
+    /**
+     * Provides the number of blocks in the block store.
+     * @return number of stored blocks
+     * @throws GoP2pException if the block store is disabled
+     */
+    public long blockHeight() {
+        GoError error = new GoError();
+        long height = GO_P2P_LIBRARY.BlockHeight(error);
+        error.check();
+        return height;
+    }
+
+    /**
+     * Reads the next chunk of blocks within a height range from the block store.
+     * The chunk is bounded in size, the range is continued by reading from the next height of the chunk until it is done.
+     * @param from first height
+     * @param to last height (inclusive)
+     * @return JSON object containing the serialized blocks, the next height and whether the range is done
+     * @throws GoP2pException if the blocks could not be read
+     */
+    public String getBlockChunk(long from, long to) {
+        GoError error = new GoError();
+        String chunk = GO_P2P_LIBRARY.GetBlockChunk(from, to, error).getString(0);
+        error.check();
+        return chunk;
+    }
+
+    /**
+     * Fetches the next chunk of blocks within a height range from a peer using the sync protocol.
+     * The chunk is bounded in size, the range is continued by fetching from the next height of the chunk until it is done.
+     * An interrupted transfer is resumed.
+     * @param peerId peer ID of the remote peer
+     * @param from first height
+     * @param to last height (inclusive), negative to fetch up to the head of the remote chain
+     * @return JSON object containing the serialized blocks, the next height and whether the range is done
+     * @throws GoP2pException if the blocks could not be fetched
+     */
+    public String fetchBlockChunk(String peerId, long from, long to) {
+        return fetchBlockChunk(peerId, "", from, to);
+    }
+
+    /**
+     * Fetches the first chunk of the blocks following a known block from a peer using the sync protocol.
+     * The transfer is continued by {@link #fetchBlockChunk(String, long, long)} from the next height of the chunk.
+     * @param peerId peer ID of the remote peer
+     * @param fromHash hash of the known block
+     * @param to last height (inclusive), negative to fetch up to the head of the remote chain
+     * @return JSON object containing the serialized blocks, the next height and whether the range is done
+     * @throws GoP2pException if the blocks could not be fetched
+     */
+    public String fetchBlockChunkAfter(String peerId, String fromHash, long to) {
+        return fetchBlockChunk(peerId, fromHash, 0, to);
+    }
+
+    /**
+     * Fetches a chunk of blocks from a peer using the sync protocol.
+     * @param peerId peer ID of the remote peer
+     * @param fromHash hash of a known block or empty string
+     * @param from first height, ignored if the hash is given
+     * @param to last height (inclusive), negative to fetch up to the head of the remote chain
+     * @return JSON object containing the serialized blocks, the next height and whether the range is done
+     */
+    private String fetchBlockChunk(String peerId, String fromHash, long from, long to) {
+        GoError error = new GoError();
+        Pointer peerIdPtr = createPointerFromString(peerId);
+        Pointer fromHashPtr = createPointerFromString(fromHash);
+        String chunk = GO_P2P_LIBRARY.FetchBlockChunk(peerIdPtr, fromHashPtr, from, to, error).getString(0);
+        error.check();
+        return chunk;
+    }
+
+    /**
+     * Fetches the blocks following the stored chain from a peer.
+     * The blocks are validated and appended to the block store.
+     * @param peerId peer ID of the remote peer
+     * @return number of stored blocks
+     * @throws GoP2pException if the chain could not be synchronized
+     */
+    public long syncChain(String peerId) {
+        GoError error = new GoError();
+        long stored = GO_P2P_LIBRARY.SyncChain(createPointerFromString(peerId), error);
+        error.check();
+        return stored;
+    }
+
+    /**
+     * Maps an empty string to null.
+     * @param str string to map
+     * @return string or null if the string is empty
+     */
+    private static String nullIfEmpty(String str) {
+        if(str.isEmpty()) {
+            return null;
+        }
+        return str;
     }
 
     /**
@@ -217,7 +1182,7 @@ public class GoP2p {
      * @param str string to put in pointer
      * @return pointer to string
      */
-    private Pointer createPointerFromString(String str) {
+    private static Pointer createPointerFromString(String str) {
         // correct C string size
         int size = str.length()+1;
         Pointer ptr =  Runtime.getSystemRuntime().getMemoryManager().allocateTemporary(size, true);
@@ -225,17 +1190,113 @@ public class GoP2p {
         return ptr;
     }
 
+    /**
+     * Receives the error of a call to the gop2p library.
+     * A new instance has to be passed to each call, the message stays null if no error occurred.
+     */
+    public static final class GoError extends Struct {
+
+        private final Struct.Pointer message = new Struct.Pointer();
+        private final Signed32 code = new Signed32();
+
+        private GoError() {
+            super(Runtime.getRuntime(GO_P2P_LIBRARY));
+        }
+
+        /**
+         * Throws the error received by the call, if any.
+         * The message is released afterwards.
+         * @throws GoP2pException if the call failed
+         * @throws AddressUnreachableException if an address could not be resolved or reached
+         */
+        private void check() {
+            jnr.ffi.Pointer messagePtr = message.get();
+            if(messagePtr == null) {
+                return;
+            }
+            String str = messagePtr.getString(0);
+            int errorCode = code.get();
+            GO_P2P_LIBRARY.FreeError(this);
+            if(errorCode == ERROR_CODE_ADDRESS_UNREACHABLE) {
+                throw new AddressUnreachableException(str);
+            }
+            throw new GoP2pException(str);
+        }
+    }
+
     /**
      * Represents the gop2p library.
      */
     public interface GoP2pLibrary {
-        void StartServer(Pointer topicPtr, Pointer protocolNamePtr, int port, Pointer bootstrapPeerBundlePtr, Pointer pkBase64Ptr);
+        boolean StartServer(Pointer topicPtr, Pointer protocolNamePtr, int port, Pointer bootstrapPeerBundlePtr, Pointer pkBase64Ptr, GoError error);
         void StopServer();
-        void SendPubSub(Pointer serialized);
-        void SendStream(Pointer peerId, Pointer serialized);
+        boolean SendPubSub(Pointer serialized, GoError error);
+        boolean SendStream(Pointer peerId, Pointer serialized, GoError error);
         Pointer PeerID();
         Pointer ListenPubSubBlocking();
         Pointer ListenStreamBlocking();
+        boolean PutValue(Pointer name, Pointer value, GoError error);
+        Pointer GetValue(Pointer name, Pointer ownerPeerId, GoError error);
+        Pointer SearchValue(Pointer name, Pointer ownerPeerId, GoError error);
+        void FreeError(GoError error);
+        boolean ConfigurePeerLookupTimeout(int timeoutMillis, GoError error);
+        void ConfigureRelay(boolean hop, boolean natService, Pointer staticRelayBundle);
+        Pointer Reachability();
+        void ConfigureIdentityKeyFile(Pointer path, Pointer passphrase);
+        Pointer GenerateIdentityKey(GoError error);
+        Pointer IdentityPeerID(Pointer privateKeyBase64, GoError error);
+        boolean SaveIdentityKey(Pointer path, Pointer passphrase, Pointer privateKeyBase64, GoError error);
+        Pointer LoadIdentityKey(Pointer path, Pointer passphrase, GoError error);
+        void ConfigurePlayerKey(Pointer privateKeyBase64);
+        Pointer AddressToPeerID(Pointer address, GoError error);
+        Pointer PeerIDToAddress(Pointer peerId, GoError error);
+        boolean PublishPeerRecord(Pointer playerKeyBase64, GoError error);
+        Pointer LookupPeerRecord(Pointer address);
+        Pointer ResolveAddress(Pointer address, GoError error);
+        boolean SendToAddress(Pointer address, Pointer serialized, GoError error);
+        void SubscribeMessageType(Pointer messageType);
+        void ConfigureTrustedBlocklords(Pointer peerIdBundle, Pointer addressBundle);
+        void UnsubscribeMessageType(Pointer messageType);
+        void DeliverAllMessageTypes();
+        Pointer FindPeer(Pointer peerId, GoError error);
+        boolean Connect(Pointer target, GoError error);
+        boolean Disconnect(Pointer peerId, GoError error);
+        void ConfigureBlockStore(Pointer path);
+        long BlockHeight(GoError error);
+        Pointer GetBlockChunk(long from, long to, GoError error);
+        Pointer FetchBlockChunk(Pointer peerId, Pointer fromHash, long from, long to, GoError error);
+        long SyncChain(Pointer peerId, GoError error);
+        void ConfigureSeenCache(int ttlMillis);
+        void ConfigureCompression(boolean direct, boolean pubSub);
+        void ConfigureBinaryEncoding(boolean direct, boolean pubSub);
+        boolean ConfigureAreaSize(int size, GoError error);
+        void ConfigureCompatibleVersions(Pointer versionBundle);
+        Pointer PeerProtocols();
+        boolean ConfigureRateLimit(Pointer protocol, double rate, int burst, GoError error);
+        boolean ConfigureAutoBan(int threshold, int durationMillis, GoError error);
+        Pointer RateLimitOffenders();
+        boolean UnbanPeer(Pointer peerId, GoError error);
+        void ConfigureMetricsListener(Pointer address);
+        Pointer Metrics();
+        void ConfigurePingInterval(int intervalMillis);
+        Pointer Ping(Pointer peerId, int count, GoError error);
+        Pointer Latencies();
+        void ConfigureAgentVersion(Pointer agentVersion);
+        Pointer PeerIdentities();
+        void ConfigureTraceFile(Pointer path, Pointer format);
+        boolean ConfigureTraceBuffer(int size, GoError error);
+        Pointer TraceEvents();
+        boolean SetLogLevel(Pointer level, GoError error);
+        boolean SetSubsystemLogLevel(Pointer subsystem, Pointer level, GoError error);
+        Pointer LogSubsystems();
+        boolean ForwardLogs(int capacity, GoError error);
+        Pointer ListenLogBlocking(GoError error);
+        Pointer ListenAreaPubSubBlocking();
+        boolean SendAreaPubSub(int ix, int iy, Pointer serialized, GoError error);
+        boolean SetAreaInterest(Pointer realms, GoError error);
+        boolean SetAreaInterestAround(int ix, int iy, int radius, GoError error);
+        Pointer AreaInterest();
+        Pointer CompressionStats();
     }
 
 }
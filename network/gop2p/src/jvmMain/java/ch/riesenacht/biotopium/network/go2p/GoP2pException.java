@@ -0,0 +1,33 @@
+/*
+ * Copyright (c) 2021 The biotopium Authors.
+ * This file is part of biotopium.
+ *
+ * biotopium is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * biotopium is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with biotopium.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package ch.riesenacht.biotopium.network.go2p;
+
+/**
+ * Exception thrown if a call to the gop2p library fails.
+ */
+public class GoP2pException extends RuntimeException {
+
+    /**
+     * Creates a new exception.
+     * @param message error message reported by the gop2p library
+     */
+    public GoP2pException(String message) {
+        super(message);
+    }
+}
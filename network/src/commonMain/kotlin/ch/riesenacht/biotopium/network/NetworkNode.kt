@@ -89,6 +89,27 @@ abstract class NetworkNode : NetworkContext {
         sendSerialized(peerId, serialized)
     }
 
+    /**
+     * Resolves the peer ID bound to an [address][addressBase64] by a verified peer record.
+     * Returns null if no verified peer record is known or the node does not support peer records.
+     */
+    open fun resolveAddress(addressBase64: String): PeerId? = null
+
+    /**
+     * Publishes a peer record binding the own peer ID to the address of the player's private key.
+     * The record is signed by the [private key][playerKeyBase64], hence other peers can verify it.
+     */
+    open fun publishPeerRecord(playerKeyBase64: String) {
+        logger.warn { "peer records are not supported by this network node" }
+    }
+
+    /**
+     * Subscribes to messages of a [type][messageType] given by its serial name.
+     * Once a message type is subscribed, the node only delivers messages of subscribed types.
+     * Does nothing if the node does not filter message types.
+     */
+    open fun subscribeMessageType(messageType: String) {}
+
     /**
      * Registers a [handler] for a message [type].
      */
@@ -124,7 +145,11 @@ abstract class NetworkNode : NetworkContext {
     private fun <T : Message> dispatchToHandler(message: MessageEnvelope<T>) {
         //UNCHECKED cast in order to retrieve the type of the message handler
         @Suppress("UNCHECKED_CAST")
-        val handlerList = handlerMap[message.message::class] as List<MessageHandler<T>>
+        val handlerList = handlerMap[message.message::class] as List<MessageHandler<T>>?
+        if(handlerList == null) {
+            logger.debug { "no handler registered for message: $message" }
+            return
+        }
         handlerList.forEach { it.invoke(message, this) }
     }
 
@@ -18,11 +18,18 @@
 
 package ch.riesenacht.biotopium.network
 
+import ch.riesenacht.biotopium.logging.Logging
+import ch.riesenacht.biotopium.logging.LoggingConfig
+import ch.riesenacht.biotopium.logging.LoggingLevel
 import ch.riesenacht.biotopium.network.go2p.GoP2p
+import ch.riesenacht.biotopium.network.go2p.GoP2pException
 import ch.riesenacht.biotopium.network.model.PeerId
 import ch.riesenacht.biotopium.network.model.config.P2pConfiguration
 import ch.riesenacht.biotopium.network.model.message.SerializedMessage
 import kotlinx.coroutines.*
+import kotlinx.serialization.json.Json
+import kotlinx.serialization.json.jsonObject
+import kotlinx.serialization.json.jsonPrimitive
 
 /**
  * Represents a peer-to-peer node.
@@ -45,12 +52,24 @@ actual class P2pNode actual constructor(
         .privateKeyBase64(p2pConfig.privateKeyBase64)
         .build()
 
+    init {
+        configureGoLogging(gop2p)
+    }
+
     private var listenPubSubJob: Job? = null
 
     private var listenStreamJob: Job? = null
 
+    private val subscribedMessageTypes: MutableSet<String> = mutableSetOf()
+
+    private var started = false
+
     override suspend fun start() {
         gop2p.start()
+        synchronized(subscribedMessageTypes) {
+            subscribedMessageTypes.forEach { gop2p.subscribeMessageType(it) }
+            started = true
+        }
         startListeningPubSub()
         startListeningStream()
     }
@@ -68,6 +87,31 @@ actual class P2pNode actual constructor(
         gop2p.sendStream(peerId.base58, message)
     }
 
+    override fun resolveAddress(addressBase64: String): PeerId? {
+        return try {
+            PeerId(gop2p.resolveAddress(addressBase64))
+        } catch (e: GoP2pException) {
+            logger.debug { "address $addressBase64 could not be resolved: ${e.message}" }
+            null
+        }
+    }
+
+    override fun publishPeerRecord(playerKeyBase64: String) {
+        gop2p.publishPeerRecord(playerKeyBase64)
+    }
+
+    /**
+     * Subscribes to a message type, types subscribed before the node is started are subscribed on start.
+     */
+    override fun subscribeMessageType(messageType: String) {
+        synchronized(subscribedMessageTypes) {
+            subscribedMessageTypes.add(messageType)
+            if(started) {
+                gop2p.subscribeMessageType(messageType)
+            }
+        }
+    }
+
     private suspend fun startListeningStream(): Unit = withContext(Dispatchers.Default) {
         listenStreamJob = launch(Job()) { listenStreamBlocking() }
     }
@@ -88,4 +132,57 @@ actual class P2pNode actual constructor(
         listenPubSubBlocking()
     }
 
+    private companion object {
+
+        /**
+         * Maximum number of pending log records of the Go library.
+         */
+        const val LOG_CAPACITY = 1024
+
+        val goLogger = Logging.logger("gop2p")
+
+        var goLoggingConfigured = false
+
+        /**
+         * Forwards the log records of the Go library to the [goLogger] and applies the [LoggingConfig] level to it.
+         * The Go library logs process-wide, hence it is configured once.
+         */
+        @Synchronized
+        fun configureGoLogging(gop2p: GoP2p) {
+            if(goLoggingConfigured) {
+                return
+            }
+            goLoggingConfigured = true
+            gop2p.forwardLogs(LOG_CAPACITY) { logGoRecord(it) }
+            LoggingConfig.addLevelListener { gop2p.setLogLevel(it.goLevel) }
+        }
+
+        /**
+         * Logs a [record] of the Go library at its level.
+         */
+        fun logGoRecord(record: String) {
+            val level = try {
+                Json.parseToJsonElement(record).jsonObject["level"]?.jsonPrimitive?.content
+            } catch (e: IllegalArgumentException) {
+                null
+            }
+            when(level) {
+                "debug" -> goLogger.debug { record }
+                "info" -> goLogger.info { record }
+                "warn" -> goLogger.warn { record }
+                else -> goLogger.error { record }
+            }
+        }
+
+        /**
+         * The level of the Go library corresponding to a logging level, the Go library does not trace.
+         */
+        val LoggingLevel.goLevel: String
+            get() = when(this) {
+                LoggingLevel.TRACE, LoggingLevel.DEBUG -> "debug"
+                LoggingLevel.INFO -> "info"
+                LoggingLevel.WARN -> "warn"
+                LoggingLevel.ERROR -> "error"
+            }
+    }
 }
\ No newline at end of file